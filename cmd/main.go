@@ -4,8 +4,11 @@ import (
 	"context"
 	"devices-api/internal/config"
 	"devices-api/internal/database"
+	"devices-api/internal/events"
 	"devices-api/internal/handler"
 	"devices-api/internal/middleware"
+	"devices-api/internal/models"
+	"devices-api/internal/openapi"
 	"devices-api/internal/repository"
 	"devices-api/internal/service"
 	"log"
@@ -15,13 +18,16 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
 func main() {
 	cfg := config.Load()
 
+	if _, err := models.FormatAssetTag(cfg.AssetTag.Pattern, 0); err != nil {
+		log.Fatalf("Invalid ASSET_TAG_PATTERN %q: %v", cfg.AssetTag.Pattern, err)
+	}
+
 	// Setup database connection
 	db, err := database.NewPostgresConnection(cfg.Database)
 	if err != nil {
@@ -35,14 +41,53 @@ func main() {
 
 	// Initialize dependencies
 	deviceRepo := repository.NewPostgresDeviceRepository(db)
-	deviceService := service.NewDeviceService(deviceRepo)
-	deviceHandler := handler.NewDeviceHandler(deviceService)
+	eventBus := events.NewBus(cfg.Events.ReplaySize)
+	deviceOptions := []service.DeviceServiceOption{service.WithAssetTagPattern(cfg.AssetTag.Pattern)}
+	if !cfg.Events.Listen {
+		// Without the listener only the changes made through this instance are streamed
+		deviceOptions = append(deviceOptions, service.WithEventPublisher(eventBus))
+	}
+	deviceService := service.NewDeviceService(deviceRepo, deviceOptions...)
+	deviceHandler := handler.NewDeviceHandler(deviceService, handler.WithMaxBodySize(cfg.Server.MaxBodySize))
+	deviceEventHandler := handler.NewDeviceEventHandler(eventBus, cfg.Events.HeartbeatInterval)
+	locationRepo := repository.NewPostgresLocationRepository(db)
+	locationService := service.NewLocationService(locationRepo)
+	locationHandler := handler.NewLocationHandler(locationService, handler.WithMaxBodySize(cfg.Server.MaxBodySize))
+	maintenanceRepo := repository.NewPostgresMaintenanceRepository(db)
+	var maintenanceOptions []service.MaintenanceServiceOption
+	if !cfg.Events.Listen {
+		maintenanceOptions = append(maintenanceOptions, service.WithMaintenanceEventPublisher(eventBus))
+	}
+	maintenanceService := service.NewMaintenanceService(maintenanceRepo, deviceRepo, maintenanceOptions...)
+	maintenanceHandler := handler.NewMaintenanceHandler(maintenanceService, handler.WithMaxBodySize(cfg.Server.MaxBodySize))
+	idempotencyRepo := repository.NewPostgresIdempotencyRepository(db)
+	contract, err := openapi.Load(openapi.Spec)
+	if err != nil {
+		log.Fatalf("Failed to load OpenAPI contract: %v", err)
+	}
+
+	// Start background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go runMaintenanceScheduler(jobsCtx, maintenanceService, cfg.Maintenance.CheckInterval)
+	go runIdempotencyKeyCleanup(jobsCtx, idempotencyRepo, idempotencyCleanupInterval)
+	if cfg.Events.Listen {
+		// Device changes reach the event bus through Postgres notifications,
+		// so clients see the changes made through every instance
+		listener := events.NewListener(database.DSN(cfg.Database), eventBus, deviceRepo)
+		if err := listener.Listen(); err != nil {
+			log.Fatalf("Failed to start device change listener: %v", err)
+		}
+		go listener.Run(jobsCtx)
+	}
 
 	// Setup routes
-	router := setupRoutes(deviceHandler)
+	router := handler.NewRouter(deviceHandler, deviceEventHandler, locationHandler, maintenanceHandler)
 
-	// Apply logging middleware to all routes
-	loggedRouter := middleware.LoggingMiddleware(router)
+	// Apply idempotency, contract validation and logging middleware to all routes
+	idempotentRouter := middleware.IdempotencyMiddleware(idempotencyRepo, cfg.Idempotency.TTL, cfg.Idempotency.LockTimeout)(router)
+	validatedRouter := middleware.ValidationMiddleware(contract, cfg.Validation.Responses, cfg.Server.MaxBodySize)(idempotentRouter)
+	loggedRouter := middleware.LoggingMiddleware(validatedRouter)
 
 	// Setup CORS
 	c := cors.New(cors.Options{
@@ -59,6 +104,9 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Event streams and WebSocket connections do not end on their own, so they
+	// are closed on shutdown
+	server.RegisterOnShutdown(eventBus.Close)
 
 	// Start server in a goroutine
 	go func() {
@@ -73,6 +121,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -81,29 +130,54 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if err := deviceEventHandler.Shutdown(ctx); err != nil {
+		log.Printf("WebSocket connections did not close in time: %v", err)
+	}
 
 	log.Println("Server exited")
 }
 
-// setupRoutes configures the HTTP routes
-func setupRoutes(deviceHandler *handler.DeviceHandler) *mux.Router {
-	router := mux.NewRouter()
+// runMaintenanceScheduler periodically turns due maintenance schedules into tickets
+func runMaintenanceScheduler(ctx context.Context, maintenanceService service.MaintenanceService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tickets, err := maintenanceService.GenerateDueTickets(ctx)
+		if err != nil {
+			log.Printf("Failed to generate due maintenance tickets: %v", err)
+		} else if len(tickets) > 0 {
+			log.Printf("Opened %d scheduled maintenance tickets", len(tickets))
+		}
 
-	// API routes
-	api := router.PathPrefix("/api/v1").Subrouter()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-	// Device routes
-	api.HandleFunc("/devices", deviceHandler.CreateDevice).Methods("POST")
-	api.HandleFunc("/devices", deviceHandler.GetAllDevices).Methods("GET")
-	api.HandleFunc("/devices/{id}", deviceHandler.GetDevice).Methods("GET")
-	api.HandleFunc("/devices/{id}", deviceHandler.UpdateDevice).Methods("PUT", "PATCH")
-	api.HandleFunc("/devices/{id}", deviceHandler.DeleteDevice).Methods("DELETE")
+// idempotencyCleanupInterval is how often expired idempotency keys are removed
+const idempotencyCleanupInterval = time.Hour
 
-	// Health check
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+// runIdempotencyKeyCleanup periodically removes expired idempotency keys
+func runIdempotencyKeyCleanup(ctx context.Context, idempotencyRepo repository.IdempotencyRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	return router
+	for {
+		removed, err := idempotencyRepo.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to delete expired idempotency keys: %v", err)
+		} else if removed > 0 {
+			log.Printf("Deleted %d expired idempotency keys", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -3,16 +3,24 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	AssetTag    AssetTagConfig
+	Maintenance MaintenanceConfig
+	Idempotency IdempotencyConfig
+	Validation  ValidationConfig
+	Events      EventsConfig
 }
 
 type ServerConfig struct {
 	Host string
 	Port string
+	// MaxBodySize is the largest JSON request body accepted, in bytes
+	MaxBodySize int64
 }
 
 type DatabaseConfig struct {
@@ -24,11 +32,46 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+type AssetTagConfig struct {
+	Pattern string
+}
+
+type MaintenanceConfig struct {
+	// CheckInterval is how often due maintenance schedules are turned into tickets
+	CheckInterval time.Duration
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long the response to a request with an Idempotency-Key is kept for replay
+	TTL time.Duration
+	// LockTimeout is how long a request with an Idempotency-Key holds the key
+	// while being processed, before a retry may take over
+	LockTimeout time.Duration
+}
+
+type ValidationConfig struct {
+	// Responses enables checking responses against the OpenAPI contract, which
+	// turns contract violations into 500 errors
+	Responses bool
+}
+
+type EventsConfig struct {
+	// ReplaySize is the number of recent device events kept for clients resuming a stream
+	ReplaySize int
+	// HeartbeatInterval is how often idle event streams send a heartbeat
+	HeartbeatInterval time.Duration
+	// Listen streams the device changes announced through Postgres
+	// notifications, which include those made by other instances, instead of
+	// only the changes made through this instance
+	Listen bool
+}
+
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:        getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:        getEnv("SERVER_PORT", "8080"),
+			MaxBodySize: int64(getEnvAsInt("SERVER_MAX_BODY_SIZE", 1<<20)),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -38,6 +81,24 @@ func Load() *Config {
 			DBName:   getEnv("DB_NAME", "deviceapi"),
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
 		},
+		AssetTag: AssetTagConfig{
+			Pattern: getEnv("ASSET_TAG_PATTERN", "DEV-######"),
+		},
+		Maintenance: MaintenanceConfig{
+			CheckInterval: getEnvAsDuration("MAINTENANCE_CHECK_INTERVAL", time.Hour),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:         getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+			LockTimeout: getEnvAsDuration("IDEMPOTENCY_LOCK_TIMEOUT", time.Minute),
+		},
+		Validation: ValidationConfig{
+			Responses: getEnvAsBool("OPENAPI_VALIDATE_RESPONSES", false),
+		},
+		Events: EventsConfig{
+			ReplaySize:        getEnvAsInt("EVENTS_REPLAY_SIZE", 1000),
+			HeartbeatInterval: getEnvAsDuration("EVENTS_HEARTBEAT_INTERVAL", 15*time.Second),
+			Listen:            getEnvAsBool("EVENTS_LISTEN", true),
+		},
 	}
 }
 
@@ -56,3 +117,21 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvAsBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return fallback
+}
+
+func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return fallback
+}
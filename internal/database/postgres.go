@@ -8,14 +8,17 @@ import (
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
-// NewPostgresConnection creates a new PostgreSQL database connection
-func NewPostgresConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
+// DSN returns the connection string for the configured database
+func DSN(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", dsn)
+// NewPostgresConnection creates a new PostgreSQL database connection
+func NewPostgresConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -31,6 +34,23 @@ func RunMigrations(db *sql.DB) error {
 	migrations := []string{
 		createDevicesTable,
 		createIndexes,
+		createLocationsTable,
+		addDeviceLocation,
+		createDeviceMovesTable,
+		addDeviceParent,
+		addDeviceIdentifiers,
+		addDeviceProcurement,
+		addMaintenanceState,
+		createMaintenanceTables,
+		createIdempotencyKeysTable,
+		createDeviceSortIndexes,
+		addDeviceSearch,
+		createDeviceSuggestIndexes,
+		createDeviceStateChangesTable,
+		createDeviceChangesTable,
+		addIdempotencyLease,
+		addMaintenanceTicketPriorState,
+		addIdempotencyToken,
 	}
 	for i, migration := range migrations {
 		if _, err := db.Exec(migration); err != nil {
@@ -55,3 +75,194 @@ CREATE INDEX IF NOT EXISTS idx_devices_brand ON devices(brand);
 CREATE INDEX IF NOT EXISTS idx_devices_state ON devices(state);
 CREATE INDEX IF NOT EXISTS idx_devices_creation_time ON devices(creation_time);
 `
+
+const createLocationsTable = `
+CREATE TABLE IF NOT EXISTS locations (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL CHECK (type IN ('site', 'building', 'room')),
+    parent_id VARCHAR(255) REFERENCES locations(id),
+    creation_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_locations_parent_id ON locations(parent_id);
+`
+
+const addDeviceLocation = `
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS location_id VARCHAR(255) REFERENCES locations(id);
+CREATE INDEX IF NOT EXISTS idx_devices_location_id ON devices(location_id);
+`
+
+const createDeviceMovesTable = `
+CREATE TABLE IF NOT EXISTS device_moves (
+    id BIGSERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    from_location_id VARCHAR(255),
+    to_location_id VARCHAR(255) NOT NULL,
+    moved_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_device_moves_device_id ON device_moves(device_id);
+`
+
+const addDeviceParent = `
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS parent_id VARCHAR(255) REFERENCES devices(id);
+CREATE INDEX IF NOT EXISTS idx_devices_parent_id ON devices(parent_id);
+`
+
+const addDeviceIdentifiers = `
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS serial_number VARCHAR(255);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS asset_tag VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_devices_brand_serial_number ON devices(brand, serial_number);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_devices_asset_tag ON devices(asset_tag);
+CREATE SEQUENCE IF NOT EXISTS device_asset_tag_seq;
+`
+
+const addDeviceProcurement = `
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS purchase_date DATE;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS purchase_cost NUMERIC(12, 2) CHECK (purchase_cost >= 0);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS vendor VARCHAR(255);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS warranty_expiry DATE;
+CREATE INDEX IF NOT EXISTS idx_devices_warranty_expiry ON devices(warranty_expiry);
+`
+
+// addMaintenanceState replaces the state check once, since replacing it locks
+// and scans the devices table
+const addMaintenanceState = `
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'devices'::regclass AND conname = 'devices_state_check'
+            AND pg_get_constraintdef(oid) LIKE '%maintenance%'
+    ) THEN
+        ALTER TABLE devices DROP CONSTRAINT IF EXISTS devices_state_check;
+        ALTER TABLE devices ADD CONSTRAINT devices_state_check
+            CHECK (state IN ('available', 'in-use', 'inactive', 'maintenance'));
+    END IF;
+END
+$$;
+`
+
+const createMaintenanceTables = `
+CREATE TABLE IF NOT EXISTS maintenance_schedules (
+    id VARCHAR(255) PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    description TEXT NOT NULL,
+    interval_days INTEGER NOT NULL CHECK (interval_days > 0),
+    next_due DATE NOT NULL,
+    creation_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_maintenance_schedules_device_id ON maintenance_schedules(device_id);
+CREATE INDEX IF NOT EXISTS idx_maintenance_schedules_next_due ON maintenance_schedules(next_due);
+
+CREATE TABLE IF NOT EXISTS maintenance_tickets (
+    id VARCHAR(255) PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    schedule_id VARCHAR(255) REFERENCES maintenance_schedules(id) ON DELETE SET NULL,
+    status VARCHAR(50) NOT NULL CHECK (status IN ('open', 'in-progress', 'closed')),
+    notes TEXT,
+    cost NUMERIC(12, 2) CHECK (cost >= 0),
+    due_date DATE,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    closed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_maintenance_tickets_device_id ON maintenance_tickets(device_id);
+CREATE INDEX IF NOT EXISTS idx_maintenance_tickets_status ON maintenance_tickets(status);
+`
+
+const createIdempotencyKeysTable = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INTEGER,
+    content_type VARCHAR(255),
+    body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+`
+
+const createDeviceSortIndexes = `
+CREATE INDEX IF NOT EXISTS idx_devices_name_id ON devices(name, id);
+CREATE INDEX IF NOT EXISTS idx_devices_creation_time_id ON devices(creation_time, id);
+`
+
+const addDeviceSearch = `
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(brand, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(serial_number, '') || ' ' || coalesce(asset_tag, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(vendor, '')), 'C')
+) STORED;
+CREATE INDEX IF NOT EXISTS idx_devices_search_vector ON devices USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_devices_brand_name_trgm ON devices USING GIN ((brand || ' ' || name) gin_trgm_ops);
+`
+
+const createDeviceSuggestIndexes = `
+CREATE INDEX IF NOT EXISTS idx_devices_lower_name_pattern ON devices(lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_devices_lower_brand_pattern ON devices(lower(brand) text_pattern_ops);
+`
+
+// createDeviceStateChangesTable starts the history of devices created before
+// it existed with their current state at the time of the migration, since
+// their earlier states are unknown
+const createDeviceStateChangesTable = `
+CREATE TABLE IF NOT EXISTS device_state_changes (
+    id BIGSERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    from_state VARCHAR(50),
+    to_state VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_device_state_changes_device_id_changed_at ON device_state_changes(device_id, changed_at);
+CREATE INDEX IF NOT EXISTS idx_device_state_changes_changed_at ON device_state_changes(changed_at);
+INSERT INTO device_state_changes (device_id, to_state, changed_at)
+SELECT id, state, NOW() FROM devices d
+WHERE NOT EXISTS (SELECT 1 FROM device_state_changes c WHERE c.device_id = d.id);
+`
+
+// createDeviceChangesTable starts the change log with the devices created
+// before it existed. The devices are copied only when the table is created, so
+// that later startups never log a device as created a second time.
+const createDeviceChangesTable = `
+DO $$
+BEGIN
+    IF to_regclass('device_changes') IS NULL THEN
+        CREATE TABLE device_changes (
+            sequence BIGSERIAL PRIMARY KEY,
+            device_id VARCHAR(255) NOT NULL,
+            type VARCHAR(20) NOT NULL CHECK (type IN ('created', 'updated', 'deleted')),
+            device JSONB NOT NULL,
+            changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+        );
+        INSERT INTO device_changes (device_id, type, device, changed_at)
+        SELECT id, 'created', jsonb_strip_nulls(jsonb_build_object(
+            'id', id, 'name', name, 'brand', brand, 'serial_number', serial_number, 'asset_tag', asset_tag,
+            'state', state, 'location_id', location_id, 'parent_id', parent_id, 'creation_time', creation_time,
+            'purchase_date', purchase_date, 'purchase_cost', purchase_cost, 'vendor', vendor,
+            'warranty_expiry', warranty_expiry
+        )), creation_time
+        FROM devices
+        ORDER BY creation_time, id;
+    END IF;
+END
+$$;
+`
+
+// addIdempotencyLease lets reservations left behind by a crashed request lapse
+// long before their key expires
+const addIdempotencyLease = `
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+`
+
+// addMaintenanceTicketPriorState remembers the state a device returns to when
+// its maintenance ends
+const addMaintenanceTicketPriorState = `
+ALTER TABLE maintenance_tickets ADD COLUMN IF NOT EXISTS prior_state VARCHAR(50);
+`
+
+// addIdempotencyToken identifies each reservation of a key, so that a request
+// whose lease lapsed cannot overwrite or release the reservation that took over
+const addIdempotencyToken = `
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS token VARCHAR(64) NOT NULL DEFAULT '';
+`
@@ -0,0 +1,185 @@
+// Package events distributes device change events to the clients streaming
+// them.
+package events
+
+import (
+	"devices-api/internal/models"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReplaySize is the number of recent events kept for resuming streams
+	DefaultReplaySize = 1000
+	// subscriptionBuffer is the number of events a subscriber can fall behind
+	// before it is dropped
+	subscriptionBuffer = 256
+)
+
+// Bus fans device events out to subscribers and keeps the most recent ones,
+// so that a client reconnecting with the ID of the last event it received can
+// catch up. Event IDs increase by one per event. They start from the time the
+// bus was created, so IDs handed out by an earlier process are recognized as
+// too old to resume from.
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []models.DeviceEvent
+	start       int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// NewBus returns a bus that keeps the last replaySize events
+func NewBus(replaySize int) *Bus {
+	if replaySize <= 0 {
+		replaySize = DefaultReplaySize
+	}
+	return &Bus{
+		nextID:      uint64(time.Now().UnixMicro()),
+		history:     make([]models.DeviceEvent, 0, replaySize),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the next ID to event and delivers it to every subscriber.
+// Subscribers that are too far behind are dropped rather than blocking the
+// publisher.
+func (b *Bus) Publish(event models.DeviceEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	event.ID = b.nextID
+	b.nextID++
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if len(b.history) < cap(b.history) {
+		b.history = append(b.history, event)
+	} else {
+		b.history[b.start] = event
+		b.start = (b.start + 1) % len(b.history)
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			sub.overflowed = true
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe starts delivering events to a new subscription. With resume set,
+// the events after lastEventID that are still kept are returned for replay;
+// ok is false when some of them have already been discarded, or lastEventID
+// was not handed out by this bus, and the client has to reload its state.
+func (b *Bus) Subscribe(lastEventID uint64, resume bool) (sub *Subscription, replay []models.DeviceEvent, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{bus: b, events: make(chan models.DeviceEvent, subscriptionBuffer)}
+	if b.closed {
+		close(sub.events)
+		return sub, nil, true
+	}
+	b.subscribers[sub] = struct{}{}
+	if !resume {
+		return sub, nil, true
+	}
+
+	if lastEventID >= b.nextID {
+		return sub, nil, false
+	}
+	if lastEventID+1 == b.nextID {
+		return sub, nil, true
+	}
+	for i := range b.history {
+		event := b.history[(b.start+i)%len(b.history)]
+		if event.ID > lastEventID {
+			replay = append(replay, event)
+		}
+	}
+	// The event right after lastEventID must still be kept
+	ok = len(replay) > 0 && replay[0].ID == lastEventID+1
+	return sub, replay, ok
+}
+
+// Reset discards the kept events and ends every subscription, for when events
+// may have been lost on the way to the bus. An event ID is skipped, so that
+// clients resuming from an earlier event are told to reload their state.
+func (b *Bus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	b.history = b.history[:0]
+	b.start = 0
+	for sub := range b.subscribers {
+		sub.lost = true
+		b.remove(sub)
+	}
+}
+
+// Close ends every subscription and stops delivering events, so that streams
+// finish when the server shuts down
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+}
+
+// remove closes a subscription's channel; the caller holds the lock
+func (b *Bus) remove(sub *Subscription) {
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	bus        *Bus
+	events     chan models.DeviceEvent
+	overflowed bool
+	lost       bool
+}
+
+// Events is closed when the subscription ends: when it is closed, when the
+// bus is closed or reset, or when the subscriber fell too far behind
+func (s *Subscription) Events() <-chan models.DeviceEvent {
+	return s.events
+}
+
+// Overflowed reports whether the subscription was ended because the
+// subscriber did not keep up. It is only meaningful once Events is closed.
+func (s *Subscription) Overflowed() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.overflowed
+}
+
+// Lost reports whether the subscription was ended because the bus was reset.
+// It is only meaningful once Events is closed.
+func (s *Subscription) Lost() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.lost
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subscribers[s]; ok {
+		s.bus.remove(s)
+	}
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// minReconnectInterval and maxReconnectInterval bound the wait before
+	// reconnecting the listener, which doubles after every failed attempt
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	// listenerPingInterval is how often an idle listener checks its connection
+	listenerPingInterval = 90 * time.Second
+)
+
+// DeviceLoader loads the devices left out of notifications that were too large
+type DeviceLoader interface {
+	GetByID(ctx context.Context, id string) (*models.Device, error)
+}
+
+// Listener publishes the device changes announced on
+// repository.DeviceChangesChannel to a bus, so that the clients of every
+// instance of the API receive the changes made through any of them. The
+// connection is re-established when it is lost; since notifications sent in
+// the meantime are lost, the bus is reset and clients reload their state.
+type Listener struct {
+	bus      *Bus
+	devices  DeviceLoader
+	listener *pq.Listener
+}
+
+// NewListener returns a listener connecting to the database at dsn
+func NewListener(dsn string, bus *Bus, devices DeviceLoader) *Listener {
+	l := &Listener{bus: bus, devices: devices}
+	l.listener = pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, l.logConnectionEvent)
+	return l
+}
+
+// Listen subscribes to the notifications, blocking until the database has
+// acknowledged it
+func (l *Listener) Listen() error {
+	if err := l.listener.Listen(repository.DeviceChangesChannel); err != nil {
+		return fmt.Errorf("failed to listen for device changes: %w", err)
+	}
+	return nil
+}
+
+// Run publishes device changes until ctx is done, then closes the connection
+func (l *Listener) Run(ctx context.Context) {
+	defer l.listener.Close()
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification, open := <-l.listener.Notify:
+			if !open {
+				return
+			}
+			if notification == nil {
+				// The connection was re-established
+				l.bus.Reset()
+				continue
+			}
+			l.publish(ctx, notification.Extra)
+		case <-ping.C:
+			// Pinging a dead connection makes the listener reconnect
+			go l.listener.Ping()
+		}
+	}
+}
+
+// publish turns a notification payload into an event on the bus
+func (l *Listener) publish(ctx context.Context, payload string) {
+	var change models.DeviceChange
+	if err := json.Unmarshal([]byte(payload), &change); err != nil {
+		log.Printf("Ignoring invalid device change notification: %v", err)
+		return
+	}
+
+	device := change.Device
+	if device == nil {
+		loaded, err := l.devices.GetByID(ctx, change.DeviceID)
+		if err != nil {
+			// The device has been deleted since, or cannot be loaded
+			loaded = &models.Device{ID: change.DeviceID}
+		}
+		device = loaded
+	}
+	l.bus.Publish(models.DeviceEvent{Type: change.Type, Device: device, Time: change.Time})
+}
+
+// logConnectionEvent logs changes of the listener's connection
+func (l *Listener) logConnectionEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		log.Printf("Lost connection for device change notifications: %v", err)
+	case pq.ListenerEventConnectionAttemptFailed:
+		log.Printf("Failed to reconnect for device change notifications: %v", err)
+	case pq.ListenerEventReconnected:
+		log.Printf("Reconnected for device change notifications; clients are told to reload")
+	}
+}
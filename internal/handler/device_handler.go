@@ -1,12 +1,19 @@
 package handler
 
 import (
+	"bytes"
 	"devices-api/internal/models"
 	"devices-api/internal/service"
 	"devices-api/internal/utils"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -14,11 +21,14 @@ import (
 // DeviceHandler handles HTTP requests for device operations
 type DeviceHandler struct {
 	deviceService service.DeviceService
+	decoder       utils.JSONDecoder
 }
 
-func NewDeviceHandler(deviceService service.DeviceService) *DeviceHandler {
+func NewDeviceHandler(deviceService service.DeviceService, opts ...Option) *DeviceHandler {
+	options := newOptions(opts)
 	return &DeviceHandler{
 		deviceService: deviceService,
+		decoder:       options.decoder,
 	}
 }
 
@@ -26,8 +36,8 @@ func NewDeviceHandler(deviceService service.DeviceService) *DeviceHandler {
 func (h *DeviceHandler) CreateDevice(w http.ResponseWriter, r *http.Request) {
 	var req service.CreateDeviceRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
 		return
 	}
 
@@ -52,7 +62,12 @@ func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	device, err := h.deviceService.GetDevice(r.Context(), id)
+	fields, ok := parseFields(w, r)
+	if !ok {
+		return
+	}
+
+	device, err := h.deviceService.GetDeviceFields(r.Context(), id, fields)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
@@ -61,66 +76,321 @@ func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) {
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get device")
 		return
 	}
-	utils.WriteJSONResponse(w, http.StatusOK, device)
+	if fields != nil {
+		utils.WriteResponse(w, r, http.StatusOK, models.SparseDevice{Device: device, Fields: fields})
+		return
+	}
+	utils.WriteResponse(w, r, http.StatusOK, device)
 }
 
-// GetAllDevices handles GET /devices
-func (h *DeviceHandler) GetAllDevices(w http.ResponseWriter, r *http.Request) {
-	// Check for query parameters
-	brand := r.URL.Query().Get("brand")
-	state := r.URL.Query().Get("state")
+// GetDeviceBySerialNumber handles GET /devices/by-serial/{brand}/{serial}
+func (h *DeviceHandler) GetDeviceBySerialNumber(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	device, err := h.deviceService.GetDeviceBySerialNumber(r.Context(), vars["brand"], vars["serial"])
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get device")
+		return
+	}
+	utils.WriteResponse(w, r, http.StatusOK, device)
+}
 
-	var devices []*models.Device
-	var err error
+// GetDeviceByAssetTag handles GET /devices/by-tag/{tag}
+func (h *DeviceHandler) GetDeviceByAssetTag(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
 
-	if brand != "" {
-		devices, err = h.deviceService.GetDevicesByBrand(r.Context(), brand)
-	} else if state != "" {
-		deviceState := models.DeviceState(state)
-		if !deviceState.IsValid() {
-			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid device state")
+	device, err := h.deviceService.GetDeviceByAssetTag(r.Context(), vars["tag"])
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
 			return
 		}
-		devices, err = h.deviceService.GetDevicesByState(r.Context(), deviceState)
-	} else {
-		devices, err = h.deviceService.GetAllDevices(r.Context())
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get device")
+		return
+	}
+	utils.WriteResponse(w, r, http.StatusOK, device)
+}
+
+// GetAllDevices handles GET /devices. The brand, state and location_id
+// filters can be combined; sort, limit and offset order and page the result.
+func (h *DeviceHandler) GetAllDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := service.ListDevicesRequest{
+		Filter: service.DeviceFilter{
+			Brand:      query.Get("brand"),
+			State:      models.DeviceState(query.Get("state")),
+			LocationID: query.Get("location_id"),
+		},
+		Sort: query.Get("sort"),
+	}
+	if req.Filter.State != "" && !req.Filter.State.IsValid() {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid device state")
+		return
+	}
+
+	for name, target := range map[string]*int{"limit": &req.Limit, "offset": &req.Offset} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid "+name+" parameter")
+				return
+			}
+			*target = parsed
+		}
+	}
+	// Leaving out the limit lists every device; an explicit limit must be positive
+	if query.Has("limit") && req.Limit == 0 {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit parameter: limit must be between 1 and %d", service.MaxListLimit))
+		return
+	}
+
+	fields, ok := parseFields(w, r)
+	if !ok {
+		return
 	}
+	req.Fields = fields
 
+	devices, err := h.deviceService.ListDevices(r.Context(), req)
 	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get devices")
 		return
 	}
-	utils.WriteJSONResponse(w, http.StatusOK, devices)
+	if fields != nil {
+		utils.WriteResponse(w, r, http.StatusOK, models.SparseDevices(devices, fields))
+		return
+	}
+	utils.WriteResponse(w, r, http.StatusOK, devices)
 }
 
-// UpdateDevice handles PUT /devices/{id} and PATCH /devices/{id}
-func (h *DeviceHandler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+// SearchDevices handles GET /devices/search
+func (h *DeviceHandler) SearchDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := service.SearchRequest{Query: query.Get("q")}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid limit parameter")
+			return
+		}
+		req.Limit = limit
+	}
+
+	results, err := h.deviceService.SearchDevices(r.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to search devices")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, results)
+}
+
+// SuggestDevices handles GET /devices/suggest
+func (h *DeviceHandler) SuggestDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := service.SuggestRequest{Field: query.Get("field"), Prefix: query.Get("prefix")}
 
-	var req service.UpdateDeviceRequest
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid limit parameter")
+			return
+		}
+		req.Limit = limit
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+	suggestions, err := h.deviceService.SuggestValues(r.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to suggest values")
 		return
 	}
+	utils.WriteJSONResponse(w, http.StatusOK, suggestions)
+}
+
+// GetDeviceStats handles GET /devices/stats
+func (h *DeviceHandler) GetDeviceStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := service.StatsRequest{Interval: models.StatsInterval(query.Get("interval"))}
+
+	if v := query.Get("from"); v != "" {
+		from, err := models.ParseDate(v)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.From = &from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := models.ParseDate(v)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.To = &to
+	}
 
-	device, err := h.deviceService.UpdateDevice(r.Context(), id, req)
+	stats, err := h.deviceService.GetDeviceStats(r.Context(), req)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get device stats")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, stats)
+}
+
+// GetChanges handles GET /changes
+func (h *DeviceHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var req service.ChangesRequest
+
+	if value := query.Get("since"); value != "" {
+		since, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || since < 0 {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid since parameter")
 			return
 		}
-		if strings.Contains(err.Error(), "cannot update") || strings.Contains(err.Error(), "validation") {
+		req.Since = since
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid limit parameter")
+			return
+		}
+		req.Limit = limit
+	}
+
+	feed, err := h.deviceService.GetChanges(r.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
 			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update device")
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get device changes")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, feed)
+}
+
+// parseFields reads the fields query parameter. It returns nil fields when the
+// parameter is absent and writes a 400 response for unknown field names.
+func parseFields(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	if !r.URL.Query().Has("fields") {
+		return nil, true
+	}
+	fields, err := models.ParseDeviceFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid fields parameter: "+err.Error())
+		return nil, false
+	}
+	return fields, true
+}
+
+// ReplaceDevice handles PUT /devices/{id}
+func (h *DeviceHandler) ReplaceDevice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req service.ReplaceDeviceRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	device, err := h.deviceService.ReplaceDevice(r.Context(), id, req)
+	if err != nil {
+		writeDeviceUpdateError(w, err)
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, device)
+}
+
+// PatchDevice handles PATCH /devices/{id}. application/merge-patch+json and
+// plain application/json bodies are merge patches; application/json-patch+json
+// bodies are JSON Patch operations.
+func (h *DeviceHandler) PatchDevice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	patchType, ok := patchTypeFromContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		w.Header().Set("Accept-Patch", string(service.MergePatch)+", "+string(service.JSONPatch))
+		utils.WriteErrorResponse(w, http.StatusUnsupportedMediaType, "Patch must be application/merge-patch+json or application/json-patch+json")
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.decoder.MaxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Patch document is too large")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Failed to read patch document")
+		return
+	}
+
+	device, err := h.deviceService.PatchDevice(r.Context(), id, patchType, patch)
+	if err != nil {
+		writeDeviceUpdateError(w, err)
 		return
 	}
 	utils.WriteJSONResponse(w, http.StatusOK, device)
 }
 
+// patchTypeFromContentType maps a PATCH request content type to a patch type
+func patchTypeFromContentType(contentType string) (service.PatchType, bool) {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "", string(service.MergePatch), "application/json":
+		return service.MergePatch, true
+	case string(service.JSONPatch):
+		return service.JSONPatch, true
+	default:
+		return "", false
+	}
+}
+
+// writeDeviceUpdateError maps an error from replacing or patching a device to a response
+func writeDeviceUpdateError(w http.ResponseWriter, err error) {
+	if strings.Contains(err.Error(), "not found") && !strings.Contains(err.Error(), "validation failed") {
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if strings.Contains(err.Error(), "test failed") {
+		utils.WriteErrorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if strings.Contains(err.Error(), "cannot update") || strings.Contains(err.Error(), "validation") {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.Contains(err.Error(), "already exists") {
+		utils.WriteErrorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update device")
+}
+
 // DeleteDevice handles DELETE /devices/{id}
 func (h *DeviceHandler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -141,3 +411,560 @@ func (h *DeviceHandler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// BatchCreateDevices handles POST /devices:batchCreate
+func (h *DeviceHandler) BatchCreateDevices(w http.ResponseWriter, r *http.Request) {
+	var req service.BatchCreateRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	result, err := h.deviceService.BatchCreateDevices(r.Context(), req)
+	writeBatchResult(w, result, err, "Failed to create devices")
+}
+
+// BatchUpdateDevices handles PATCH /devices:batchUpdate
+func (h *DeviceHandler) BatchUpdateDevices(w http.ResponseWriter, r *http.Request) {
+	var req service.BatchUpdateRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	result, err := h.deviceService.BatchUpdateDevices(r.Context(), req)
+	writeBatchResult(w, result, err, "Failed to update devices")
+}
+
+// BatchDeleteDevices handles POST /devices:batchDelete
+func (h *DeviceHandler) BatchDeleteDevices(w http.ResponseWriter, r *http.Request) {
+	var req service.BatchDeleteRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	result, err := h.deviceService.BatchDeleteDevices(r.Context(), req)
+	writeBatchResult(w, result, err, "Failed to delete devices")
+}
+
+// BulkUpdateDevices handles POST /devices:bulkUpdate
+func (h *DeviceHandler) BulkUpdateDevices(w http.ResponseWriter, r *http.Request) {
+	var req service.BulkUpdateRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	if dryRunParam := r.URL.Query().Get("dry_run"); dryRunParam != "" {
+		dryRun, err := strconv.ParseBool(dryRunParam)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid dry_run parameter")
+			return
+		}
+		req.DryRun = dryRun
+	}
+
+	result, err := h.deviceService.BulkUpdateDevices(r.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update devices")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, result)
+}
+
+// maxImportSize limits the size of an import file
+const maxImportSize = 32 << 20
+
+// ImportDevices handles POST /devices/import
+func (h *DeviceHandler) ImportDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := service.ImportRequest{
+		Format: service.ImportFormat(query.Get("format")),
+		Mode:   service.BatchMode(query.Get("mode")),
+	}
+
+	if req.Format == "" {
+		req.Format = importFormatFromContentType(r.Header.Get("Content-Type"))
+		if req.Format == "" {
+			utils.WriteErrorResponse(w, http.StatusUnsupportedMediaType, "Import must be text/csv or application/x-ndjson")
+			return
+		}
+	}
+
+	for name, target := range map[string]*bool{"dry_run": &req.DryRun, "upsert": &req.UpsertBySerial} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid "+name+" parameter")
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	result, err := h.deviceService.ImportDevices(r.Context(), http.MaxBytesReader(w, r.Body, maxImportSize), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			utils.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Import file is too large")
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to import devices")
+		return
+	}
+
+	status := http.StatusOK
+	if result.Failed > 0 && !result.DryRun {
+		status = http.StatusMultiStatus
+		if result.Mode == service.BatchAtomic {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+	utils.WriteJSONResponse(w, status, result)
+}
+
+// importFormatFromContentType maps the media type of an import to its format
+func importFormatFromContentType(contentType string) service.ImportFormat {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "text/csv":
+		return service.ImportCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return service.ImportNDJSON
+	default:
+		return ""
+	}
+}
+
+// exportFlushInterval is the number of exported devices written between flushes
+const exportFlushInterval = 100
+
+// ExportDevices handles GET /devices/export
+func (h *DeviceHandler) ExportDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := service.DeviceFilter{
+		Brand:      query.Get("brand"),
+		State:      models.DeviceState(query.Get("state")),
+		LocationID: query.Get("location_id"),
+	}
+	if filter.State != "" && !filter.State.IsValid() {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid device state")
+		return
+	}
+
+	format := query.Get("format")
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid format, expected csv or ndjson")
+		return
+	}
+
+	// Large exports outlive the server write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	written := 0
+	started := false
+
+	// start sends the headers once the export is known to have begun successfully
+	start := func() error {
+		started = true
+		filename := fmt.Sprintf("devices-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.WriteHeader(http.StatusOK)
+		if format == "csv" {
+			return csvWriter.Write(deviceCSVHeader)
+		}
+		return nil
+	}
+
+	err := h.deviceService.ExportDevices(r.Context(), filter, func(device *models.Device) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if format == "csv" {
+			err = csvWriter.Write(deviceCSVRecord(device))
+		} else {
+			err = encoder.Encode(device)
+		}
+		if err != nil {
+			return err
+		}
+
+		written++
+		if written%exportFlushInterval == 0 {
+			csvWriter.Flush()
+			_ = rc.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if started {
+			// The status is already sent, so abort the connection rather than
+			// end a truncated file cleanly
+			panic(http.ErrAbortHandler)
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to export devices")
+		return
+	}
+
+	if !started {
+		_ = start()
+	}
+	csvWriter.Flush()
+}
+
+// deviceCSVHeader names the columns written by deviceCSVRecord. The editable
+// columns match those accepted by ImportDevices.
+var deviceCSVHeader = []string{
+	"id", "name", "brand", "serial_number", "asset_tag", "state", "location_id", "parent_id", "creation_time",
+	"purchase_date", "purchase_cost", "vendor", "warranty_expiry",
+}
+
+// deviceCSVRecord formats a device as a CSV row, leaving unset fields empty
+func deviceCSVRecord(device *models.Device) []string {
+	optional := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}
+	date := func(value *models.Date) string {
+		if value == nil {
+			return ""
+		}
+		return value.String()
+	}
+
+	cost := ""
+	if device.PurchaseCost != nil {
+		cost = strconv.FormatFloat(*device.PurchaseCost, 'f', 2, 64)
+	}
+
+	return []string{
+		device.ID,
+		device.Name,
+		device.Brand,
+		device.SerialNumber,
+		device.AssetTag,
+		string(device.State),
+		optional(device.LocationID),
+		optional(device.ParentID),
+		device.CreationTime.UTC().Format(time.RFC3339),
+		date(device.PurchaseDate),
+		cost,
+		device.Vendor,
+		date(device.WarrantyExpiry),
+	}
+}
+
+// writeBatchResult responds with 200 when every item succeeded, 207 when a
+// best-effort batch partially failed and 422 when an atomic batch was rolled back
+func writeBatchResult(w http.ResponseWriter, result *service.BatchResult, err error, failureMessage string) {
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, failureMessage)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Failed > 0 {
+		status = http.StatusMultiStatus
+		if result.Mode == service.BatchAtomic {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+	utils.WriteJSONResponse(w, status, result)
+}
+
+// MoveDevice handles POST /devices/{id}/move
+func (h *DeviceHandler) MoveDevice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req service.MoveDeviceRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	move, err := h.deviceService.MoveDevice(r.Context(), id, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to move device")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, move)
+}
+
+// GetDeviceMoves handles GET /devices/{id}/moves
+func (h *DeviceHandler) GetDeviceMoves(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	moves, err := h.deviceService.GetDeviceMoves(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get device moves")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, moves)
+}
+
+// GetDeviceChildren handles GET /devices/{id}/children
+func (h *DeviceHandler) GetDeviceChildren(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	children, err := h.deviceService.GetDeviceChildren(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get child devices")
+		return
+	}
+	utils.WriteResponse(w, r, http.StatusOK, children)
+}
+
+// AttachChild handles POST /devices/{id}/children
+func (h *DeviceHandler) AttachChild(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req service.AttachChildRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	child, err := h.deviceService.AttachChild(r.Context(), id, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to attach child device")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, child)
+}
+
+// DetachChild handles DELETE /devices/{id}/children/{childId}
+func (h *DeviceHandler) DetachChild(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	childID := vars["childId"]
+
+	err := h.deviceService.DetachChild(r.Context(), id, childID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to detach child device")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeviceValuation handles GET /devices/{id}/valuation
+func (h *DeviceHandler) GetDeviceValuation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	query := r.URL.Query()
+
+	req := service.ValuationRequest{
+		Method: models.DepreciationMethod(query.Get("method")),
+	}
+	if req.Method != "" && !req.Method.IsValid() {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid depreciation method")
+		return
+	}
+	if v := query.Get("useful_life_years"); v != "" {
+		years, err := strconv.ParseFloat(v, 64)
+		if err != nil || years <= 0 {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid useful_life_years")
+			return
+		}
+		req.UsefulLifeYears = years
+	}
+	if v := query.Get("salvage_value"); v != "" {
+		salvage, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid salvage_value")
+			return
+		}
+		req.SalvageValue = salvage
+	}
+	if v := query.Get("as_of"); v != "" {
+		asOf, err := models.ParseDate(v)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.AsOf = &asOf
+	}
+
+	valuation, err := h.deviceService.GetDeviceValuation(r.Context(), id, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to calculate device valuation")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, valuation)
+}
+
+// GetExpiringWarranties handles GET /reports/warranty-expiring
+func (h *DeviceHandler) GetExpiringWarranties(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid days")
+			return
+		}
+		days = parsed
+	}
+
+	devices, err := h.deviceService.GetDevicesWithExpiringWarranty(r.Context(), days)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get devices with expiring warranty")
+		return
+	}
+	utils.WriteResponse(w, r, http.StatusOK, devices)
+}
+
+// GetUtilizationReport handles GET /reports/utilization
+func (h *DeviceHandler) GetUtilizationReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	group := query.Get("group")
+	if group != "" && group != "device" && group != "brand" {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid group, expected device or brand")
+		return
+	}
+
+	var req service.UtilizationRequest
+	if v := query.Get("from"); v != "" {
+		from, err := models.ParseDate(v)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.From = &from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := models.ParseDate(v)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.To = &to
+	}
+
+	report, err := h.deviceService.GetUtilizationReport(r.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to compute utilization report")
+		return
+	}
+	if mediaType, ok := utils.NegotiateMediaType(r.Header.Get("Accept")); !ok || mediaType != utils.MediaTypeCSV {
+		utils.WriteResponse(w, r, http.StatusOK, report)
+		return
+	}
+
+	// CSV has one row per device or brand rather than the generic encoding of the report
+	if group == "" {
+		group = "device"
+	}
+	var body bytes.Buffer
+	seconds := func(value float64) string { return strconv.FormatFloat(value, 'f', 0, 64) }
+	ratio := func(value float64) string { return strconv.FormatFloat(value, 'f', 4, 64) }
+	csvWriter := csv.NewWriter(&body)
+	if group == "brand" {
+		csvWriter.Write([]string{"brand", "devices", "tracked_seconds", "in_use_seconds", "utilization"})
+		for _, brand := range report.Brands {
+			csvWriter.Write([]string{brand.Brand, strconv.Itoa(brand.Devices), seconds(brand.TrackedSeconds), seconds(brand.InUseSeconds), ratio(brand.Utilization)})
+		}
+	} else {
+		csvWriter.Write([]string{"device_id", "name", "brand", "tracked_seconds", "in_use_seconds", "utilization"})
+		for _, device := range report.Devices {
+			csvWriter.Write([]string{device.DeviceID, device.Name, device.Brand, seconds(device.TrackedSeconds), seconds(device.InUseSeconds), ratio(device.Utilization)})
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to encode utilization report")
+		return
+	}
+
+	filename := fmt.Sprintf("utilization-%s-%s-%s.csv", group, report.From, report.To)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", utils.MediaTypeCSV+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"devices-api/internal/openapi"
+	"devices-api/internal/utils"
+	"io/fs"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetOpenAPISpec handles GET /openapi.json
+func GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapi.Spec)
+}
+
+// GetDocs handles GET /docs
+func GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapi.DocsPage)
+}
+
+// GetDocsAsset handles GET /docs/{asset}, serving the Swagger UI files the
+// docs page loads
+func GetDocsAsset(w http.ResponseWriter, r *http.Request) {
+	asset := mux.Vars(r)["asset"]
+	if _, err := fs.Stat(openapi.DocsAssets, asset); err != nil {
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Asset not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFileFS(w, r, openapi.DocsAssets, asset)
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"devices-api/internal/events"
+	"devices-api/internal/models"
+	"devices-api/internal/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultHeartbeatInterval is how often an idle event stream sends a comment
+// to keep proxies from closing it
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// DeviceEventHandler streams device changes to clients
+type DeviceEventHandler struct {
+	bus       *events.Bus
+	heartbeat time.Duration
+	// sockets tracks the open WebSocket connections for Shutdown
+	sockets sync.WaitGroup
+}
+
+func NewDeviceEventHandler(bus *events.Bus, heartbeat time.Duration) *DeviceEventHandler {
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeatInterval
+	}
+	return &DeviceEventHandler{
+		bus:       bus,
+		heartbeat: heartbeat,
+	}
+}
+
+// deviceEventFilter selects the events a client is interested in. Zero-valued
+// fields match every device.
+type deviceEventFilter struct {
+	DeviceIDs []string
+	Brand     string
+	State     models.DeviceState
+}
+
+func (f deviceEventFilter) matches(event models.DeviceEvent) bool {
+	if len(f.DeviceIDs) > 0 && !slices.Contains(f.DeviceIDs, event.Device.ID) {
+		return false
+	}
+	if f.Brand != "" && event.Device.Brand != f.Brand {
+		return false
+	}
+	if f.State != "" && event.Device.State != f.State {
+		return false
+	}
+	return true
+}
+
+// StreamEvents handles GET /devices/events. Device changes are sent as
+// Server-Sent Events named after the change type, optionally filtered by the
+// brand and state of the device. A client reconnecting with Last-Event-ID
+// receives the events it missed, or a reset event when they are no longer
+// kept and it has to reload the devices.
+func (h *DeviceEventHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := deviceEventFilter{
+		Brand: query.Get("brand"),
+		State: models.DeviceState(query.Get("state")),
+	}
+	if filter.State != "" && !filter.State.IsValid() {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid device state")
+		return
+	}
+
+	var lastEventID uint64
+	resume := false
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		lastEventID, resume = parsed, true
+	}
+
+	// The stream outlives the server's write timeout
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	sub, replay, ok := h.bus.Subscribe(lastEventID, resume)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !ok {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		if filter.matches(event) {
+			if err := writeDeviceEvent(w, event); err != nil {
+				return
+			}
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, open := <-sub.Events():
+			if !open {
+				// The server is shutting down, the client fell behind or
+				// changes were missed; it reconnects and resumes from the
+				// last event it received, or is told to reload
+				return
+			}
+			if !filter.matches(event) {
+				continue
+			}
+			if err := writeDeviceEvent(w, event); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeDeviceEvent writes event in the Server-Sent Events format
+func writeDeviceEvent(w io.Writer, event models.DeviceEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"devices-api/internal/service"
+	"devices-api/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// LocationHandler handles HTTP requests for location operations
+type LocationHandler struct {
+	locationService service.LocationService
+	decoder         utils.JSONDecoder
+}
+
+func NewLocationHandler(locationService service.LocationService, opts ...Option) *LocationHandler {
+	options := newOptions(opts)
+	return &LocationHandler{
+		locationService: locationService,
+		decoder:         options.decoder,
+	}
+}
+
+// CreateLocation handles POST /locations
+func (h *LocationHandler) CreateLocation(w http.ResponseWriter, r *http.Request) {
+	var req service.CreateLocationRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	location, err := h.locationService.CreateLocation(r.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") || strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "already exists") {
+			utils.WriteErrorResponse(w, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create location")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusCreated, location)
+}
+
+// GetLocation handles GET /locations/{id}
+func (h *LocationHandler) GetLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	location, err := h.locationService.GetLocation(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Location not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get location")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, location)
+}
+
+// GetAllLocations handles GET /locations
+func (h *LocationHandler) GetAllLocations(w http.ResponseWriter, r *http.Request) {
+	locations, err := h.locationService.GetAllLocations(r.Context())
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get locations")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, locations)
+}
+
+// GetChildLocations handles GET /locations/{id}/children
+func (h *LocationHandler) GetChildLocations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	locations, err := h.locationService.GetChildLocations(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Location not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get child locations")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, locations)
+}
+
+// UpdateLocation handles PUT /locations/{id} and PATCH /locations/{id}
+func (h *LocationHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req service.UpdateLocationRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	location, err := h.locationService.UpdateLocation(r.Context(), id, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") || strings.Contains(err.Error(), "parent location") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Location not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update location")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, location)
+}
+
+// DeleteLocation handles DELETE /locations/{id}
+func (h *LocationHandler) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := h.locationService.DeleteLocation(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Location not found")
+			return
+		}
+		if strings.Contains(err.Error(), "cannot delete") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to delete location")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
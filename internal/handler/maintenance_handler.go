@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"devices-api/internal/models"
+	"devices-api/internal/service"
+	"devices-api/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// MaintenanceHandler handles HTTP requests for maintenance tickets and schedules
+type MaintenanceHandler struct {
+	maintenanceService service.MaintenanceService
+	decoder            utils.JSONDecoder
+}
+
+func NewMaintenanceHandler(maintenanceService service.MaintenanceService, opts ...Option) *MaintenanceHandler {
+	options := newOptions(opts)
+	return &MaintenanceHandler{
+		maintenanceService: maintenanceService,
+		decoder:            options.decoder,
+	}
+}
+
+// CreateTicket handles POST /devices/{id}/maintenance/tickets
+func (h *MaintenanceHandler) CreateTicket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	var req service.CreateTicketRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	ticket, err := h.maintenanceService.CreateTicket(r.Context(), deviceID, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create maintenance ticket")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusCreated, ticket)
+}
+
+// GetDeviceTickets handles GET /devices/{id}/maintenance/tickets
+func (h *MaintenanceHandler) GetDeviceTickets(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	tickets, err := h.maintenanceService.GetDeviceTickets(r.Context(), deviceID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get maintenance tickets")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, tickets)
+}
+
+// GetTickets handles GET /maintenance/tickets
+func (h *MaintenanceHandler) GetTickets(w http.ResponseWriter, r *http.Request) {
+	status := models.MaintenanceStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.IsValid() {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid maintenance status")
+		return
+	}
+
+	tickets, err := h.maintenanceService.GetTickets(r.Context(), status)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get maintenance tickets")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, tickets)
+}
+
+// GetTicket handles GET /maintenance/tickets/{id}
+func (h *MaintenanceHandler) GetTicket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ticket, err := h.maintenanceService.GetTicket(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Maintenance ticket not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get maintenance ticket")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, ticket)
+}
+
+// UpdateTicket handles PATCH /maintenance/tickets/{id}
+func (h *MaintenanceHandler) UpdateTicket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req service.UpdateTicketRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	ticket, err := h.maintenanceService.UpdateTicket(r.Context(), id, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Maintenance ticket not found")
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update maintenance ticket")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, ticket)
+}
+
+// CreateSchedule handles POST /devices/{id}/maintenance/schedules
+func (h *MaintenanceHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	var req service.CreateScheduleRequest
+
+	if err := h.decoder.Decode(w, r, &req); err != nil {
+		utils.WriteErrorResponse(w, err.StatusCode, err.Message)
+		return
+	}
+
+	schedule, err := h.maintenanceService.CreateSchedule(r.Context(), deviceID, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		if strings.Contains(err.Error(), "validation failed") {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create maintenance schedule")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusCreated, schedule)
+}
+
+// GetDeviceSchedules handles GET /devices/{id}/maintenance/schedules
+func (h *MaintenanceHandler) GetDeviceSchedules(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	schedules, err := h.maintenanceService.GetDeviceSchedules(r.Context(), deviceID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get maintenance schedules")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, schedules)
+}
+
+// DeleteSchedule handles DELETE /maintenance/schedules/{id}
+func (h *MaintenanceHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := h.maintenanceService.DeleteSchedule(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Maintenance schedule not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to delete maintenance schedule")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunSchedules handles POST /maintenance/schedules/run
+func (h *MaintenanceHandler) RunSchedules(w http.ResponseWriter, r *http.Request) {
+	tickets, err := h.maintenanceService.GenerateDueTickets(r.Context())
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to generate due maintenance tickets")
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, tickets)
+}
@@ -0,0 +1,25 @@
+package handler
+
+import "devices-api/internal/utils"
+
+// Option configures a handler
+type Option func(*options)
+
+type options struct {
+	decoder utils.JSONDecoder
+}
+
+// WithMaxBodySize sets the largest JSON request body the handler accepts, in bytes
+func WithMaxBodySize(maxBodySize int64) Option {
+	return func(o *options) {
+		o.decoder = utils.NewJSONDecoder(maxBodySize)
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{decoder: utils.NewJSONDecoder(utils.DefaultMaxBodySize)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
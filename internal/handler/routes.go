@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// NewRouter registers the routes of the API. Every route must be described in
+// the OpenAPI document served at /api/v1/openapi.json.
+func NewRouter(
+	deviceHandler *DeviceHandler,
+	deviceEventHandler *DeviceEventHandler,
+	locationHandler *LocationHandler,
+	maintenanceHandler *MaintenanceHandler,
+) *mux.Router {
+	router := mux.NewRouter()
+
+	// API routes
+	api := router.PathPrefix("/api/v1").Subrouter()
+
+	// Device routes
+	api.HandleFunc("/devices", deviceHandler.CreateDevice).Methods("POST")
+	api.HandleFunc("/devices", deviceHandler.GetAllDevices).Methods("GET")
+	api.HandleFunc("/devices:batchCreate", deviceHandler.BatchCreateDevices).Methods("POST")
+	api.HandleFunc("/devices:batchUpdate", deviceHandler.BatchUpdateDevices).Methods("PATCH")
+	api.HandleFunc("/devices:batchDelete", deviceHandler.BatchDeleteDevices).Methods("POST")
+	api.HandleFunc("/devices:bulkUpdate", deviceHandler.BulkUpdateDevices).Methods("POST")
+	api.HandleFunc("/devices/import", deviceHandler.ImportDevices).Methods("POST")
+	api.HandleFunc("/devices/export", deviceHandler.ExportDevices).Methods("GET")
+	api.HandleFunc("/devices/search", deviceHandler.SearchDevices).Methods("GET")
+	api.HandleFunc("/devices/suggest", deviceHandler.SuggestDevices).Methods("GET")
+	api.HandleFunc("/devices/stats", deviceHandler.GetDeviceStats).Methods("GET")
+	api.HandleFunc("/devices/events", deviceEventHandler.StreamEvents).Methods("GET")
+	api.HandleFunc("/devices/ws", deviceEventHandler.ServeWebSocket).Methods("GET")
+	api.HandleFunc("/devices/by-serial/{brand}/{serial}", deviceHandler.GetDeviceBySerialNumber).Methods("GET")
+	api.HandleFunc("/devices/by-tag/{tag}", deviceHandler.GetDeviceByAssetTag).Methods("GET")
+	api.HandleFunc("/devices/{id}", deviceHandler.GetDevice).Methods("GET")
+	api.HandleFunc("/devices/{id}", deviceHandler.ReplaceDevice).Methods("PUT")
+	api.HandleFunc("/devices/{id}", deviceHandler.PatchDevice).Methods("PATCH")
+	api.HandleFunc("/devices/{id}", deviceHandler.DeleteDevice).Methods("DELETE")
+	api.HandleFunc("/devices/{id}/move", deviceHandler.MoveDevice).Methods("POST")
+	api.HandleFunc("/devices/{id}/moves", deviceHandler.GetDeviceMoves).Methods("GET")
+	api.HandleFunc("/devices/{id}/children", deviceHandler.GetDeviceChildren).Methods("GET")
+	api.HandleFunc("/devices/{id}/children", deviceHandler.AttachChild).Methods("POST")
+	api.HandleFunc("/devices/{id}/children/{childId}", deviceHandler.DetachChild).Methods("DELETE")
+	api.HandleFunc("/devices/{id}/valuation", deviceHandler.GetDeviceValuation).Methods("GET")
+
+	api.HandleFunc("/devices/{id}/maintenance/tickets", maintenanceHandler.CreateTicket).Methods("POST")
+	api.HandleFunc("/devices/{id}/maintenance/tickets", maintenanceHandler.GetDeviceTickets).Methods("GET")
+	api.HandleFunc("/devices/{id}/maintenance/schedules", maintenanceHandler.CreateSchedule).Methods("POST")
+	api.HandleFunc("/devices/{id}/maintenance/schedules", maintenanceHandler.GetDeviceSchedules).Methods("GET")
+
+	// Maintenance routes
+	api.HandleFunc("/maintenance/tickets", maintenanceHandler.GetTickets).Methods("GET")
+	api.HandleFunc("/maintenance/tickets/{id}", maintenanceHandler.GetTicket).Methods("GET")
+	api.HandleFunc("/maintenance/tickets/{id}", maintenanceHandler.UpdateTicket).Methods("PATCH")
+	api.HandleFunc("/maintenance/schedules/run", maintenanceHandler.RunSchedules).Methods("POST")
+	api.HandleFunc("/maintenance/schedules/{id}", maintenanceHandler.DeleteSchedule).Methods("DELETE")
+
+	// Report routes
+	api.HandleFunc("/reports/warranty-expiring", deviceHandler.GetExpiringWarranties).Methods("GET")
+	api.HandleFunc("/reports/utilization", deviceHandler.GetUtilizationReport).Methods("GET")
+
+	// Change feed
+	api.HandleFunc("/changes", deviceHandler.GetChanges).Methods("GET")
+
+	// Location routes
+	api.HandleFunc("/locations", locationHandler.CreateLocation).Methods("POST")
+	api.HandleFunc("/locations", locationHandler.GetAllLocations).Methods("GET")
+	api.HandleFunc("/locations/{id}", locationHandler.GetLocation).Methods("GET")
+	api.HandleFunc("/locations/{id}", locationHandler.UpdateLocation).Methods("PUT", "PATCH")
+	api.HandleFunc("/locations/{id}", locationHandler.DeleteLocation).Methods("DELETE")
+	api.HandleFunc("/locations/{id}/children", locationHandler.GetChildLocations).Methods("GET")
+
+	// Documentation routes
+	api.HandleFunc("/openapi.json", GetOpenAPISpec).Methods("GET")
+	api.HandleFunc("/docs", GetDocs).Methods("GET")
+	api.HandleFunc("/docs/{asset}", GetDocsAsset).Methods("GET")
+
+	// Health check
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}).Methods("GET")
+
+	return router
+}
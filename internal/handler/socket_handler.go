@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/utils"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// socketWriteWait is how long a client may take to accept a message
+	socketWriteWait = 10 * time.Second
+	// maxSocketMessageSize limits the messages a client can send
+	maxSocketMessageSize = 64 << 10
+	// maxSocketSubscriptions limits the subscriptions of a connection
+	maxSocketSubscriptions = 100
+)
+
+// Messages sent to WebSocket clients
+const (
+	socketSubscribed   = "subscribed"
+	socketUnsubscribed = "unsubscribed"
+	socketEvent        = "event"
+	socketError        = "error"
+)
+
+var upgrader = websocket.Upgrader{
+	// Like the rest of the API, connections are accepted from every origin
+	CheckOrigin: func(r *http.Request) bool { return true },
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		utils.WriteErrorResponse(w, status, "WebSocket upgrade failed: "+reason.Error())
+	},
+}
+
+// socketRequest is a message from a WebSocket client. A subscribe request
+// names the subscription and the devices it selects; an unsubscribe request
+// only names the subscription.
+type socketRequest struct {
+	Type      string   `json:"type"`
+	ID        string   `json:"id"`
+	DeviceIDs []string `json:"device_ids"`
+	Brand     string   `json:"brand"`
+	State     string   `json:"state"`
+}
+
+// socketMessage is a message to a WebSocket client
+type socketMessage struct {
+	Type          string              `json:"type"`
+	ID            string              `json:"id,omitempty"`
+	Subscriptions []string            `json:"subscriptions,omitempty"`
+	Event         *models.DeviceEvent `json:"event,omitempty"`
+	Message       string              `json:"message,omitempty"`
+}
+
+// ServeWebSocket handles GET /devices/ws. Clients subscribe to the changes of
+// specific devices, or of the devices matching a brand and state filter, and
+// receive every matching event once, listing the subscriptions it matched.
+//
+// Requests are read only as fast as their replies can be written, and a client
+// that falls too far behind the events is disconnected with close code 1008
+// rather than holding events back for everyone. When changes may have been
+// missed, connections are closed with 1012 and clients reload their state.
+// Once the event bus is closed, connections are closed with 1001 and Shutdown
+// waits for them.
+func (h *DeviceEventHandler) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with the error
+		return
+	}
+	h.sockets.Add(1)
+	defer h.sockets.Done()
+	defer conn.Close()
+
+	sub, _, _ := h.bus.Subscribe(0, false)
+	defer sub.Close()
+
+	socket := &deviceSocket{
+		conn:          conn,
+		requests:      make(chan []byte),
+		stop:          make(chan struct{}),
+		readerDone:    make(chan struct{}),
+		subscriptions: make(map[string]deviceEventFilter),
+	}
+	go socket.read(2 * h.heartbeat)
+	defer close(socket.stop)
+
+	ping := time.NewTicker(h.heartbeat)
+	defer ping.Stop()
+	for {
+		select {
+		case <-socket.readerDone:
+			// The client closed the connection or stopped answering pings
+			return
+		case data := <-socket.requests:
+			if err := socket.write(socket.handle(data)); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+		case event, open := <-sub.Events():
+			if !open {
+				switch {
+				case sub.Overflowed():
+					socket.close(websocket.ClosePolicyViolation, "client is not keeping up with the events")
+				case sub.Lost():
+					socket.close(websocket.CloseServiceRestart, "device changes may have been missed")
+				default:
+					socket.close(websocket.CloseGoingAway, "server is shutting down")
+				}
+				return
+			}
+			if matched := socket.matching(event); len(matched) > 0 {
+				if err := socket.write(socketMessage{Type: socketEvent, Subscriptions: matched, Event: &event}); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown waits until the WebSocket connections are closed, or ctx is done.
+// http.Server.Shutdown does not wait for them since they have been hijacked;
+// they close once the event bus is closed.
+func (h *DeviceEventHandler) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.sockets.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deviceSocket is a WebSocket connection. Its subscriptions are only used by
+// the goroutine writing to the connection, which also handles the requests
+// read from it.
+type deviceSocket struct {
+	conn          *websocket.Conn
+	requests      chan []byte
+	stop          chan struct{}
+	readerDone    chan struct{}
+	subscriptions map[string]deviceEventFilter
+}
+
+// read passes the client's messages on until the connection fails or the
+// connection is given up on. The client must answer pings within pongWait.
+func (s *deviceSocket) read(pongWait time.Duration) {
+	defer close(s.readerDone)
+	s.conn.SetReadLimit(maxSocketMessageSize)
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case s.requests <- data:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// handle applies a subscribe or unsubscribe request and returns the reply
+func (s *deviceSocket) handle(data []byte) socketMessage {
+	var req socketRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return socketMessage{Type: socketError, Message: "Invalid message: " + err.Error()}
+	}
+	if req.ID == "" {
+		return socketMessage{Type: socketError, Message: "Subscription ID is required"}
+	}
+
+	switch req.Type {
+	case "subscribe":
+		filter := deviceEventFilter{DeviceIDs: req.DeviceIDs, Brand: req.Brand, State: models.DeviceState(req.State)}
+		if filter.State != "" && !filter.State.IsValid() {
+			return socketMessage{Type: socketError, ID: req.ID, Message: "Invalid device state"}
+		}
+		if _, exists := s.subscriptions[req.ID]; !exists && len(s.subscriptions) >= maxSocketSubscriptions {
+			return socketMessage{Type: socketError, ID: req.ID, Message: "Too many subscriptions"}
+		}
+		// Subscribing again with the same ID replaces the filter
+		s.subscriptions[req.ID] = filter
+		return socketMessage{Type: socketSubscribed, ID: req.ID}
+	case "unsubscribe":
+		if _, exists := s.subscriptions[req.ID]; !exists {
+			return socketMessage{Type: socketError, ID: req.ID, Message: "Subscription not found"}
+		}
+		delete(s.subscriptions, req.ID)
+		return socketMessage{Type: socketUnsubscribed, ID: req.ID}
+	default:
+		return socketMessage{Type: socketError, ID: req.ID, Message: "Message type must be subscribe or unsubscribe"}
+	}
+}
+
+// matching returns the IDs of the subscriptions event matches, sorted
+func (s *deviceSocket) matching(event models.DeviceEvent) []string {
+	var matched []string
+	for id, filter := range s.subscriptions {
+		if filter.matches(event) {
+			matched = append(matched, id)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// write sends a message, giving up on a client that does not accept it in time
+func (s *deviceSocket) write(message socketMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return s.conn.WriteJSON(message)
+}
+
+// close starts the closing handshake and waits for the client to answer it
+func (s *deviceSocket) close(code int, text string) {
+	if err := s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(socketWriteWait)); err != nil {
+		return
+	}
+	timeout := time.NewTimer(socketWriteWait)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-s.readerDone:
+			return
+		case <-s.requests:
+			// Requests sent before the client saw the close frame are ignored
+		case <-timeout.C:
+			return
+		}
+	}
+}
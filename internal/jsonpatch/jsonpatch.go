@@ -0,0 +1,326 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is returned for malformed patches and operations that cannot be applied
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed is returned when a JSON Patch test operation does not match
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// MergePatch applies an RFC 7396 merge patch to document
+func MergePatch(document, patch []byte) ([]byte, error) {
+	var target, changes any
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(merge(target, changes))
+}
+
+// merge implements the MergePatch algorithm of RFC 7396 section 2
+func merge(target, patch any) any {
+	changes, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = make(map[string]any)
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+		object[key] = merge(object[key], value)
+	}
+	return object
+}
+
+// Apply applies the operations of an RFC 6902 JSON Patch to document. The
+// patch is atomic: if any operation fails the error is returned and no
+// result is produced.
+func Apply(document, patch []byte) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	var operations []map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: patch must be an array of operations", ErrInvalidPatch)
+	}
+
+	for i, raw := range operations {
+		var err error
+		doc, err = applyOperation(doc, raw)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func applyOperation(doc any, raw map[string]json.RawMessage) (any, error) {
+	var op string
+	if err := decodeMember(raw, "op", &op); err != nil {
+		return nil, err
+	}
+	var path string
+	if err := decodeMember(raw, "path", &path); err != nil {
+		return nil, err
+	}
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "add", "replace", "test":
+		var value any
+		if err := decodeMember(raw, "value", &value); err != nil {
+			return nil, err
+		}
+		switch op {
+		case "add":
+			return add(doc, tokens, value)
+		case "replace":
+			return replace(doc, tokens, value)
+		default:
+			current, err := get(doc, tokens)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("%w: value at %q does not match", ErrTestFailed, path)
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		return remove(doc, tokens)
+
+	case "move", "copy":
+		var from string
+		if err := decodeMember(raw, "from", &from); err != nil {
+			return nil, err
+		}
+		fromTokens, err := parsePointer(from)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, fromTokens)
+		if err != nil {
+			return nil, err
+		}
+		if op == "copy" {
+			return add(doc, tokens, deepCopy(value))
+		}
+		if path == from {
+			return doc, nil
+		}
+		if strings.HasPrefix(path, from+"/") {
+			return nil, fmt.Errorf("%w: cannot move %q into one of its children", ErrInvalidPatch, from)
+		}
+		if doc, err = remove(doc, fromTokens); err != nil {
+			return nil, err
+		}
+		return add(doc, tokens, value)
+
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op)
+	}
+}
+
+// decodeMember decodes a required member of an operation object
+func decodeMember(raw map[string]json.RawMessage, name string, target any) error {
+	value, ok := raw[name]
+	if !ok {
+		return fmt.Errorf("%w: missing %q", ErrInvalidPatch, name)
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return fmt.Errorf("%w: invalid %q", ErrInvalidPatch, name)
+	}
+	return nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		var err error
+		if doc, err = child(doc, token); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func add(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(doc, tokens, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[key] = value
+			return c, nil
+		case []any:
+			index := len(c)
+			if key != "-" {
+				var err error
+				if index, err = arrayIndex(key, len(c)+1); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[index+1:], c[index:])
+			c[index] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot add %q to a scalar", ErrInvalidPatch, key)
+		}
+	})
+}
+
+func remove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	return update(doc, tokens, func(container any, key string) (any, error) {
+		if _, err := child(container, key); err != nil {
+			return nil, err
+		}
+		switch c := container.(type) {
+		case map[string]any:
+			delete(c, key)
+			return c, nil
+		default:
+			index, _ := arrayIndex(key, len(c.([]any)))
+			return append(c.([]any)[:index], c.([]any)[index+1:]...), nil
+		}
+	})
+}
+
+func replace(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(doc, tokens, func(container any, key string) (any, error) {
+		if _, err := child(container, key); err != nil {
+			return nil, err
+		}
+		switch c := container.(type) {
+		case map[string]any:
+			c[key] = value
+			return c, nil
+		default:
+			index, _ := arrayIndex(key, len(c.([]any)))
+			c.([]any)[index] = value
+			return c, nil
+		}
+	})
+}
+
+// update applies fn to the container that holds the last token and stores the
+// possibly reallocated container back into its parent
+func update(doc any, tokens []string, fn func(container any, key string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	next, err := child(doc, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	updated, err := update(next, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := doc.(type) {
+	case map[string]any:
+		c[tokens[0]] = updated
+	case []any:
+		index, _ := arrayIndex(tokens[0], len(c))
+		c[index] = updated
+	}
+	return doc, nil
+}
+
+// child returns the member or element referenced by token
+func child(doc any, token string) (any, error) {
+	switch c := doc.(type) {
+	case map[string]any:
+		value, ok := c[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: path member %q not found", ErrInvalidPatch, token)
+		}
+		return value, nil
+	case []any:
+		index, err := arrayIndex(token, len(c))
+		if err != nil {
+			return nil, err
+		}
+		return c[index], nil
+	default:
+		return nil, fmt.Errorf("%w: cannot reference %q in a scalar", ErrInvalidPatch, token)
+	}
+}
+
+// arrayIndex parses an array index token that must be below limit
+func arrayIndex(token string, limit int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	if index >= limit {
+		return 0, fmt.Errorf("%w: array index %d out of range", ErrInvalidPatch, index)
+	}
+	return index, nil
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
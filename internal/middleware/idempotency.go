@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"devices-api/internal/utils"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header that makes a POST request idempotent
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a previous request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength matches the key column of the idempotency_keys table
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize limits the request bodies that are buffered for hashing
+	maxIdempotentBodySize = 32 << 20
+)
+
+// idempotencyRecorder passes the response through to the client and keeps a copy
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// WriteHeader captures the status code
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+	if rec.statusCode == 0 {
+		rec.statusCode = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write captures the response body
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key header
+// safe to retry. The first request with a key is processed and its response
+// stored for ttl; retries with the same method, path and body receive the
+// stored response. Reusing a key for a different request is rejected with
+// 422, and a retry that arrives while the first request is still being
+// processed is rejected with 409. Server errors are not stored, so the
+// request can be retried with the same key. A request that has not completed
+// within lockTimeout, because the process handling it died or is too slow, no
+// longer holds the key, and a retry is processed instead; the late request's
+// response is then not stored.
+func IdempotencyMiddleware(repo repository.IdempotencyRepository, ttl, lockTimeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				utils.WriteErrorResponse(w, http.StatusBadRequest, "Idempotency-Key cannot be longer than "+strconv.Itoa(maxIdempotencyKeyLength)+" characters")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+			if err != nil {
+				utils.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			token := uuid.New().String()
+			existing, err := repo.Reserve(r.Context(), &models.IdempotencyRecord{
+				Key:         key,
+				RequestHash: requestHash(r, body),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(ttl),
+				LockedUntil: now.Add(lockTimeout),
+				Token:       token,
+			})
+			if err != nil {
+				log.Printf("Failed to reserve idempotency key: %v", err)
+				utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to process Idempotency-Key")
+				return
+			}
+			if existing != nil {
+				replay(w, r, existing, body)
+				return
+			}
+
+			rec := &idempotencyRecorder{ResponseWriter: w}
+			defer func() {
+				// Store the outcome even if the client has gone away
+				ctx := context.WithoutCancel(r.Context())
+				if rec.statusCode == 0 || rec.statusCode >= http.StatusInternalServerError {
+					if err := repo.Release(ctx, key, token); err != nil {
+						log.Printf("Failed to release idempotency key: %v", err)
+					}
+					return
+				}
+				err := repo.Complete(ctx, key, token, rec.statusCode, rec.Header().Get("Content-Type"), rec.body.Bytes())
+				if errors.Is(err, repository.ErrReservationLost) {
+					log.Printf("Idempotency key %q was taken over before its request completed", key)
+				} else if err != nil {
+					log.Printf("Failed to store idempotent response: %v", err)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// replay answers a request whose key is already in use
+func replay(w http.ResponseWriter, r *http.Request, record *models.IdempotencyRecord, body []byte) {
+	if record.RequestHash != requestHash(r, body) {
+		utils.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Idempotency-Key has already been used for a different request")
+		return
+	}
+	if !record.Completed() {
+		utils.WriteErrorResponse(w, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// requestHash identifies a request by its method, path, query and body
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
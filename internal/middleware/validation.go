@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"devices-api/internal/openapi"
+	"devices-api/internal/utils"
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+// validationRecorder holds back a JSON response until it has been checked
+// against the contract. Other responses, such as CSV exports and event
+// streams, are passed through as they are written, and connections taken
+// over by WebSocket handlers are left alone.
+type validationRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	passThrough bool
+	hijacked    bool
+	body        bytes.Buffer
+}
+
+// WriteHeader captures the status code and decides whether the response is buffered
+func (rec *validationRecorder) WriteHeader(code int) {
+	if rec.statusCode != 0 {
+		return
+	}
+	rec.statusCode = code
+	if !openapi.IsJSON(rec.Header().Get("Content-Type")) {
+		rec.passThrough = true
+		rec.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// Write buffers a JSON response body
+func (rec *validationRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.passThrough {
+		return rec.ResponseWriter.Write(b)
+	}
+	return rec.body.Write(b)
+}
+
+// Flush flushes responses that are passed through; buffered responses are
+// sent once they have been validated
+func (rec *validationRecorder) Flush() {
+	if rec.passThrough {
+		http.NewResponseController(rec.ResponseWriter).Flush()
+	}
+}
+
+// Hijack lets WebSocket handlers take over the connection
+func (rec *validationRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil {
+		rec.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *validationRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// ValidationMiddleware checks requests to operations of the contract before
+// they reach the handlers. Query parameters and JSON bodies that do not match
+// the contract, including unknown parameters and properties, are rejected with
+// 400, and bodies of undocumented media types with 415. JSON bodies larger
+// than maxBodySize are rejected with 413 before being validated, and
+// malformed ones with the same errors as the handlers' strict decoding.
+// Requests to paths the contract does not describe are passed through.
+//
+// With validateResponses, JSON responses are checked as well, and a response
+// that does not match the contract is replaced by a 500 error, so handlers
+// drifting from the documented contract are noticed in tests and staging.
+// Other responses are passed through and violations only logged.
+func ValidationMiddleware(contract *openapi.Contract, validateResponses bool, maxBodySize int64) func(http.Handler) http.Handler {
+	decoder := utils.NewJSONDecoder(maxBodySize)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			op, ok := contract.Operation(r.Method, r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			contentType := r.Header.Get("Content-Type")
+			if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+				if !op.AcceptsMediaType(contentType) {
+					utils.WriteErrorResponse(w, http.StatusUnsupportedMediaType, "Content-Type "+contentType+" is not supported")
+					return
+				}
+				if contentType == "" || openapi.IsJSON(contentType) {
+					var bodyErr *utils.BodyError
+					body, bodyErr = decoder.ReadJSON(w, r)
+					if bodyErr != nil {
+						utils.WriteErrorResponse(w, bodyErr.StatusCode, bodyErr.Message)
+						return
+					}
+					r.Body = io.NopCloser(bytes.NewReader(body))
+				}
+			}
+			if err := op.ValidateRequest(r, body); err != nil {
+				utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+				return
+			}
+
+			if !validateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &validationRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.hijacked {
+				return
+			}
+			if rec.statusCode == 0 {
+				rec.WriteHeader(http.StatusOK)
+			}
+
+			err := op.ValidateResponse(rec.statusCode, rec.Header().Get("Content-Type"), rec.body.Bytes())
+			if rec.passThrough {
+				if err != nil {
+					log.Printf("Response to %s %s does not match the API contract: %v", r.Method, r.URL.Path, err)
+				}
+				return
+			}
+			if err != nil {
+				log.Printf("Response to %s %s does not match the API contract: %v", r.Method, r.URL.Path, err)
+				utils.WriteErrorResponse(w, http.StatusInternalServerError, "Response does not match the API contract: "+err.Error())
+				return
+			}
+			w.WriteHeader(rec.statusCode)
+			w.Write(rec.body.Bytes())
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FormatAssetTag renders an asset tag from a pattern and a sequence number.
+// The pattern must contain a single run of '#' characters, which is replaced
+// by the zero-padded sequence, e.g. "LAB-######" and 123 give "LAB-000123".
+func FormatAssetTag(pattern string, seq int64) (string, error) {
+	start := strings.IndexByte(pattern, '#')
+	if start < 0 {
+		return "", errors.New("asset tag pattern must contain a '#' placeholder")
+	}
+	end := start
+	for end < len(pattern) && pattern[end] == '#' {
+		end++
+	}
+	if strings.IndexByte(pattern[end:], '#') >= 0 {
+		return "", errors.New("asset tag pattern must contain a single '#' placeholder")
+	}
+	if seq < 0 {
+		return "", errors.New("asset tag sequence cannot be negative")
+	}
+	return pattern[:start] + fmt.Sprintf("%0*d", end-start, seq) + pattern[end:], nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// DateLayout is the wire format of a Date
+const DateLayout = "2006-01-02"
+
+// Date is a calendar date without a time of day, encoded as YYYY-MM-DD
+type Date struct {
+	time.Time
+}
+
+// NewDate truncates t to midnight UTC of the same calendar day
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// Today returns the current UTC date
+func Today() Date {
+	return NewDate(time.Now())
+}
+
+// ParseDate parses a YYYY-MM-DD string
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return Date{t}, nil
+}
+
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	parsed, err := ParseDate(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// MarshalJSON overrides the promoted time.Time encoding
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON overrides the promoted time.Time decoding
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return fmt.Errorf("invalid date %s, expected a YYYY-MM-DD string", data)
+	}
+	return d.UnmarshalText(data[1 : len(data)-1])
+}
+
+// Scan implements sql.Scanner for DATE columns
+func (d *Date) Scan(value any) error {
+	t, ok := value.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Date", value)
+	}
+	*d = NewDate(t)
+	return nil
+}
+
+// Value implements driver.Valuer for DATE columns
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
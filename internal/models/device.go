@@ -11,11 +11,15 @@ const (
 	StateAvailable DeviceState = "available"
 	StateInUse     DeviceState = "in-use"
 	StateInactive  DeviceState = "inactive"
+
+	// StateMaintenance is held while a maintenance ticket is open and
+	// can only be entered or left through maintenance tickets.
+	StateMaintenance DeviceState = "maintenance"
 )
 
 func (ds DeviceState) IsValid() bool {
 	switch ds {
-	case StateAvailable, StateInUse, StateInactive:
+	case StateAvailable, StateInUse, StateInactive, StateMaintenance:
 		return true
 	default:
 		return false
@@ -26,8 +30,18 @@ type Device struct {
 	ID           string      `json:"id"`
 	Name         string      `json:"name"`
 	Brand        string      `json:"brand"`
+	SerialNumber string      `json:"serial_number,omitempty"`
+	AssetTag     string      `json:"asset_tag,omitempty"`
 	State        DeviceState `json:"state"`
+	LocationID   *string     `json:"location_id,omitempty"`
+	ParentID     *string     `json:"parent_id,omitempty"`
 	CreationTime time.Time   `json:"creation_time"`
+
+	// Procurement details
+	PurchaseDate   *Date    `json:"purchase_date,omitempty"`
+	PurchaseCost   *float64 `json:"purchase_cost,omitempty"`
+	Vendor         string   `json:"vendor,omitempty"`
+	WarrantyExpiry *Date    `json:"warranty_expiry,omitempty"`
 }
 
 func NewDevice(id, name, brand string, state DeviceState) (*Device, error) {
@@ -57,17 +71,40 @@ func (d *Device) CanUpdateNameAndBrand() bool {
 }
 
 func (d *Device) CanDelete() bool {
-	return d.State != StateInUse
+	return d.State != StateInUse && d.State != StateMaintenance
 }
 
 func (d *Device) UpdateState(newState DeviceState) error {
 	if !newState.IsValid() {
 		return errors.New("invalid device state")
 	}
+	if d.State == StateMaintenance && newState != StateMaintenance {
+		return errors.New("cannot update state while device is under maintenance")
+	}
+	if newState == StateMaintenance && d.State != StateMaintenance {
+		return errors.New("cannot update state to maintenance without a maintenance ticket")
+	}
 	d.State = newState
 	return nil
 }
 
+// EnterMaintenance takes the device out of circulation while it is serviced
+func (d *Device) EnterMaintenance() {
+	d.State = StateMaintenance
+}
+
+// ExitMaintenance returns a serviced device to the state it was in before
+// maintenance, or to the available pool when that state is unknown
+func (d *Device) ExitMaintenance(prior *DeviceState) {
+	if d.State != StateMaintenance {
+		return
+	}
+	d.State = StateAvailable
+	if prior != nil && prior.IsValid() && *prior != StateMaintenance {
+		d.State = *prior
+	}
+}
+
 func (d *Device) UpdateNameAndBrand(newName, newBrand string) error {
 	if !d.CanUpdateNameAndBrand() {
 		return errors.New("cannot update name and brand while device is in use")
@@ -82,3 +119,39 @@ func (d *Device) UpdateNameAndBrand(newName, newBrand string) error {
 	d.Brand = newBrand
 	return nil
 }
+
+// AttachTo makes the device a component of parent. Kits are a single level
+// deep, so a component cannot itself be the parent of another kit.
+func (d *Device) AttachTo(parent *Device) error {
+	if parent.ID == d.ID {
+		return errors.New("device cannot be attached to itself")
+	}
+	if parent.ParentID != nil {
+		return errors.New("cannot attach to a device that is itself a component")
+	}
+	if d.ParentID != nil {
+		return errors.New("device is already attached to a parent")
+	}
+	d.ParentID = &parent.ID
+	return nil
+}
+
+// Detach removes the device from its parent
+func (d *Device) Detach() {
+	d.ParentID = nil
+}
+
+// UpdateProcurement replaces the procurement details of the device
+func (d *Device) UpdateProcurement(purchaseDate *Date, purchaseCost *float64, vendor string, warrantyExpiry *Date) error {
+	if purchaseCost != nil && *purchaseCost < 0 {
+		return errors.New("purchase cost cannot be negative")
+	}
+	if purchaseDate != nil && warrantyExpiry != nil && warrantyExpiry.Before(purchaseDate.Time) {
+		return errors.New("warranty expiry cannot be before the purchase date")
+	}
+	d.PurchaseDate = purchaseDate
+	d.PurchaseCost = purchaseCost
+	d.Vendor = vendor
+	d.WarrantyExpiry = warrantyExpiry
+	return nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// DeviceEventType is the kind of change a device event reports
+type DeviceEventType string
+
+const (
+	DeviceCreated DeviceEventType = "created"
+	DeviceUpdated DeviceEventType = "updated"
+	DeviceDeleted DeviceEventType = "deleted"
+)
+
+func (t DeviceEventType) IsValid() bool {
+	switch t {
+	case DeviceCreated, DeviceUpdated, DeviceDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeviceEvent reports a change to a device. Device is the device after the
+// change, or as it was before it was deleted.
+type DeviceEvent struct {
+	ID     uint64          `json:"id"`
+	Type   DeviceEventType `json:"type"`
+	Device *Device         `json:"device"`
+	Time   time.Time       `json:"time"`
+}
+
+// DeviceChange is an entry of the device change log. Sequence numbers
+// increase with every change, in the order the changes were committed.
+type DeviceChange struct {
+	Sequence int64           `json:"sequence"`
+	Type     DeviceEventType `json:"type"`
+	DeviceID string          `json:"device_id"`
+	// Device is the device after the change, or as it was before it was
+	// deleted. Notifications leave it out when it does not fit.
+	Device *Device   `json:"device,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// ChangeFeed is a page of the device change log. NextCursor is the sequence
+// number to continue after, and HasMore tells whether further changes are
+// already available.
+type ChangeFeed struct {
+	Changes    []*DeviceChange `json:"changes"`
+	NextCursor int64           `json:"next_cursor"`
+	HasMore    bool            `json:"has_more"`
+}
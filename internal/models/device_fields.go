@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DeviceFields lists the JSON field names of a device in representation order
+var DeviceFields = []string{
+	"id", "name", "brand", "serial_number", "asset_tag", "state", "location_id", "parent_id", "creation_time",
+	"purchase_date", "purchase_cost", "vendor", "warranty_expiry",
+}
+
+// ParseDeviceFields parses a comma-separated list of device field names.
+// Duplicates are dropped and the fields are returned in representation order.
+func ParseDeviceFields(list string) ([]string, error) {
+	requested := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isDeviceField(name) {
+			return nil, fmt.Errorf("unknown device field: %s", name)
+		}
+		requested[name] = true
+	}
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("at least one field is required")
+	}
+
+	fields := make([]string, 0, len(requested))
+	for _, name := range DeviceFields {
+		if requested[name] {
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+func isDeviceField(name string) bool {
+	for _, field := range DeviceFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SparseDevice is the representation of a device restricted to a set of
+// fields. Requested fields without a value are encoded as null.
+type SparseDevice struct {
+	Device *Device
+	Fields []string
+}
+
+func (sd SparseDevice) MarshalJSON() ([]byte, error) {
+	encoded, err := json.Marshal(sd.Device)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &values); err != nil {
+		return nil, err
+	}
+
+	var buf strings.Builder
+	buf.WriteByte('{')
+	for i, field := range sd.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, ok := values[field]
+		if !ok {
+			value = json.RawMessage("null")
+		}
+		fmt.Fprintf(&buf, "%q:%s", field, value)
+	}
+	buf.WriteByte('}')
+	return []byte(buf.String()), nil
+}
+
+// SparseDevices restricts every device to fields
+func SparseDevices(devices []*Device, fields []string) []SparseDevice {
+	sparse := make([]SparseDevice, len(devices))
+	for i, device := range devices {
+		sparse[i] = SparseDevice{Device: device, Fields: fields}
+	}
+	return sparse
+}
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// StatsInterval is the size of the buckets that device creations are counted in
+type StatsInterval string
+
+const (
+	IntervalDay   StatsInterval = "day"
+	IntervalWeek  StatsInterval = "week"
+	IntervalMonth StatsInterval = "month"
+)
+
+func (i StatsInterval) IsValid() bool {
+	switch i {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+		return true
+	default:
+		return false
+	}
+}
+
+// Truncate returns the first day of the bucket containing d. Weeks start on
+// Monday, as they do for PostgreSQL date_trunc.
+func (i StatsInterval) Truncate(d Date) Date {
+	switch i {
+	case IntervalWeek:
+		return NewDate(d.AddDate(0, 0, -(int(d.Weekday())+6)%7))
+	case IntervalMonth:
+		return Date{time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)}
+	default:
+		return d
+	}
+}
+
+// Next returns the first day of the bucket after the one starting at start
+func (i StatsInterval) Next(start Date) Date {
+	switch i {
+	case IntervalWeek:
+		return NewDate(start.AddDate(0, 0, 7))
+	case IntervalMonth:
+		return NewDate(start.AddDate(0, 1, 0))
+	default:
+		return NewDate(start.AddDate(0, 0, 1))
+	}
+}
+
+// Previous returns the first day of the bucket before the one starting at start
+func (i StatsInterval) Previous(start Date) Date {
+	switch i {
+	case IntervalWeek:
+		return NewDate(start.AddDate(0, 0, -7))
+	case IntervalMonth:
+		return NewDate(start.AddDate(0, -1, 0))
+	default:
+		return NewDate(start.AddDate(0, 0, -1))
+	}
+}
+
+// DeviceStats are device counts for fleet dashboards
+type DeviceStats struct {
+	Total        int                            `json:"total"`
+	ByState      map[DeviceState]int            `json:"by_state"`
+	ByBrand      map[string]int                 `json:"by_brand"`
+	ByBrandState map[string]map[DeviceState]int `json:"by_brand_state"`
+	Created      CreationStats                  `json:"created"`
+}
+
+// CreationStats counts the devices created in each bucket between From and
+// To, inclusive. Buckets without creations have a zero count.
+type CreationStats struct {
+	Interval StatsInterval    `json:"interval"`
+	From     Date             `json:"from"`
+	To       Date             `json:"to"`
+	Buckets  []CreationBucket `json:"buckets"`
+}
+
+// CreationBucket is the number of devices created in the bucket starting on Start
+type CreationBucket struct {
+	Start Date `json:"start"`
+	Count int  `json:"count"`
+}
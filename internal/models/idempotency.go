@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key so that
+// retries receive the original response instead of repeating the request
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+
+	// StatusCode is zero while the original request is still being processed
+	StatusCode  int
+	ContentType string
+	Body        []byte
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// LockedUntil ends the reservation of a request that is still being
+	// processed, so that a retry can take over the key if the process
+	// handling it has died
+	LockedUntil time.Time
+	// Token identifies the reservation, so that a request whose reservation
+	// was taken over can no longer store or release the key
+	Token string
+}
+
+// Completed reports whether the response of the original request has been stored
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type LocationType string
+
+const (
+	LocationSite     LocationType = "site"
+	LocationBuilding LocationType = "building"
+	LocationRoom     LocationType = "room"
+)
+
+func (lt LocationType) IsValid() bool {
+	switch lt {
+	case LocationSite, LocationBuilding, LocationRoom:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParentType returns the type a location of this type must be nested under.
+// Sites are roots of the tree and have no parent type.
+func (lt LocationType) ParentType() (LocationType, bool) {
+	switch lt {
+	case LocationBuilding:
+		return LocationSite, true
+	case LocationRoom:
+		return LocationBuilding, true
+	default:
+		return "", false
+	}
+}
+
+type Location struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Type         LocationType `json:"type"`
+	ParentID     *string      `json:"parent_id,omitempty"`
+	CreationTime time.Time    `json:"creation_time"`
+}
+
+// DeviceMove records a device being moved from one location to another
+type DeviceMove struct {
+	DeviceID       string    `json:"device_id"`
+	FromLocationID *string   `json:"from_location_id"`
+	ToLocationID   string    `json:"to_location_id"`
+	MovedAt        time.Time `json:"moved_at"`
+}
+
+func NewLocation(id, name string, locationType LocationType, parentID *string) (*Location, error) {
+	if !locationType.IsValid() {
+		return nil, errors.New("invalid location type")
+	}
+	if id == "" {
+		return nil, errors.New("id cannot be empty")
+	}
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+	_, needsParent := locationType.ParentType()
+	if needsParent && parentID == nil {
+		return nil, errors.New("parent location is required")
+	}
+	if !needsParent && parentID != nil {
+		return nil, errors.New("site cannot have a parent location")
+	}
+	return &Location{
+		ID:           id,
+		Name:         name,
+		Type:         locationType,
+		ParentID:     parentID,
+		CreationTime: time.Now(),
+	}, nil
+}
+
+// CanBeChildOf reports whether this location may be nested under parent
+func (l *Location) CanBeChildOf(parent *Location) bool {
+	parentType, ok := l.Type.ParentType()
+	return ok && parent.Type == parentType
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type MaintenanceStatus string
+
+const (
+	MaintenanceOpen       MaintenanceStatus = "open"
+	MaintenanceInProgress MaintenanceStatus = "in-progress"
+	MaintenanceClosed     MaintenanceStatus = "closed"
+)
+
+func (ms MaintenanceStatus) IsValid() bool {
+	switch ms {
+	case MaintenanceOpen, MaintenanceInProgress, MaintenanceClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsActive reports whether a ticket in this status keeps its device in maintenance
+func (ms MaintenanceStatus) IsActive() bool {
+	return ms == MaintenanceOpen || ms == MaintenanceInProgress
+}
+
+type MaintenanceTicket struct {
+	ID         string            `json:"id"`
+	DeviceID   string            `json:"device_id"`
+	ScheduleID *string           `json:"schedule_id,omitempty"`
+	Status     MaintenanceStatus `json:"status"`
+	Notes      string            `json:"notes,omitempty"`
+	Cost       *float64          `json:"cost,omitempty"`
+	DueDate    *Date             `json:"due_date,omitempty"`
+	OpenedAt   time.Time         `json:"opened_at"`
+	ClosedAt   *time.Time        `json:"closed_at,omitempty"`
+	// PriorState is the state the device was in when the ticket took it into
+	// maintenance; it is unset when the device was already under maintenance
+	PriorState *DeviceState `json:"prior_state,omitempty"`
+}
+
+func NewMaintenanceTicket(id, deviceID, notes string, dueDate *Date) (*MaintenanceTicket, error) {
+	if id == "" {
+		return nil, errors.New("id cannot be empty")
+	}
+	if deviceID == "" {
+		return nil, errors.New("device id cannot be empty")
+	}
+	return &MaintenanceTicket{
+		ID:       id,
+		DeviceID: deviceID,
+		Status:   MaintenanceOpen,
+		Notes:    notes,
+		DueDate:  dueDate,
+		OpenedAt: time.Now(),
+	}, nil
+}
+
+func (t *MaintenanceTicket) UpdateStatus(newStatus MaintenanceStatus) error {
+	if !newStatus.IsValid() {
+		return errors.New("invalid maintenance status")
+	}
+	if t.Status == MaintenanceClosed && newStatus != MaintenanceClosed {
+		return errors.New("cannot reopen a closed maintenance ticket")
+	}
+	if newStatus == MaintenanceClosed && t.Status != MaintenanceClosed {
+		now := time.Now()
+		t.ClosedAt = &now
+	}
+	t.Status = newStatus
+	return nil
+}
+
+func (t *MaintenanceTicket) UpdateCost(cost float64) error {
+	if cost < 0 {
+		return errors.New("cost cannot be negative")
+	}
+	t.Cost = &cost
+	return nil
+}
+
+// MaintenanceSchedule produces a ticket for its device every IntervalDays
+type MaintenanceSchedule struct {
+	ID           string    `json:"id"`
+	DeviceID     string    `json:"device_id"`
+	Description  string    `json:"description"`
+	IntervalDays int       `json:"interval_days"`
+	NextDue      Date      `json:"next_due"`
+	CreationTime time.Time `json:"creation_time"`
+}
+
+func NewMaintenanceSchedule(id, deviceID, description string, intervalDays int, firstDue Date) (*MaintenanceSchedule, error) {
+	if id == "" {
+		return nil, errors.New("id cannot be empty")
+	}
+	if deviceID == "" {
+		return nil, errors.New("device id cannot be empty")
+	}
+	if description == "" {
+		return nil, errors.New("description cannot be empty")
+	}
+	if intervalDays <= 0 {
+		return nil, errors.New("interval must be at least one day")
+	}
+	return &MaintenanceSchedule{
+		ID:           id,
+		DeviceID:     deviceID,
+		Description:  description,
+		IntervalDays: intervalDays,
+		NextDue:      firstDue,
+		CreationTime: time.Now(),
+	}, nil
+}
+
+func (s *MaintenanceSchedule) IsDue(today Date) bool {
+	return !s.NextDue.After(today.Time)
+}
+
+// Advance moves NextDue forward by whole intervals until it lies after today,
+// so a schedule that was missed for several periods produces a single ticket.
+func (s *MaintenanceSchedule) Advance(today Date) {
+	for s.IsDue(today) {
+		s.NextDue = NewDate(s.NextDue.AddDate(0, 0, s.IntervalDays))
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// StateChange records a device entering a state. FromState is nil for the
+// state a device was created in.
+type StateChange struct {
+	DeviceID  string       `json:"device_id"`
+	FromState *DeviceState `json:"from_state"`
+	ToState   DeviceState  `json:"to_state"`
+	ChangedAt time.Time    `json:"changed_at"`
+}
+
+// UtilizationReport is the share of time devices spent in use between From
+// and To, inclusive
+type UtilizationReport struct {
+	From    Date                `json:"from"`
+	To      Date                `json:"to"`
+	Devices []DeviceUtilization `json:"devices"`
+	Brands  []BrandUtilization  `json:"brands"`
+}
+
+// DeviceUtilization is the time a device existed during a report period and
+// the part of it spent in use
+type DeviceUtilization struct {
+	DeviceID       string  `json:"device_id"`
+	Name           string  `json:"name"`
+	Brand          string  `json:"brand"`
+	TrackedSeconds float64 `json:"tracked_seconds"`
+	InUseSeconds   float64 `json:"in_use_seconds"`
+	Utilization    float64 `json:"utilization"`
+}
+
+// BrandUtilization adds up the utilization of the devices of a brand
+type BrandUtilization struct {
+	Brand          string  `json:"brand"`
+	Devices        int     `json:"devices"`
+	TrackedSeconds float64 `json:"tracked_seconds"`
+	InUseSeconds   float64 `json:"in_use_seconds"`
+	Utilization    float64 `json:"utilization"`
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"errors"
+	"math"
+)
+
+type DepreciationMethod string
+
+const (
+	DepreciationStraightLine     DepreciationMethod = "straight-line"
+	DepreciationDecliningBalance DepreciationMethod = "declining-balance"
+)
+
+func (dm DepreciationMethod) IsValid() bool {
+	switch dm {
+	case DepreciationStraightLine, DepreciationDecliningBalance:
+		return true
+	default:
+		return false
+	}
+}
+
+// Valuation is the book value of a device on a given date
+type Valuation struct {
+	DeviceID                string             `json:"device_id"`
+	Method                  DepreciationMethod `json:"method"`
+	PurchaseDate            Date               `json:"purchase_date"`
+	PurchaseCost            float64            `json:"purchase_cost"`
+	SalvageValue            float64            `json:"salvage_value"`
+	UsefulLifeYears         float64            `json:"useful_life_years"`
+	AsOf                    Date               `json:"as_of"`
+	AgeYears                float64            `json:"age_years"`
+	AccumulatedDepreciation float64            `json:"accumulated_depreciation"`
+	BookValue               float64            `json:"book_value"`
+}
+
+// DepreciationParams are the inputs of a depreciation calculation
+type DepreciationParams struct {
+	Method          DepreciationMethod
+	PurchaseDate    Date
+	PurchaseCost    float64
+	SalvageValue    float64
+	UsefulLifeYears float64
+	AsOf            Date
+}
+
+// CalculateValuation computes the book value of an asset.
+//
+// Straight-line spreads (cost - salvage) evenly over the useful life.
+// Declining-balance follows the double-declining balance schedule: each year
+// depreciates 2/life of the value at its start, switching to straight-line
+// over the remaining life once that depreciates more. Ages are counted in
+// calendar years, and a year in progress is depreciated pro rata. Both never
+// go below the salvage value.
+func CalculateValuation(p DepreciationParams) (*Valuation, error) {
+	if !p.Method.IsValid() {
+		return nil, errors.New("invalid depreciation method")
+	}
+	if p.PurchaseCost < 0 {
+		return nil, errors.New("purchase cost cannot be negative")
+	}
+	if p.SalvageValue < 0 || p.SalvageValue > p.PurchaseCost {
+		return nil, errors.New("salvage value must be between zero and the purchase cost")
+	}
+	if p.UsefulLifeYears <= 0 {
+		return nil, errors.New("useful life must be positive")
+	}
+	if p.AsOf.Before(p.PurchaseDate.Time) {
+		return nil, errors.New("valuation date cannot be before the purchase date")
+	}
+
+	age := yearsBetween(p.PurchaseDate, p.AsOf)
+
+	var bookValue float64
+	switch p.Method {
+	case DepreciationStraightLine:
+		annual := (p.PurchaseCost - p.SalvageValue) / p.UsefulLifeYears
+		bookValue = p.PurchaseCost - annual*age
+	case DepreciationDecliningBalance:
+		bookValue = decliningBalance(p, age)
+	}
+	bookValue = math.Max(bookValue, p.SalvageValue)
+
+	return &Valuation{
+		Method:                  p.Method,
+		PurchaseDate:            p.PurchaseDate,
+		PurchaseCost:            p.PurchaseCost,
+		SalvageValue:            p.SalvageValue,
+		UsefulLifeYears:         p.UsefulLifeYears,
+		AsOf:                    p.AsOf,
+		AgeYears:                roundCents(age),
+		AccumulatedDepreciation: roundCents(p.PurchaseCost - bookValue),
+		BookValue:               roundCents(bookValue),
+	}, nil
+}
+
+// decliningBalance returns the double-declining balance value after age years
+func decliningBalance(p DepreciationParams, age float64) float64 {
+	rate := 2 / p.UsefulLifeYears
+	value := p.PurchaseCost
+	for year := 0.0; year < age && value > p.SalvageValue; year++ {
+		depreciation := value * rate
+		if remaining := p.UsefulLifeYears - year; remaining > 0 {
+			depreciation = math.Max(depreciation, (value-p.SalvageValue)/remaining)
+		}
+		depreciation = math.Min(depreciation, value-p.SalvageValue)
+		value -= depreciation * math.Min(age-year, 1)
+	}
+	return value
+}
+
+// yearsBetween counts the calendar years from one date to a later one, with
+// the year in progress as the fraction of its days that have passed
+func yearsBetween(from, to Date) float64 {
+	years := to.Year() - from.Year()
+	if from.AddDate(years, 0, 0).After(to.Time) {
+		years--
+	}
+	start := from.AddDate(years, 0, 0)
+	end := from.AddDate(years+1, 0, 0)
+	return float64(years) + to.Sub(start).Hours()/end.Sub(start).Hours()
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,328 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ValidationError lists the ways a request or response violates the contract
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Contract matches requests to the operations of an OpenAPI document
+type Contract struct {
+	document map[string]any
+	paths    []pathTemplate
+}
+
+type pathTemplate struct {
+	template string
+	segments []string
+	item     map[string]any
+}
+
+// Operation is an operation of the contract
+type Operation struct {
+	contract *Contract
+	spec     map[string]any
+	// parameters holds the operation's parameters by location and name
+	parameters map[string]map[string]map[string]any
+}
+
+// Load parses an OpenAPI document
+func Load(spec []byte) (*Contract, error) {
+	var document map[string]any
+	if err := json.Unmarshal(spec, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	paths, ok := document["paths"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("OpenAPI document has no paths")
+	}
+
+	contract := &Contract{document: document}
+	for template, item := range paths {
+		item, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid OpenAPI path item %s", template)
+		}
+		contract.paths = append(contract.paths, pathTemplate{
+			template: template,
+			segments: strings.Split(template, "/"),
+			item:     item,
+		})
+	}
+	return contract, nil
+}
+
+// Operation finds the operation for a request method and path. Literal path
+// segments take precedence over parameters, so /devices/search is not matched
+// as /devices/{id}.
+func (c *Contract) Operation(method, path string) (*Operation, bool) {
+	segments := strings.Split(path, "/")
+
+	var best *pathTemplate
+	bestLiterals := -1
+	for i := range c.paths {
+		candidate := &c.paths[i]
+		if literals, ok := candidate.match(segments); ok && literals > bestLiterals {
+			best, bestLiterals = candidate, literals
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	spec, ok := best.item[strings.ToLower(method)].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	op := &Operation{contract: c, spec: spec, parameters: make(map[string]map[string]map[string]any)}
+	for _, list := range [][]any{asSlice(best.item["parameters"]), asSlice(spec["parameters"])} {
+		for _, parameter := range list {
+			parameter, ok := c.resolve(parameter).(map[string]any)
+			if !ok {
+				continue
+			}
+			in, _ := parameter["in"].(string)
+			name, _ := parameter["name"].(string)
+			if op.parameters[in] == nil {
+				op.parameters[in] = make(map[string]map[string]any)
+			}
+			if in == "header" {
+				name = http.CanonicalHeaderKey(name)
+			}
+			op.parameters[in][name] = parameter
+		}
+	}
+	return op, true
+}
+
+// match reports whether path segments match the template and how many of the
+// template's segments are literal
+func (t *pathTemplate) match(segments []string) (int, bool) {
+	if len(segments) != len(t.segments) {
+		return 0, false
+	}
+	literals := 0
+	for i, segment := range t.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return 0, false
+			}
+			continue
+		}
+		if segment != segments[i] {
+			return 0, false
+		}
+		literals++
+	}
+	return literals, true
+}
+
+// ValidateRequest checks the query and header parameters of r and its body,
+// which the caller has read. Unknown query parameters are rejected. Only JSON
+// bodies are checked against their schema.
+func (op *Operation) ValidateRequest(r *http.Request, body []byte) error {
+	v := &schemaValidator{document: op.contract.document}
+
+	query := r.URL.Query()
+	for _, name := range slices.Sorted(maps.Keys(query)) {
+		if _, ok := op.parameters["query"][name]; !ok {
+			v.fail("query parameter "+name, "unknown parameter")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(op.parameters["query"])) {
+		op.validateParameter(v, "query parameter "+name, op.parameters["query"][name], query[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(op.parameters["header"])) {
+		op.validateParameter(v, "header "+name, op.parameters["header"][name], r.Header.Values(name))
+	}
+
+	if requestBody, ok := op.contract.resolve(op.spec["requestBody"]).(map[string]any); ok {
+		op.validateBody(v, requestBody, r.Header.Get("Content-Type"), body)
+	}
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Problems: v.errors}
+	}
+	return nil
+}
+
+// ValidateResponse checks that the status code of a response is documented
+// and that a JSON body matches its schema
+func (op *Operation) ValidateResponse(statusCode int, contentType string, body []byte) error {
+	v := &schemaValidator{document: op.contract.document}
+
+	responses, _ := op.spec["responses"].(map[string]any)
+	response, ok := responses[strconv.Itoa(statusCode)]
+	if !ok {
+		response, ok = responses["default"]
+	}
+	if !ok {
+		return &ValidationError{Problems: []string{fmt.Sprintf("status %d is not documented", statusCode)}}
+	}
+
+	if response, ok := op.contract.resolve(response).(map[string]any); ok {
+		content, _ := response["content"].(map[string]any)
+		mediaType := parseMediaType(contentType)
+		if len(content) == 0 {
+			if len(bytes.TrimSpace(body)) > 0 {
+				v.fail("response body", "must be empty")
+			}
+		} else if media, ok := content[mediaType].(map[string]any); !ok {
+			v.fail("response body", "media type %q is not documented", mediaType)
+		} else if isJSON(mediaType) {
+			validateJSON(v, "response body", media["schema"], body)
+		}
+	}
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Problems: v.errors}
+	}
+	return nil
+}
+
+func (op *Operation) validateParameter(v *schemaValidator, at string, parameter map[string]any, values []string) {
+	if len(values) == 0 {
+		if required, _ := parameter["required"].(bool); required {
+			v.fail(at, "is required")
+		}
+		return
+	}
+	if len(values) > 1 {
+		v.fail(at, "must not be repeated")
+		return
+	}
+
+	schema := v.resolve(parameter["schema"])
+	value, ok := parameterValue(schemaTypes(asMap(schema)["type"]), values[0])
+	if !ok {
+		v.fail(at, "must be of type %s", strings.Join(schemaTypes(asMap(schema)["type"]), " or "))
+		return
+	}
+	v.validate(schema, value, at)
+}
+
+// AcceptsMediaType reports whether the operation takes a request body of the
+// given content type. A missing content type is left for the handler to
+// reject or interpret.
+func (op *Operation) AcceptsMediaType(contentType string) bool {
+	requestBody, ok := op.contract.resolve(op.spec["requestBody"]).(map[string]any)
+	mediaType := parseMediaType(contentType)
+	if !ok || mediaType == "" {
+		return true
+	}
+	content, _ := requestBody["content"].(map[string]any)
+	_, ok = content[mediaType]
+	return ok
+}
+
+// validateBody checks a JSON request body. Bodies of other media types are
+// passed through unchecked.
+func (op *Operation) validateBody(v *schemaValidator, requestBody map[string]any, contentType string, body []byte) {
+	content, _ := requestBody["content"].(map[string]any)
+	mediaType := parseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	media, ok := content[mediaType].(map[string]any)
+	if !ok || !isJSON(mediaType) {
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required, _ := requestBody["required"].(bool); required {
+			v.fail("request body", "is required")
+		}
+		return
+	}
+	validateJSON(v, "request body", media["schema"], body)
+}
+
+// validateJSON decodes body, keeping numbers exact, and validates it against schema
+func validateJSON(v *schemaValidator, at string, schema any, body []byte) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		v.fail(at, "invalid JSON: %v", err)
+		return
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		v.fail(at, "must contain a single JSON value")
+		return
+	}
+	v.validate(schema, value, at)
+}
+
+// parameterValue converts a query or header value to the JSON value the schema
+// types expect
+func parameterValue(types []string, raw string) (any, bool) {
+	if len(types) == 0 {
+		return raw, true
+	}
+	for _, t := range types {
+		switch t {
+		case "string":
+			return raw, true
+		case "integer", "number":
+			if _, err := strconv.ParseFloat(raw, 64); err == nil {
+				return json.Number(raw), true
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(raw); err == nil {
+				return b, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (c *Contract) resolve(node any) any {
+	return (&schemaValidator{document: c.document}).resolve(node)
+}
+
+func parseMediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType
+}
+
+// IsJSON reports whether a content type is JSON or a JSON-based type such as
+// application/merge-patch+json
+func IsJSON(contentType string) bool {
+	return isJSON(parseMediaType(contentType))
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func asSlice(value any) []any {
+	slice, _ := value.([]any)
+	return slice
+}
+
+func asMap(value any) map[string]any {
+	m, _ := value.(map[string]any)
+	return m
+}
@@ -0,0 +1,26 @@
+// Package openapi embeds the OpenAPI document of the API and the page that
+// renders it
+package openapi
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Spec is the OpenAPI 3.1 document describing every route of the API
+//
+//go:embed openapi.json
+var Spec []byte
+
+// DocsPage renders Spec with Swagger UI, loading its assets from DocsAssets
+//
+//go:embed docs.html
+var DocsPage []byte
+
+//go:embed swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css
+var swaggerUI embed.FS
+
+// DocsAssets holds the script and stylesheet of Swagger UI 5.18.2, taken from
+// the swagger-ui-dist package (Apache License 2.0, see swagger-ui/LICENSE), so
+// that the docs page works without internet access
+var DocsAssets, _ = fs.Sub(swaggerUI, "swagger-ui")
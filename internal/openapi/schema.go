@@ -0,0 +1,274 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaValidator checks decoded JSON values against the subset of JSON Schema
+// used by the document: $ref, type, enum, const, properties, required,
+// additionalProperties, items, anyOf, oneOf, allOf, string and array lengths,
+// numeric bounds and the date and date-time formats. Numbers must be decoded
+// as json.Number.
+type schemaValidator struct {
+	document map[string]any
+	errors   []string
+}
+
+// validate records every violation of schema by value. at names the value
+// and is extended with a JSON pointer for nested values.
+func (v *schemaValidator) validate(schema any, value any, at string) {
+	s, ok := v.resolve(schema).(map[string]any)
+	if !ok {
+		// true and the empty schema accept everything
+		return
+	}
+
+	if types := schemaTypes(s["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(value, t) }) {
+		v.fail(at, "must be of type %s, got %s", strings.Join(types, " or "), jsonType(value))
+		return
+	}
+	if values, ok := s["enum"].([]any); ok && !slices.ContainsFunc(values, func(allowed any) bool { return jsonEqual(allowed, value) }) {
+		v.fail(at, "must be one of %s", formatValues(values))
+	}
+	if allowed, ok := s["const"]; ok && !jsonEqual(allowed, value) {
+		v.fail(at, "must be %s", formatValues([]any{allowed}))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		v.validateObject(s, value, at)
+	case []any:
+		v.validateLength(s, "minItems", "maxItems", len(value), at, "items")
+		if items, ok := s["items"]; ok {
+			for i, item := range value {
+				v.validate(items, item, fmt.Sprintf("%s/%d", at, i))
+			}
+		}
+	case string:
+		v.validateLength(s, "minLength", "maxLength", len([]rune(value)), at, "characters")
+		v.validateFormat(s, value, at)
+	case json.Number:
+		v.validateBounds(s, value, at)
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			v.validate(sub, value, at)
+		}
+	}
+	if options, ok := s["anyOf"].([]any); ok && v.matches(options, value, at) == 0 {
+		v.fail(at, "does not match any of the allowed schemas")
+	}
+	if options, ok := s["oneOf"].([]any); ok && v.matches(options, value, at) != 1 {
+		v.fail(at, "must match exactly one of the allowed schemas")
+	}
+}
+
+func (v *schemaValidator) validateObject(s map[string]any, value map[string]any, at string) {
+	properties, _ := s["properties"].(map[string]any)
+	if required, ok := s["required"].([]any); ok {
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				v.fail(at, "missing required property %q", name)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		at := at + "/" + escapePointer(name)
+		if property, ok := properties[name]; ok {
+			v.validate(property, value[name], at)
+			continue
+		}
+		switch additional := s["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(at, "unknown property")
+			}
+		case map[string]any:
+			v.validate(additional, value[name], at)
+		}
+	}
+}
+
+func (v *schemaValidator) validateLength(s map[string]any, minKey, maxKey string, length int, at, unit string) {
+	if limit, ok := schemaNumber(s[minKey]); ok && float64(length) < limit {
+		v.fail(at, "must have at least %v %s", limit, unit)
+	}
+	if limit, ok := schemaNumber(s[maxKey]); ok && float64(length) > limit {
+		v.fail(at, "must have at most %v %s", limit, unit)
+	}
+}
+
+func (v *schemaValidator) validateBounds(s map[string]any, value json.Number, at string) {
+	number, err := value.Float64()
+	if err != nil {
+		v.fail(at, "must be a number")
+		return
+	}
+	if limit, ok := schemaNumber(s["minimum"]); ok && number < limit {
+		v.fail(at, "must be at least %v", limit)
+	}
+	if limit, ok := schemaNumber(s["maximum"]); ok && number > limit {
+		v.fail(at, "must be at most %v", limit)
+	}
+	if limit, ok := schemaNumber(s["exclusiveMinimum"]); ok && number <= limit {
+		v.fail(at, "must be greater than %v", limit)
+	}
+	if limit, ok := schemaNumber(s["exclusiveMaximum"]); ok && number >= limit {
+		v.fail(at, "must be less than %v", limit)
+	}
+}
+
+func (v *schemaValidator) validateFormat(s map[string]any, value string, at string) {
+	var err error
+	switch s["format"] {
+	case "date":
+		_, err = time.Parse("2006-01-02", value)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339Nano, value)
+	default:
+		return
+	}
+	if err != nil {
+		v.fail(at, "must be a %s", s["format"])
+	}
+}
+
+// matches counts the schemas that value is valid against
+func (v *schemaValidator) matches(schemas []any, value any, at string) int {
+	count := 0
+	for _, schema := range schemas {
+		sub := &schemaValidator{document: v.document}
+		sub.validate(schema, value, at)
+		if len(sub.errors) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// resolve follows $ref to a schema within the document
+func (v *schemaValidator) resolve(schema any) any {
+	for {
+		s, ok := schema.(map[string]any)
+		if !ok {
+			return schema
+		}
+		ref, ok := s["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		schema = lookup(v.document, ref)
+	}
+}
+
+func (v *schemaValidator) fail(at, format string, args ...any) {
+	v.errors = append(v.errors, at+": "+fmt.Sprintf(format, args...))
+}
+
+// lookup returns the value a local reference such as
+// #/components/schemas/Device points to, or nil
+func lookup(document map[string]any, ref string) any {
+	var node any = document
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = object[strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")]
+	}
+	return node
+}
+
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// schemaTypes returns the types allowed by a type keyword, which is a single
+// type name or a list of them
+func schemaTypes(keyword any) []string {
+	switch keyword := keyword.(type) {
+	case string:
+		return []string{keyword}
+	case []any:
+		types := make([]string, 0, len(keyword))
+		for _, t := range keyword {
+			if name, ok := t.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	default:
+		return nil
+	}
+}
+
+func hasType(value any, schemaType string) bool {
+	if schemaType == "integer" {
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := number.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return jsonType(value) == schemaType
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// jsonEqual compares a schema value with a decoded value, treating numbers by value
+func jsonEqual(schemaValue, value any) bool {
+	if number, ok := value.(json.Number); ok {
+		expected, ok := schemaNumber(schemaValue)
+		actual, err := number.Float64()
+		return ok && err == nil && expected == actual
+	}
+	return reflect.DeepEqual(schemaValue, value)
+}
+
+// schemaNumber reads a numeric keyword of a schema decoded without UseNumber
+func schemaNumber(value any) (float64, bool) {
+	number, ok := value.(float64)
+	return number, ok
+}
+
+func formatValues(values []any) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		encoded, _ := json.Marshal(value)
+		formatted[i] = string(encoded)
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -3,16 +3,126 @@ package repository
 import (
 	"context"
 	"devices-api/internal/models"
+	"time"
 )
 
+// DeviceFilter selects devices by their attributes. Zero-valued fields are ignored.
+type DeviceFilter struct {
+	Brand string
+	State models.DeviceState
+	// LocationID matches devices in the location or any of its sub-locations
+	LocationID string
+
+	// AfterID and Limit page through the matches in ID order
+	AfterID string
+	Limit   int
+}
+
+// SortableDeviceFields lists the fields a device listing can be ordered by
+var SortableDeviceFields = []string{"name", "brand", "state", "creation_time"}
+
+// SuggestableDeviceFields lists the fields that value suggestions are offered for
+var SuggestableDeviceFields = []string{"name", "brand"}
+
+// ValueCount is a distinct field value and the number of devices that have it
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// DeviceCount is the number of devices of a brand in a state. An empty Brand
+// or State counts the devices of every brand or in every state.
+type DeviceCount struct {
+	Brand string
+	State models.DeviceState
+	Count int
+}
+
+// DeviceSort orders a listing by one device field
+type DeviceSort struct {
+	Field      string
+	Descending bool
+}
+
+// DeviceQuery selects, orders and pages the devices of a listing and the
+// fields loaded for each. AfterID and Limit of the filter are not used.
+type DeviceQuery struct {
+	Filter DeviceFilter
+	// Fields limits the loaded fields to the given JSON field names; empty loads all of them
+	Fields []string
+	// Sort orders the listing, newest first when empty. Ties are broken by ID
+	// so that pages are stable.
+	Sort []DeviceSort
+
+	// Limit and Offset select a page of the ordered listing; a zero Limit returns every device
+	Limit  int
+	Offset int
+}
+
 // DeviceRepository defines the interface for device data access operations
 type DeviceRepository interface {
 	Create(ctx context.Context, device *models.Device) error
 	GetByID(ctx context.Context, id string) (*models.Device, error)
+	// GetByIDForUpdate retrieves a device and, inside a transaction, locks it
+	// until the transaction ends
+	GetByIDForUpdate(ctx context.Context, id string) (*models.Device, error)
+	// GetByIDs retrieves the devices with the given IDs; IDs of devices that
+	// do not exist are skipped
+	GetByIDs(ctx context.Context, ids []string) ([]*models.Device, error)
+	// GetFieldsByID retrieves a device with only the given fields loaded
+	GetFieldsByID(ctx context.Context, id string, fields []string) (*models.Device, error)
+	GetBySerialNumber(ctx context.Context, brand, serialNumber string) (*models.Device, error)
+	GetByAssetTag(ctx context.Context, assetTag string) (*models.Device, error)
 	GetByBrand(ctx context.Context, brand string) ([]*models.Device, error)
 	GetByState(ctx context.Context, state models.DeviceState) ([]*models.Device, error)
+	GetByLocation(ctx context.Context, locationID string) ([]*models.Device, error)
+	GetByWarrantyExpiry(ctx context.Context, from, to models.Date) ([]*models.Device, error)
+	GetChildren(ctx context.Context, parentID string) ([]*models.Device, error)
 	GetAll(ctx context.Context) ([]*models.Device, error)
+	// List returns the devices matching the query in the requested order
+	List(ctx context.Context, query DeviceQuery) ([]*models.Device, error)
+	// Suggest returns up to limit distinct values of field that start with
+	// prefix, ignoring case, most frequent first
+	Suggest(ctx context.Context, field, prefix string, limit int) ([]ValueCount, error)
+	// Count returns the number of devices per state, per brand, per brand and
+	// state, and in total
+	Count(ctx context.Context) ([]DeviceCount, error)
+	// CountCreated returns the number of devices created in each interval
+	// bucket, by the bucket's first day in UTC, for devices created in
+	// [from, to). Buckets without devices are omitted.
+	CountCreated(ctx context.Context, interval models.StatsInterval, from, to time.Time) ([]models.CreationBucket, error)
+	// Find returns the devices matching filter ordered by ID. Inside a
+	// transaction the matched rows are locked until it ends.
+	Find(ctx context.Context, filter DeviceFilter) ([]*models.Device, error)
+	// Stream calls fn for each device matching filter in ID order without
+	// loading the result set into memory. Limit and AfterID are honored. The
+	// devices are not read from a single snapshot.
+	Stream(ctx context.Context, filter DeviceFilter, fn func(device *models.Device) error) error
 	Update(ctx context.Context, device *models.Device) error
 	Delete(ctx context.Context, id string) error
 	Exists(ctx context.Context, id string) (bool, error)
+	MoveToLocation(ctx context.Context, deviceID, locationID string) (*models.DeviceMove, error)
+	GetMoves(ctx context.Context, deviceID string) ([]*models.DeviceMove, error)
+	// GetStateChanges returns, per device, the last state change before from
+	// and the changes in [from, to), ordered by device and time
+	GetStateChanges(ctx context.Context, from, to time.Time) ([]*models.StateChange, error)
+	// GetChanges returns up to limit entries of the change log with a
+	// sequence number greater than since, in order
+	GetChanges(ctx context.Context, since int64, limit int) ([]*models.DeviceChange, error)
+	NextAssetTagSequence(ctx context.Context) (int64, error)
+	WithTx(ctx context.Context, fn func(repo DeviceRepository) error) error
+}
+
+// DeviceMatch is a device found by a free-text search with its relevance
+type DeviceMatch struct {
+	Device *models.Device
+	Score  float64
+}
+
+// DeviceSearcher is implemented by repositories that can rank devices for a
+// free-text query themselves. Repositories without it are searched by the
+// service.
+type DeviceSearcher interface {
+	// Search returns up to limit devices matching query, most relevant first
+	Search(ctx context.Context, query string, limit int) ([]DeviceMatch, error)
 }
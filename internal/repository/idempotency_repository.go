@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"errors"
+	"time"
+)
+
+// ErrReservationLost is returned when completing a reservation that has been
+// taken over by another request
+var ErrReservationLost = errors.New("idempotency key reservation was taken over")
+
+// IdempotencyRepository defines the interface for idempotency key storage
+type IdempotencyRepository interface {
+	// Reserve stores record unless an unexpired record with the same key
+	// exists, in which case the existing record is returned instead. The
+	// reservation of a request that has not completed by its LockedUntil time
+	// is taken over.
+	Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	// Complete stores the response of the reservation of key made with token.
+	// It returns ErrReservationLost if the reservation has been taken over.
+	Complete(ctx context.Context, key, token string, statusCode int, contentType string, body []byte) error
+	// Release removes the reservation of key made with token whose request
+	// did not complete, so it can be retried. A reservation that has been
+	// taken over is left alone.
+	Release(ctx context.Context, key, token string) error
+	// DeleteExpired removes records that expired before now and returns how many were removed
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
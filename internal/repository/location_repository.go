@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"devices-api/internal/models"
+)
+
+// LocationRepository defines the interface for location data access operations
+type LocationRepository interface {
+	Create(ctx context.Context, location *models.Location) error
+	GetByID(ctx context.Context, id string) (*models.Location, error)
+	GetAll(ctx context.Context) ([]*models.Location, error)
+	GetChildren(ctx context.Context, parentID string) ([]*models.Location, error)
+	Update(ctx context.Context, location *models.Location) error
+	Delete(ctx context.Context, id string) error
+}
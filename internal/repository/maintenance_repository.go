@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"devices-api/internal/models"
+)
+
+// MaintenanceRepository defines the interface for maintenance data access operations
+type MaintenanceRepository interface {
+	CreateTicket(ctx context.Context, ticket *models.MaintenanceTicket) error
+	GetTicketByID(ctx context.Context, id string) (*models.MaintenanceTicket, error)
+	GetAllTickets(ctx context.Context) ([]*models.MaintenanceTicket, error)
+	GetTicketsByStatus(ctx context.Context, status models.MaintenanceStatus) ([]*models.MaintenanceTicket, error)
+	GetTicketsByDevice(ctx context.Context, deviceID string) ([]*models.MaintenanceTicket, error)
+	CountActiveTickets(ctx context.Context, deviceID string) (int, error)
+	UpdateTicket(ctx context.Context, ticket *models.MaintenanceTicket) error
+
+	CreateSchedule(ctx context.Context, schedule *models.MaintenanceSchedule) error
+	GetSchedulesByDevice(ctx context.Context, deviceID string) ([]*models.MaintenanceSchedule, error)
+	GetDueSchedules(ctx context.Context, today models.Date) ([]*models.MaintenanceSchedule, error)
+	UpdateSchedule(ctx context.Context, schedule *models.MaintenanceSchedule) error
+	DeleteSchedule(ctx context.Context, id string) error
+
+	// WithTx runs fn with maintenance and device repositories bound to the same transaction
+	WithTx(ctx context.Context, fn func(repo MaintenanceRepository, deviceRepo DeviceRepository) error) error
+}
@@ -4,15 +4,39 @@ import (
 	"context"
 	"database/sql"
 	"devices-api/internal/models"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
 )
 
+// deviceColumns lists the device columns in the order expected by scanDevice
+const deviceColumns = `id, name, brand, serial_number, asset_tag, state, location_id, parent_id, creation_time,
+	purchase_date, purchase_cost, vendor, warranty_expiry`
+
+// DeviceChangesChannel is the notification channel device writes are announced
+// on, with a models.DeviceChange as payload. Notifications are sent within the
+// transaction of the write, so they are delivered once it commits and never
+// for a write that is rolled back.
+const DeviceChangesChannel = "device_changes"
+
+// maxNotificationPayload is the largest payload Postgres accepts for NOTIFY
+const maxNotificationPayload = 7999
+
+// deviceChangesLockKey is the transaction-level advisory lock held from the
+// first change log insert of a write until it commits
+const deviceChangesLockKey int64 = 0x64657663686e67 // "devchng"
+
 // PostgresDeviceRepository implements DeviceRepository using PostgreSQL
 type PostgresDeviceRepository struct {
 	db *sql.DB
+	tx *sql.Tx // set on repositories handed out by WithTx
+	// changes collects the device writes of the transaction for the change log
+	changes *[]models.DeviceChange
 }
 
 // NewPostgresDeviceRepository creates a new PostgreSQL device repository
@@ -22,89 +46,225 @@ func NewPostgresDeviceRepository(db *sql.DB) *PostgresDeviceRepository {
 	}
 }
 
-// Create inserts a new device into the database
+// Create inserts a new device into the database and starts its state history
 func (r *PostgresDeviceRepository) Create(ctx context.Context, device *models.Device) error {
+	return r.withTx(ctx, func(txRepo *PostgresDeviceRepository) error {
+		return txRepo.create(ctx, device)
+	})
+}
+
+func (r *PostgresDeviceRepository) create(ctx context.Context, device *models.Device) error {
 	query := `
-		INSERT INTO devices (id, name, brand, state, creation_time)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO devices (id, name, brand, serial_number, asset_tag, state, location_id, parent_id, creation_time,
+			purchase_date, purchase_cost, vendor, warranty_expiry)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := r.conn().ExecContext(ctx, query,
 		device.ID,
 		device.Name,
 		device.Brand,
+		device.SerialNumber,
+		device.AssetTag,
 		string(device.State),
+		device.LocationID,
+		device.ParentID,
 		device.CreationTime,
+		device.PurchaseDate,
+		device.PurchaseCost,
+		device.Vendor,
+		device.WarrantyExpiry,
 	)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return fmt.Errorf("device with ID %s already exists", device.ID)
+			return deviceConflictError(device, pqErr)
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return fmt.Errorf("referenced location or parent device not found: %s", pqErr.Detail)
 		}
 		return fmt.Errorf("failed to create device: %w", err)
 	}
+	if err := r.recordStateChange(ctx, device.ID, nil, device.State, device.CreationTime); err != nil {
+		return err
+	}
+	r.recordChange(models.DeviceCreated, device)
 	return nil
 }
 
 // GetByID retrieves a device by its ID
 func (r *PostgresDeviceRepository) GetByID(ctx context.Context, id string) (*models.Device, error) {
 	query := `
-		SELECT id, name, brand, state, creation_time
+		SELECT ` + deviceColumns + `
 		FROM devices
 		WHERE id = $1
 	`
 
-	var device models.Device
-	var stateStr string
+	device, err := scanDevice(r.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("device with ID %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to get device by ID: %w", err)
+	}
+	return device, nil
+}
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&device.ID,
-		&device.Name,
-		&device.Brand,
-		&stateStr,
-		&device.CreationTime,
-	)
+// GetByIDForUpdate retrieves a device by ID, locking it inside a transaction
+func (r *PostgresDeviceRepository) GetByIDForUpdate(ctx context.Context, id string) (*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE id = $1
+	`
+	if r.tx != nil {
+		query += ` FOR UPDATE`
+	}
+
+	device, err := scanDevice(r.conn().QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("device with ID %s not found", id)
 		}
 		return nil, fmt.Errorf("failed to get device by ID: %w", err)
 	}
-	device.State = models.DeviceState(stateStr)
-	return &device, nil
+	return device, nil
+}
+
+// GetByIDs retrieves the devices with the given IDs
+func (r *PostgresDeviceRepository) GetByIDs(ctx context.Context, ids []string) ([]*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE id = ANY($1)
+		ORDER BY id
+	`
+
+	devices, err := r.queryDevices(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices by ID: %w", err)
+	}
+	return devices, nil
+}
+
+// GetBySerialNumber retrieves a device by brand and serial number
+func (r *PostgresDeviceRepository) GetBySerialNumber(ctx context.Context, brand, serialNumber string) (*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE brand = $1 AND serial_number = $2
+	`
+
+	device, err := scanDevice(r.conn().QueryRowContext(ctx, query, brand, serialNumber))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("device with serial number %s for brand %s not found", serialNumber, brand)
+		}
+		return nil, fmt.Errorf("failed to get device by serial number: %w", err)
+	}
+	return device, nil
+}
+
+// GetByAssetTag retrieves a device by its asset tag
+func (r *PostgresDeviceRepository) GetByAssetTag(ctx context.Context, assetTag string) (*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE asset_tag = $1
+	`
+
+	device, err := scanDevice(r.conn().QueryRowContext(ctx, query, assetTag))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("device with asset tag %s not found", assetTag)
+		}
+		return nil, fmt.Errorf("failed to get device by asset tag: %w", err)
+	}
+	return device, nil
+}
+
+// GetFieldsByID retrieves a device by its ID, selecting only the columns of fields
+func (r *PostgresDeviceRepository) GetFieldsByID(ctx context.Context, id string, fields []string) (*models.Device, error) {
+	columns, err := selectColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + strings.Join(columns, ", ") + ` FROM devices WHERE id = $1`
+
+	device, err := scanDeviceFields(r.conn().QueryRowContext(ctx, query, id), columns)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("device with ID %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to get device by ID: %w", err)
+	}
+	return device, nil
+}
+
+// NextAssetTagSequence reserves the next number of the asset tag sequence
+func (r *PostgresDeviceRepository) NextAssetTagSequence(ctx context.Context) (int64, error) {
+	var seq int64
+	err := r.conn().QueryRowContext(ctx, `SELECT nextval('device_asset_tag_seq')`).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next asset tag sequence: %w", err)
+	}
+	return seq, nil
 }
 
 // GetAll retrieves all devices
 func (r *PostgresDeviceRepository) GetAll(ctx context.Context) ([]*models.Device, error) {
 	query := `
-		SELECT id, name, brand, state, creation_time
+		SELECT ` + deviceColumns + `
 		FROM devices
 		ORDER BY creation_time DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query)
+	devices, err := r.queryDevices(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all devices: %w", err)
 	}
-	defer rows.Close()
+	return devices, nil
+}
 
-	var devices []*models.Device
+// List retrieves a page of the devices matching the query in the requested
+// order, selecting only the requested columns
+func (r *PostgresDeviceRepository) List(ctx context.Context, query DeviceQuery) ([]*models.Device, error) {
+	columns, err := selectColumns(query.Fields)
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := orderByClause(query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	conditions, args := deviceFilterConditions(query.Filter)
 
+	sqlQuery := `SELECT ` + strings.Join(columns, ", ") + ` FROM devices`
+	if len(conditions) > 0 {
+		sqlQuery += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	sqlQuery += ` ORDER BY ` + orderBy
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		sqlQuery += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if query.Offset > 0 {
+		args = append(args, query.Offset)
+		sqlQuery += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+
+	rows, err := r.conn().QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []*models.Device{}
 	for rows.Next() {
-		var device models.Device
-		var stateStr string
-
-		err := rows.Scan(
-			&device.ID,
-			&device.Name,
-			&device.Brand,
-			&stateStr,
-			&device.CreationTime,
-		)
+		device, err := scanDeviceFields(rows, columns)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan device: %w", err)
 		}
-		device.State = models.DeviceState(stateStr)
-		devices = append(devices, &device)
+		devices = append(devices, device)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over devices: %w", err)
@@ -112,132 +272,387 @@ func (r *PostgresDeviceRepository) GetAll(ctx context.Context) ([]*models.Device
 	return devices, nil
 }
 
-// GetByBrand retrieves devices by brand
-func (r *PostgresDeviceRepository) GetByBrand(ctx context.Context, brand string) ([]*models.Device, error) {
+// likeEscaper escapes the LIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest counts the distinct values of field starting with prefix. The
+// lower(field) LIKE 'prefix%' condition is served by the text_pattern_ops
+// expression indexes on name and brand.
+func (r *PostgresDeviceRepository) Suggest(ctx context.Context, field, prefix string, limit int) ([]ValueCount, error) {
+	if !slices.Contains(SuggestableDeviceFields, field) {
+		return nil, fmt.Errorf("cannot suggest values for %s", field)
+	}
+
 	query := `
-		SELECT id, name, brand, state, creation_time
+		SELECT ` + field + `, COUNT(*) AS count
 		FROM devices
-		WHERE brand = $1
-		ORDER BY creation_time DESC
+		WHERE lower(` + field + `) LIKE $1
+		GROUP BY ` + field + `
+		ORDER BY count DESC, ` + field + `
+		LIMIT $2
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, brand)
+	rows, err := r.conn().QueryContext(ctx, query, likeEscaper.Replace(strings.ToLower(prefix))+"%", limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get devices by brand: %w", err)
+		return nil, fmt.Errorf("failed to suggest device values: %w", err)
+	}
+	defer rows.Close()
+
+	values := []ValueCount{}
+	for rows.Next() {
+		var value ValueCount
+		if err := rows.Scan(&value.Value, &value.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan suggestion: %w", err)
+		}
+		values = append(values, value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over suggestions: %w", err)
+	}
+	return values, nil
+}
+
+// Count counts devices with one pass over the table using grouping sets
+func (r *PostgresDeviceRepository) Count(ctx context.Context) ([]DeviceCount, error) {
+	query := `
+		SELECT COALESCE(brand, ''), COALESCE(state, ''), COUNT(*)
+		FROM devices
+		GROUP BY GROUPING SETS ((), (state), (brand), (brand, state))
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count devices: %w", err)
 	}
 	defer rows.Close()
 
-	var devices []*models.Device
+	counts := []DeviceCount{}
+	for rows.Next() {
+		var count DeviceCount
+		if err := rows.Scan(&count.Brand, &count.State, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan device count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over device counts: %w", err)
+	}
+	return counts, nil
+}
+
+// CountCreated counts device creations per interval bucket
+func (r *PostgresDeviceRepository) CountCreated(ctx context.Context, interval models.StatsInterval, from, to time.Time) ([]models.CreationBucket, error) {
+	if !interval.IsValid() {
+		return nil, fmt.Errorf("cannot count creations by %s", interval)
+	}
 
+	query := `
+		SELECT date_trunc($1, creation_time AT TIME ZONE 'UTC') AS bucket, COUNT(*)
+		FROM devices
+		WHERE creation_time >= $2 AND creation_time < $3
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, string(interval), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count device creations: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []models.CreationBucket{}
 	for rows.Next() {
-		var device models.Device
-		var stateStr string
-
-		err := rows.Scan(
-			&device.ID,
-			&device.Name,
-			&device.Brand,
-			&stateStr,
-			&device.CreationTime,
-		)
-		if err != nil {
+		var bucket models.CreationBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan creation bucket: %w", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over creation buckets: %w", err)
+	}
+	return buckets, nil
+}
+
+// Search ranks devices by full-text match on the weighted search_vector column
+// plus trigram word similarity of brand and name, which also finds misspelled
+// queries
+func (r *PostgresDeviceRepository) Search(ctx context.Context, query string, limit int) ([]DeviceMatch, error) {
+	sqlQuery := `
+		SELECT ` + deviceColumns + `,
+			ts_rank(search_vector, websearch_to_tsquery('simple', $1)) + word_similarity($1, brand || ' ' || name) AS score
+		FROM devices
+		WHERE search_vector @@ websearch_to_tsquery('simple', $1)
+			OR $1 <% (brand || ' ' || name)
+		ORDER BY score DESC, id
+		LIMIT $2
+	`
+
+	rows, err := r.conn().QueryContext(ctx, sqlQuery, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search devices: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []DeviceMatch{}
+	for rows.Next() {
+		var match DeviceMatch
+		if match.Device, err = scanDevice(scoredRow{rowScanner: rows, score: &match.Score}); err != nil {
 			return nil, fmt.Errorf("failed to scan device: %w", err)
 		}
-		device.State = models.DeviceState(stateStr)
-		devices = append(devices, &device)
+		matches = append(matches, match)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over devices: %w", err)
 	}
+	return matches, nil
+}
+
+// Find retrieves the devices matching filter in ID order
+func (r *PostgresDeviceRepository) Find(ctx context.Context, filter DeviceFilter) ([]*models.Device, error) {
+	conditions, args := deviceFilterConditions(filter)
+	if filter.AfterID != "" {
+		args = append(args, filter.AfterID)
+		conditions = append(conditions, fmt.Sprintf("id > $%d", len(args)))
+	}
+
+	query := `SELECT ` + deviceColumns + ` FROM devices`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if r.tx != nil {
+		query += ` FOR UPDATE`
+	}
+
+	devices, err := r.queryDevices(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find devices: %w", err)
+	}
+	return devices, nil
+}
+
+// streamFetchSize is the number of devices Stream loads at a time
+const streamFetchSize = 500
+
+// Stream reads the devices matching filter a page at a time, each page
+// starting after the last device of the previous one. Every page is a
+// separate query, so no transaction or connection is held while fn runs;
+// devices changed during the stream are seen as they are when their page is
+// read.
+func (r *PostgresDeviceRepository) Stream(ctx context.Context, filter DeviceFilter, fn func(device *models.Device) error) error {
+	conditions, args := deviceFilterConditions(filter)
+	afterArg, limitArg := len(args)+1, len(args)+2
+	conditions = append(conditions, fmt.Sprintf("id > $%d", afterArg))
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE ` + strings.Join(conditions, ` AND `) +
+		fmt.Sprintf(` ORDER BY id LIMIT $%d`, limitArg)
+
+	afterID := filter.AfterID
+	remaining := filter.Limit
+	for {
+		pageSize := streamFetchSize
+		if filter.Limit > 0 && remaining < pageSize {
+			pageSize = remaining
+		}
+		if pageSize == 0 {
+			return nil
+		}
+
+		pageArgs := append(append([]any{}, args...), afterID, pageSize)
+		devices, err := r.queryDevices(ctx, query, pageArgs...)
+		if err != nil {
+			return fmt.Errorf("failed to fetch devices: %w", err)
+		}
+		for _, device := range devices {
+			if err := fn(device); err != nil {
+				return err
+			}
+		}
+		if len(devices) < pageSize {
+			return nil
+		}
+		afterID = devices[len(devices)-1].ID
+		remaining -= len(devices)
+	}
+}
+
+// GetByBrand retrieves devices by brand
+func (r *PostgresDeviceRepository) GetByBrand(ctx context.Context, brand string) ([]*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE brand = $1
+		ORDER BY creation_time DESC
+	`
+
+	devices, err := r.queryDevices(ctx, query, brand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices by brand: %w", err)
+	}
 	return devices, nil
 }
 
 // GetByState retrieves devices by state
 func (r *PostgresDeviceRepository) GetByState(ctx context.Context, state models.DeviceState) ([]*models.Device, error) {
 	query := `
-		SELECT id, name, brand, state, creation_time
+		SELECT ` + deviceColumns + `
 		FROM devices
 		WHERE state = $1
 		ORDER BY creation_time DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, string(state))
+	devices, err := r.queryDevices(ctx, query, string(state))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get devices by state: %w", err)
 	}
-	defer rows.Close()
-
-	var devices []*models.Device
+	return devices, nil
+}
 
-	for rows.Next() {
-		var device models.Device
-		var stateStr string
-
-		err := rows.Scan(
-			&device.ID,
-			&device.Name,
-			&device.Brand,
-			&stateStr,
-			&device.CreationTime,
+// GetByLocation retrieves devices placed in the given location or any location below it
+func (r *PostgresDeviceRepository) GetByLocation(ctx context.Context, locationID string) ([]*models.Device, error) {
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id FROM locations l JOIN subtree s ON l.parent_id = s.id
 		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan device: %w", err)
-		}
-		device.State = models.DeviceState(stateStr)
-		devices = append(devices, &device)
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE location_id IN (SELECT id FROM subtree)
+		ORDER BY creation_time DESC
+	`
+
+	devices, err := r.queryDevices(ctx, query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices by location: %w", err)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over devices: %w", err)
+	return devices, nil
+}
+
+// GetByWarrantyExpiry retrieves devices whose warranty expires between from and to, inclusive
+func (r *PostgresDeviceRepository) GetByWarrantyExpiry(ctx context.Context, from, to models.Date) ([]*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE warranty_expiry BETWEEN $1 AND $2
+		ORDER BY warranty_expiry, id
+	`
+
+	devices, err := r.queryDevices(ctx, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices by warranty expiry: %w", err)
 	}
 	return devices, nil
 }
 
-// Update updates an existing device
+// GetChildren retrieves the devices attached to a parent device
+func (r *PostgresDeviceRepository) GetChildren(ctx context.Context, parentID string) ([]*models.Device, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE parent_id = $1
+		ORDER BY creation_time DESC
+	`
+
+	devices, err := r.queryDevices(ctx, query, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get child devices: %w", err)
+	}
+	return devices, nil
+}
+
+// Update updates an existing device and records a change of its state
 func (r *PostgresDeviceRepository) Update(ctx context.Context, device *models.Device) error {
+	return r.withTx(ctx, func(txRepo *PostgresDeviceRepository) error {
+		return txRepo.update(ctx, device)
+	})
+}
+
+func (r *PostgresDeviceRepository) update(ctx context.Context, device *models.Device) error {
+	var previousState models.DeviceState
+	err := r.tx.QueryRowContext(ctx,
+		`SELECT state FROM devices WHERE id = $1 FOR UPDATE`, device.ID,
+	).Scan(&previousState)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("device with ID %s not found", device.ID)
+		}
+		return fmt.Errorf("failed to get device state: %w", err)
+	}
+
 	query := `
 		UPDATE devices
-		SET name = $2, brand = $3, state = $4
+		SET name = $2, brand = $3, serial_number = NULLIF($4, ''), state = $5, parent_id = $6,
+			purchase_date = $7, purchase_cost = $8, vendor = NULLIF($9, ''), warranty_expiry = $10
 		WHERE id = $1
+		RETURNING ` + deviceColumns + `
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
+	updated, err := scanDevice(r.tx.QueryRowContext(ctx, query,
 		device.ID,
 		device.Name,
 		device.Brand,
+		device.SerialNumber,
 		string(device.State),
-	)
+		device.ParentID,
+		device.PurchaseDate,
+		device.PurchaseCost,
+		device.Vendor,
+		device.WarrantyExpiry,
+	))
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return deviceConflictError(device, pqErr)
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return fmt.Errorf("parent device with ID %s not found", *device.ParentID)
+		}
 		return fmt.Errorf("failed to update device: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	if previousState != device.State {
+		if err := r.recordStateChange(ctx, device.ID, &previousState, device.State, time.Now()); err != nil {
+			return err
+		}
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("device with ID %s not found", device.ID)
+	r.recordChange(models.DeviceUpdated, updated)
+	return nil
+}
+
+// recordStateChange appends to the state history of a device
+func (r *PostgresDeviceRepository) recordStateChange(ctx context.Context, deviceID string, from *models.DeviceState, to models.DeviceState, changedAt time.Time) error {
+	query := `
+		INSERT INTO device_state_changes (device_id, from_state, to_state, changed_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := r.tx.ExecContext(ctx, query, deviceID, from, string(to), changedAt); err != nil {
+		return fmt.Errorf("failed to record device state change: %w", err)
 	}
 	return nil
 }
 
 // Delete removes a device from the database
 func (r *PostgresDeviceRepository) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM devices WHERE id = $1`
+	return r.withTx(ctx, func(txRepo *PostgresDeviceRepository) error {
+		return txRepo.delete(ctx, id)
+	})
+}
 
-	result, err := r.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete device by ID: %w", err)
-	}
+func (r *PostgresDeviceRepository) delete(ctx context.Context, id string) error {
+	query := `DELETE FROM devices WHERE id = $1 RETURNING ` + deviceColumns
 
-	rowsAffected, err := result.RowsAffected()
+	device, err := scanDevice(r.tx.QueryRowContext(ctx, query, id))
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("device with ID %s not found", id)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("device with ID %s not found", id)
+		}
+		return fmt.Errorf("failed to delete device by ID: %w", err)
 	}
-
+	r.recordChange(models.DeviceDeleted, device)
 	return nil
 }
 
@@ -246,9 +661,445 @@ func (r *PostgresDeviceRepository) Exists(ctx context.Context, id string) (bool,
 	query := `SELECT EXISTS(SELECT 1 FROM devices WHERE id = $1)`
 
 	var exists bool
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&exists)
+	err := r.conn().QueryRowContext(ctx, query, id).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check device existence by ID: %w", err)
 	}
 	return exists, nil
 }
+
+// MoveToLocation moves a device to a new location and records the move
+func (r *PostgresDeviceRepository) MoveToLocation(ctx context.Context, deviceID, locationID string) (*models.DeviceMove, error) {
+	var move *models.DeviceMove
+	err := r.withTx(ctx, func(txRepo *PostgresDeviceRepository) error {
+		var err error
+		move, err = txRepo.moveToLocation(ctx, deviceID, locationID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return move, nil
+}
+
+// moveToLocation performs MoveToLocation and must run inside a transaction
+func (r *PostgresDeviceRepository) moveToLocation(ctx context.Context, deviceID, locationID string) (*models.DeviceMove, error) {
+	var fromLocationID sql.NullString
+	err := r.tx.QueryRowContext(ctx,
+		`SELECT location_id FROM devices WHERE id = $1 FOR UPDATE`, deviceID,
+	).Scan(&fromLocationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("device with ID %s not found", deviceID)
+		}
+		return nil, fmt.Errorf("failed to get device location: %w", err)
+	}
+
+	device, err := scanDevice(r.tx.QueryRowContext(ctx,
+		`UPDATE devices SET location_id = $2 WHERE id = $1 RETURNING `+deviceColumns, deviceID, locationID,
+	))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return nil, fmt.Errorf("location with ID %s not found", locationID)
+		}
+		return nil, fmt.Errorf("failed to update device location: %w", err)
+	}
+
+	move := &models.DeviceMove{
+		DeviceID:     deviceID,
+		ToLocationID: locationID,
+	}
+	if fromLocationID.Valid {
+		move.FromLocationID = &fromLocationID.String
+	}
+
+	query := `
+		INSERT INTO device_moves (device_id, from_location_id, to_location_id)
+		VALUES ($1, $2, $3)
+		RETURNING moved_at
+	`
+	err = r.tx.QueryRowContext(ctx, query, deviceID, move.FromLocationID, locationID).Scan(&move.MovedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record device move: %w", err)
+	}
+	r.recordChange(models.DeviceUpdated, device)
+	return move, nil
+}
+
+// GetMoves retrieves the location history of a device, most recent first
+func (r *PostgresDeviceRepository) GetMoves(ctx context.Context, deviceID string) ([]*models.DeviceMove, error) {
+	query := `
+		SELECT device_id, from_location_id, to_location_id, moved_at
+		FROM device_moves
+		WHERE device_id = $1
+		ORDER BY moved_at DESC, id DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device moves: %w", err)
+	}
+	defer rows.Close()
+
+	moves := []*models.DeviceMove{}
+
+	for rows.Next() {
+		var move models.DeviceMove
+		var fromLocationID sql.NullString
+
+		if err := rows.Scan(&move.DeviceID, &fromLocationID, &move.ToLocationID, &move.MovedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan device move: %w", err)
+		}
+		if fromLocationID.Valid {
+			move.FromLocationID = &fromLocationID.String
+		}
+		moves = append(moves, &move)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over device moves: %w", err)
+	}
+	return moves, nil
+}
+
+// GetStateChanges returns, per device, the last state change before from and
+// the changes in [from, to), ordered by device and time
+func (r *PostgresDeviceRepository) GetStateChanges(ctx context.Context, from, to time.Time) ([]*models.StateChange, error) {
+	query := `
+		SELECT device_id, from_state, to_state, changed_at
+		FROM device_state_changes c
+		WHERE changed_at < $2
+			AND (changed_at >= $1 OR id = (
+				SELECT id FROM device_state_changes p
+				WHERE p.device_id = c.device_id AND p.changed_at < $1
+				ORDER BY p.changed_at DESC, p.id DESC
+				LIMIT 1
+			))
+		ORDER BY device_id, changed_at, id
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device state changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*models.StateChange{}
+	for rows.Next() {
+		var change models.StateChange
+		var fromState sql.NullString
+
+		if err := rows.Scan(&change.DeviceID, &fromState, &change.ToState, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan device state change: %w", err)
+		}
+		if fromState.Valid {
+			state := models.DeviceState(fromState.String)
+			change.FromState = &state
+		}
+		changes = append(changes, &change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over device state changes: %w", err)
+	}
+	return changes, nil
+}
+
+// GetChanges returns up to limit entries of the change log with a sequence
+// number greater than since, in order
+func (r *PostgresDeviceRepository) GetChanges(ctx context.Context, since int64, limit int) ([]*models.DeviceChange, error) {
+	query := `
+		SELECT sequence, type, device_id, device, changed_at
+		FROM device_changes
+		WHERE sequence > $1
+		ORDER BY sequence
+		LIMIT $2
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*models.DeviceChange{}
+	for rows.Next() {
+		var change models.DeviceChange
+		var device []byte
+
+		if err := rows.Scan(&change.Sequence, &change.Type, &change.DeviceID, &device, &change.Time); err != nil {
+			return nil, fmt.Errorf("failed to scan device change: %w", err)
+		}
+		if err := json.Unmarshal(device, &change.Device); err != nil {
+			return nil, fmt.Errorf("failed to decode device of change %d: %w", change.Sequence, err)
+		}
+		changes = append(changes, &change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over device changes: %w", err)
+	}
+	return changes, nil
+}
+
+// recordChange adds a device write to the changes logged when the transaction
+// commits
+func (r *PostgresDeviceRepository) recordChange(eventType models.DeviceEventType, device *models.Device) {
+	snapshot := *device
+	*r.changes = append(*r.changes, models.DeviceChange{Type: eventType, DeviceID: device.ID, Device: &snapshot})
+}
+
+// logChanges appends the recorded changes to the change log and announces
+// them on DeviceChangesChannel, right before the transaction commits. An
+// advisory lock is held from the first insert until the commit, so that
+// sequence numbers become visible in order and readers resuming after a
+// sequence number never skip a change. Only this short tail of each write is
+// serialized: the rest of the transaction runs concurrently, and the lock does
+// not block reads, trimming or vacuuming of the log.
+func (r *PostgresDeviceRepository) logChanges(ctx context.Context) error {
+	if len(*r.changes) == 0 {
+		return nil
+	}
+	if _, err := r.tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, deviceChangesLockKey); err != nil {
+		return fmt.Errorf("failed to lock device changes: %w", err)
+	}
+
+	query := `
+		INSERT INTO device_changes (device_id, type, device)
+		VALUES ($1, $2, $3)
+		RETURNING sequence, changed_at
+	`
+	for _, change := range *r.changes {
+		device, err := json.Marshal(change.Device)
+		if err != nil {
+			return fmt.Errorf("failed to encode device change: %w", err)
+		}
+		err = r.tx.QueryRowContext(ctx, query, change.DeviceID, string(change.Type), device).Scan(&change.Sequence, &change.Time)
+		if err != nil {
+			return fmt.Errorf("failed to record device change: %w", err)
+		}
+
+		payload, err := json.Marshal(change)
+		if err == nil && len(payload) > maxNotificationPayload {
+			// Listeners load the device themselves
+			change.Device = nil
+			payload, err = json.Marshal(change)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode device change: %w", err)
+		}
+		if _, err := r.tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, DeviceChangesChannel, string(payload)); err != nil {
+			return fmt.Errorf("failed to notify device change: %w", err)
+		}
+	}
+	return nil
+}
+
+// WithTx runs fn against a repository bound to a single database transaction.
+// The transaction is committed when fn returns nil and rolled back otherwise.
+// Calls made on a repository that is already transactional join the existing transaction.
+func (r *PostgresDeviceRepository) WithTx(ctx context.Context, fn func(repo DeviceRepository) error) error {
+	return r.withTx(ctx, func(txRepo *PostgresDeviceRepository) error {
+		return fn(txRepo)
+	})
+}
+
+func (r *PostgresDeviceRepository) withTx(ctx context.Context, fn func(txRepo *PostgresDeviceRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	txRepo := &PostgresDeviceRepository{db: r.db, tx: tx, changes: &[]models.DeviceChange{}}
+	if err := fn(txRepo); err != nil {
+		return err
+	}
+	if err := txRepo.logChanges(ctx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// conn returns the transaction the repository is bound to, or the connection pool
+func (r *PostgresDeviceRepository) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scoredRow scans a trailing score column after the device columns
+type scoredRow struct {
+	rowScanner
+	score *float64
+}
+
+func (sr scoredRow) Scan(dest ...any) error {
+	return sr.rowScanner.Scan(append(dest, sr.score)...)
+}
+
+// scanDevice scans a single row selected with deviceColumns
+func scanDevice(row rowScanner) (*models.Device, error) {
+	return scanDeviceFields(row, models.DeviceFields)
+}
+
+// selectColumns maps device field names to the columns to select. Every
+// device field is stored in the column of the same name; no fields selects all.
+func selectColumns(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return models.DeviceFields, nil
+	}
+	known := make(map[string]bool, len(models.DeviceFields))
+	for _, field := range models.DeviceFields {
+		known[field] = true
+	}
+	for _, field := range fields {
+		if !known[field] {
+			return nil, fmt.Errorf("unknown device field: %s", field)
+		}
+	}
+	return fields, nil
+}
+
+// orderByClause builds the ORDER BY list for sort from the whitelisted
+// columns, ending with id as a tiebreak
+func orderByClause(sort []DeviceSort) (string, error) {
+	if len(sort) == 0 {
+		sort = []DeviceSort{{Field: "creation_time", Descending: true}}
+	}
+
+	terms := make([]string, 0, len(sort)+1)
+	for _, s := range sort {
+		if !slices.Contains(SortableDeviceFields, s.Field) {
+			return "", fmt.Errorf("cannot sort devices by %s", s.Field)
+		}
+		term := s.Field
+		if s.Descending {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(append(terms, "id"), ", "), nil
+}
+
+// scanDeviceFields scans a single row whose columns are the given device fields
+func scanDeviceFields(row rowScanner, fields []string) (*models.Device, error) {
+	var device models.Device
+	var stateStr string
+	var serialNumber, assetTag, locationID, parentID, vendor sql.NullString
+
+	targets := map[string]any{
+		"id":              &device.ID,
+		"name":            &device.Name,
+		"brand":           &device.Brand,
+		"serial_number":   &serialNumber,
+		"asset_tag":       &assetTag,
+		"state":           &stateStr,
+		"location_id":     &locationID,
+		"parent_id":       &parentID,
+		"creation_time":   &device.CreationTime,
+		"purchase_date":   &device.PurchaseDate,
+		"purchase_cost":   &device.PurchaseCost,
+		"vendor":          &vendor,
+		"warranty_expiry": &device.WarrantyExpiry,
+	}
+	dest := make([]any, len(fields))
+	for i, field := range fields {
+		dest[i] = targets[field]
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	device.State = models.DeviceState(stateStr)
+	device.SerialNumber = serialNumber.String
+	device.AssetTag = assetTag.String
+	device.Vendor = vendor.String
+	if locationID.Valid {
+		device.LocationID = &locationID.String
+	}
+	if parentID.Valid {
+		device.ParentID = &parentID.String
+	}
+	return &device, nil
+}
+
+// deviceConflictError describes which unique constraint a device write violated
+func deviceConflictError(device *models.Device, pqErr *pq.Error) error {
+	switch pqErr.Constraint {
+	case "idx_devices_brand_serial_number":
+		return fmt.Errorf("device with serial number %s already exists for brand %s", device.SerialNumber, device.Brand)
+	case "idx_devices_asset_tag":
+		return fmt.Errorf("device with asset tag %s already exists", device.AssetTag)
+	default:
+		return fmt.Errorf("device with ID %s already exists", device.ID)
+	}
+}
+
+// deviceFilterConditions translates the attribute filters into WHERE conditions
+// with numbered placeholders for the returned arguments
+func deviceFilterConditions(filter DeviceFilter) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.Brand != "" {
+		args = append(args, filter.Brand)
+		conditions = append(conditions, fmt.Sprintf("brand = $%d", len(args)))
+	}
+	if filter.State != "" {
+		args = append(args, string(filter.State))
+		conditions = append(conditions, fmt.Sprintf("state = $%d", len(args)))
+	}
+	if filter.LocationID != "" {
+		args = append(args, filter.LocationID)
+		conditions = append(conditions, fmt.Sprintf(`location_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM locations WHERE id = $%d
+				UNION ALL
+				SELECT l.id FROM locations l JOIN subtree s ON l.parent_id = s.id
+			)
+			SELECT id FROM subtree
+		)`, len(args)))
+	}
+	return conditions, args
+}
+
+// queryDevices runs a query selecting deviceColumns and scans every row
+func (r *PostgresDeviceRepository) queryDevices(ctx context.Context, query string, args ...any) ([]*models.Device, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []*models.Device{}
+
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over devices: %w", err)
+	}
+	return devices, nil
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"devices-api/internal/models"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxReserveAttempts bounds how often Reserve retries when the record holding
+// a key disappears between reserving and reading it
+const maxReserveAttempts = 3
+
+// PostgresIdempotencyRepository implements IdempotencyRepository using PostgreSQL
+type PostgresIdempotencyRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresIdempotencyRepository creates a new PostgreSQL idempotency repository
+func NewPostgresIdempotencyRepository(db *sql.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{
+		db: db,
+	}
+}
+
+// Reserve inserts record, taking over the key if its previous record has
+// expired or was left behind by a request that did not complete in time
+func (r *PostgresIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	for attempt := 1; ; attempt++ {
+		reserved, err := r.reserve(ctx, record)
+		if err != nil || reserved {
+			return nil, err
+		}
+
+		existing, err := r.get(ctx, record.Key)
+		if errors.Is(err, sql.ErrNoRows) && attempt < maxReserveAttempts {
+			// The record was released or removed in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+		return existing, nil
+	}
+}
+
+// reserve inserts record and reports whether the key was free to take
+func (r *PostgresIdempotencyRepository) reserve(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (key, request_hash, created_at, expires_at, locked_until, token)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = NULL,
+			content_type = NULL,
+			body = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at,
+			locked_until = EXCLUDED.locked_until,
+			token = EXCLUDED.token
+		WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.locked_until <= EXCLUDED.created_at)
+		RETURNING key
+	`
+
+	var key string
+	err := r.db.QueryRowContext(ctx, query, record.Key, record.RequestHash, record.CreatedAt, record.ExpiresAt, record.LockedUntil, record.Token).Scan(&key)
+	if err == sql.ErrNoRows {
+		// The key is held by another record
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	return true, nil
+}
+
+// get retrieves the record holding a key
+func (r *PostgresIdempotencyRepository) get(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	query := `
+		SELECT key, request_hash, status_code, content_type, body, created_at, expires_at, locked_until
+		FROM idempotency_keys WHERE key = $1
+	`
+
+	var record models.IdempotencyRecord
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	err := r.db.QueryRowContext(ctx, query, key).Scan(
+		&record.Key,
+		&record.RequestHash,
+		&statusCode,
+		&contentType,
+		&record.Body,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+		&record.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	record.StatusCode = int(statusCode.Int64)
+	record.ContentType = contentType.String
+	return &record, nil
+}
+
+// Complete stores the response of a reservation that is still held
+func (r *PostgresIdempotencyRepository) Complete(ctx context.Context, key, token string, statusCode int, contentType string, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $3, content_type = $4, body = $5
+		WHERE key = $1 AND token = $2 AND status_code IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, key, token, statusCode, contentType, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrReservationLost
+	}
+	return nil
+}
+
+// Release removes a reservation that is still held and has no stored response
+func (r *PostgresIdempotencyRepository) Release(ctx context.Context, key, token string) error {
+	query := `DELETE FROM idempotency_keys WHERE key = $1 AND token = $2 AND status_code IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, key, token); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes records that expired before now
+func (r *PostgresIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected, nil
+}
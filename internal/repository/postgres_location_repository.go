@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"devices-api/internal/models"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// PostgresLocationRepository implements LocationRepository using PostgreSQL
+type PostgresLocationRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresLocationRepository creates a new PostgreSQL location repository
+func NewPostgresLocationRepository(db *sql.DB) *PostgresLocationRepository {
+	return &PostgresLocationRepository{
+		db: db,
+	}
+}
+
+// Create inserts a new location into the database
+func (r *PostgresLocationRepository) Create(ctx context.Context, location *models.Location) error {
+	query := `
+		INSERT INTO locations (id, name, type, parent_id, creation_time)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		location.ID,
+		location.Name,
+		string(location.Type),
+		location.ParentID,
+		location.CreationTime,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return fmt.Errorf("location with ID %s already exists", location.ID)
+		}
+		return fmt.Errorf("failed to create location: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves a location by its ID
+func (r *PostgresLocationRepository) GetByID(ctx context.Context, id string) (*models.Location, error) {
+	query := `
+		SELECT id, name, type, parent_id, creation_time
+		FROM locations
+		WHERE id = $1
+	`
+
+	location, err := scanLocation(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("location with ID %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to get location by ID: %w", err)
+	}
+	return location, nil
+}
+
+// GetAll retrieves all locations
+func (r *PostgresLocationRepository) GetAll(ctx context.Context) ([]*models.Location, error) {
+	query := `
+		SELECT id, name, type, parent_id, creation_time
+		FROM locations
+		ORDER BY name
+	`
+
+	locations, err := r.queryLocations(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all locations: %w", err)
+	}
+	return locations, nil
+}
+
+// GetChildren retrieves the direct children of a location
+func (r *PostgresLocationRepository) GetChildren(ctx context.Context, parentID string) ([]*models.Location, error) {
+	query := `
+		SELECT id, name, type, parent_id, creation_time
+		FROM locations
+		WHERE parent_id = $1
+		ORDER BY name
+	`
+
+	locations, err := r.queryLocations(ctx, query, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get child locations: %w", err)
+	}
+	return locations, nil
+}
+
+// Update updates an existing location
+func (r *PostgresLocationRepository) Update(ctx context.Context, location *models.Location) error {
+	query := `
+		UPDATE locations
+		SET name = $2, parent_id = $3
+		WHERE id = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		location.ID,
+		location.Name,
+		location.ParentID,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return fmt.Errorf("parent location with ID %s not found", *location.ParentID)
+		}
+		return fmt.Errorf("failed to update location: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("location with ID %s not found", location.ID)
+	}
+	return nil
+}
+
+// Delete removes a location from the database
+func (r *PostgresLocationRepository) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM locations WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return fmt.Errorf("cannot delete location %s while it contains locations or devices", id)
+		}
+		return fmt.Errorf("failed to delete location by ID: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("location with ID %s not found", id)
+	}
+
+	return nil
+}
+
+// scanLocation scans a single location row
+func scanLocation(row rowScanner) (*models.Location, error) {
+	var location models.Location
+	var typeStr string
+	var parentID sql.NullString
+
+	err := row.Scan(
+		&location.ID,
+		&location.Name,
+		&typeStr,
+		&parentID,
+		&location.CreationTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	location.Type = models.LocationType(typeStr)
+	if parentID.Valid {
+		location.ParentID = &parentID.String
+	}
+	return &location, nil
+}
+
+// queryLocations runs a location query and scans every row
+func (r *PostgresLocationRepository) queryLocations(ctx context.Context, query string, args ...any) ([]*models.Location, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []*models.Location{}
+
+	for rows.Next() {
+		location, err := scanLocation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, location)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over locations: %w", err)
+	}
+	return locations, nil
+}
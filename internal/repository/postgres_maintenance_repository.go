@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"devices-api/internal/models"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const ticketColumns = `id, device_id, schedule_id, status, notes, cost, due_date, opened_at, closed_at, prior_state`
+
+const scheduleColumns = `id, device_id, description, interval_days, next_due, creation_time`
+
+// PostgresMaintenanceRepository implements MaintenanceRepository using PostgreSQL
+type PostgresMaintenanceRepository struct {
+	db *sql.DB
+	tx *sql.Tx // set on repositories handed out by WithTx
+	// devices is the device repository bound to the same transaction
+	devices *PostgresDeviceRepository
+}
+
+// NewPostgresMaintenanceRepository creates a new PostgreSQL maintenance repository
+func NewPostgresMaintenanceRepository(db *sql.DB) *PostgresMaintenanceRepository {
+	return &PostgresMaintenanceRepository{
+		db: db,
+	}
+}
+
+// CreateTicket inserts a new maintenance ticket
+func (r *PostgresMaintenanceRepository) CreateTicket(ctx context.Context, ticket *models.MaintenanceTicket) error {
+	query := `
+		INSERT INTO maintenance_tickets (` + ticketColumns + `)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+	`
+
+	_, err := r.conn().ExecContext(ctx, query,
+		ticket.ID,
+		ticket.DeviceID,
+		ticket.ScheduleID,
+		string(ticket.Status),
+		ticket.Notes,
+		ticket.Cost,
+		ticket.DueDate,
+		ticket.OpenedAt,
+		ticket.ClosedAt,
+		ticket.PriorState,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return fmt.Errorf("maintenance ticket with ID %s already exists", ticket.ID)
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return fmt.Errorf("device with ID %s not found", ticket.DeviceID)
+		}
+		return fmt.Errorf("failed to create maintenance ticket: %w", err)
+	}
+	return nil
+}
+
+// GetTicketByID retrieves a maintenance ticket by its ID
+func (r *PostgresMaintenanceRepository) GetTicketByID(ctx context.Context, id string) (*models.MaintenanceTicket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM maintenance_tickets WHERE id = $1`
+
+	ticket, err := scanTicket(r.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("maintenance ticket with ID %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to get maintenance ticket by ID: %w", err)
+	}
+	return ticket, nil
+}
+
+// GetAllTickets retrieves all maintenance tickets
+func (r *PostgresMaintenanceRepository) GetAllTickets(ctx context.Context) ([]*models.MaintenanceTicket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM maintenance_tickets ORDER BY opened_at DESC`
+
+	tickets, err := r.queryTickets(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all maintenance tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+// GetTicketsByStatus retrieves maintenance tickets by status
+func (r *PostgresMaintenanceRepository) GetTicketsByStatus(ctx context.Context, status models.MaintenanceStatus) ([]*models.MaintenanceTicket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM maintenance_tickets WHERE status = $1 ORDER BY opened_at DESC`
+
+	tickets, err := r.queryTickets(ctx, query, string(status))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance tickets by status: %w", err)
+	}
+	return tickets, nil
+}
+
+// GetTicketsByDevice retrieves the maintenance tickets of a device
+func (r *PostgresMaintenanceRepository) GetTicketsByDevice(ctx context.Context, deviceID string) ([]*models.MaintenanceTicket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM maintenance_tickets WHERE device_id = $1 ORDER BY opened_at DESC`
+
+	tickets, err := r.queryTickets(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance tickets by device: %w", err)
+	}
+	return tickets, nil
+}
+
+// CountActiveTickets counts the open and in-progress tickets of a device
+func (r *PostgresMaintenanceRepository) CountActiveTickets(ctx context.Context, deviceID string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM maintenance_tickets
+		WHERE device_id = $1 AND status IN ('open', 'in-progress')
+	`
+
+	var count int
+	if err := r.conn().QueryRowContext(ctx, query, deviceID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active maintenance tickets: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateTicket updates an existing maintenance ticket
+func (r *PostgresMaintenanceRepository) UpdateTicket(ctx context.Context, ticket *models.MaintenanceTicket) error {
+	query := `
+		UPDATE maintenance_tickets
+		SET status = $2, notes = NULLIF($3, ''), cost = $4, due_date = $5, closed_at = $6
+		WHERE id = $1
+	`
+
+	result, err := r.conn().ExecContext(ctx, query,
+		ticket.ID,
+		string(ticket.Status),
+		ticket.Notes,
+		ticket.Cost,
+		ticket.DueDate,
+		ticket.ClosedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update maintenance ticket: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("maintenance ticket with ID %s not found", ticket.ID)
+	}
+	return nil
+}
+
+// CreateSchedule inserts a new maintenance schedule
+func (r *PostgresMaintenanceRepository) CreateSchedule(ctx context.Context, schedule *models.MaintenanceSchedule) error {
+	query := `
+		INSERT INTO maintenance_schedules (` + scheduleColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.conn().ExecContext(ctx, query,
+		schedule.ID,
+		schedule.DeviceID,
+		schedule.Description,
+		schedule.IntervalDays,
+		schedule.NextDue,
+		schedule.CreationTime,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return fmt.Errorf("maintenance schedule with ID %s already exists", schedule.ID)
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return fmt.Errorf("device with ID %s not found", schedule.DeviceID)
+		}
+		return fmt.Errorf("failed to create maintenance schedule: %w", err)
+	}
+	return nil
+}
+
+// GetSchedulesByDevice retrieves the maintenance schedules of a device
+func (r *PostgresMaintenanceRepository) GetSchedulesByDevice(ctx context.Context, deviceID string) ([]*models.MaintenanceSchedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM maintenance_schedules WHERE device_id = $1 ORDER BY next_due`
+
+	schedules, err := r.querySchedules(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance schedules by device: %w", err)
+	}
+	return schedules, nil
+}
+
+// GetDueSchedules retrieves the schedules due on or before today, locking them
+// when called inside a transaction so concurrent runs do not produce duplicate tickets
+func (r *PostgresMaintenanceRepository) GetDueSchedules(ctx context.Context, today models.Date) ([]*models.MaintenanceSchedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM maintenance_schedules WHERE next_due <= $1 ORDER BY next_due`
+	if r.tx != nil {
+		query += ` FOR UPDATE SKIP LOCKED`
+	}
+
+	schedules, err := r.querySchedules(ctx, query, today)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due maintenance schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// UpdateSchedule updates an existing maintenance schedule
+func (r *PostgresMaintenanceRepository) UpdateSchedule(ctx context.Context, schedule *models.MaintenanceSchedule) error {
+	query := `
+		UPDATE maintenance_schedules
+		SET description = $2, interval_days = $3, next_due = $4
+		WHERE id = $1
+	`
+
+	result, err := r.conn().ExecContext(ctx, query,
+		schedule.ID,
+		schedule.Description,
+		schedule.IntervalDays,
+		schedule.NextDue,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update maintenance schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("maintenance schedule with ID %s not found", schedule.ID)
+	}
+	return nil
+}
+
+// DeleteSchedule removes a maintenance schedule; tickets it produced are kept
+func (r *PostgresMaintenanceRepository) DeleteSchedule(ctx context.Context, id string) error {
+	result, err := r.conn().ExecContext(ctx, `DELETE FROM maintenance_schedules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete maintenance schedule by ID: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("maintenance schedule with ID %s not found", id)
+	}
+	return nil
+}
+
+// WithTx runs fn with maintenance and device repositories bound to the same transaction
+func (r *PostgresMaintenanceRepository) WithTx(ctx context.Context, fn func(repo MaintenanceRepository, deviceRepo DeviceRepository) error) error {
+	if r.tx != nil {
+		return fn(r, r.devices)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	deviceRepo := &PostgresDeviceRepository{db: r.db, tx: tx, changes: &[]models.DeviceChange{}}
+	txRepo := &PostgresMaintenanceRepository{db: r.db, tx: tx, devices: deviceRepo}
+	if err := fn(txRepo, deviceRepo); err != nil {
+		return err
+	}
+	if err := deviceRepo.logChanges(ctx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// conn returns the transaction the repository is bound to, or the connection pool
+func (r *PostgresMaintenanceRepository) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// scanTicket scans a single row selected with ticketColumns
+func scanTicket(row rowScanner) (*models.MaintenanceTicket, error) {
+	var ticket models.MaintenanceTicket
+	var statusStr string
+	var scheduleID, notes, priorState sql.NullString
+	var closedAt sql.NullTime
+
+	err := row.Scan(
+		&ticket.ID,
+		&ticket.DeviceID,
+		&scheduleID,
+		&statusStr,
+		&notes,
+		&ticket.Cost,
+		&ticket.DueDate,
+		&ticket.OpenedAt,
+		&closedAt,
+		&priorState,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ticket.Status = models.MaintenanceStatus(statusStr)
+	ticket.Notes = notes.String
+	if scheduleID.Valid {
+		ticket.ScheduleID = &scheduleID.String
+	}
+	if closedAt.Valid {
+		ticket.ClosedAt = &closedAt.Time
+	}
+	if priorState.Valid {
+		state := models.DeviceState(priorState.String)
+		ticket.PriorState = &state
+	}
+	return &ticket, nil
+}
+
+func (r *PostgresMaintenanceRepository) queryTickets(ctx context.Context, query string, args ...any) ([]*models.MaintenanceTicket, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []*models.MaintenanceTicket{}
+
+	for rows.Next() {
+		ticket, err := scanTicket(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance ticket: %w", err)
+		}
+		tickets = append(tickets, ticket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over maintenance tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+func (r *PostgresMaintenanceRepository) querySchedules(ctx context.Context, query string, args ...any) ([]*models.MaintenanceSchedule, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*models.MaintenanceSchedule{}
+
+	for rows.Next() {
+		var schedule models.MaintenanceSchedule
+		err := rows.Scan(
+			&schedule.ID,
+			&schedule.DeviceID,
+			&schedule.Description,
+			&schedule.IntervalDays,
+			&schedule.NextDue,
+			&schedule.CreationTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance schedule: %w", err)
+		}
+		schedules = append(schedules, &schedule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over maintenance schedules: %w", err)
+	}
+	return schedules, nil
+}
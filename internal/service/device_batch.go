@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"fmt"
+	"strings"
+)
+
+// BatchMode controls how a batch reacts to a failing item
+type BatchMode string
+
+const (
+	// BatchAtomic applies all items in a single transaction, or none of them
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort applies every item in its own transaction and keeps going on failure
+	BatchBestEffort BatchMode = "best-effort"
+)
+
+func (bm BatchMode) IsValid() bool {
+	return bm == BatchAtomic || bm == BatchBestEffort
+}
+
+// MaxBatchSize is the maximum number of items accepted in a single batch
+const MaxBatchSize = 500
+
+// BatchItemStatus is the outcome of a single batch item
+type BatchItemStatus string
+
+const (
+	BatchItemSucceeded BatchItemStatus = "succeeded"
+	BatchItemFailed    BatchItemStatus = "failed"
+	// BatchItemAborted marks items rolled back or skipped because another item of an atomic batch failed
+	BatchItemAborted BatchItemStatus = "aborted"
+)
+
+// BatchCreateRequest represents the request to create several devices
+type BatchCreateRequest struct {
+	Mode  BatchMode             `json:"mode,omitempty"`
+	Items []CreateDeviceRequest `json:"items" validate:"required"`
+}
+
+// BatchUpdateItem is a single device update within a batch
+type BatchUpdateItem struct {
+	ID string `json:"id" validate:"required"`
+	UpdateDeviceRequest
+}
+
+// BatchUpdateRequest represents the request to update several devices
+type BatchUpdateRequest struct {
+	Mode  BatchMode         `json:"mode,omitempty"`
+	Items []BatchUpdateItem `json:"items" validate:"required"`
+}
+
+// BatchDeleteRequest represents the request to delete several devices
+type BatchDeleteRequest struct {
+	Mode BatchMode `json:"mode,omitempty"`
+	IDs  []string  `json:"ids" validate:"required"`
+}
+
+// BatchItemResult reports the outcome of one item, in request order
+type BatchItemResult struct {
+	Index  int             `json:"index"`
+	ID     string          `json:"id,omitempty"`
+	Status BatchItemStatus `json:"status"`
+	Device *models.Device  `json:"device,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// BatchResult reports the outcome of a batch
+type BatchResult struct {
+	Mode      BatchMode         `json:"mode"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// batchOp applies the item at index i through repo and returns the affected device, if any
+type batchOp func(repo repository.DeviceRepository, i int) (*models.Device, error)
+
+// BatchCreateDevices creates several devices with the same rules as CreateDevice
+func (s *DeviceServiceImpl) BatchCreateDevices(ctx context.Context, req BatchCreateRequest) (*BatchResult, error) {
+	defer s.suggestions.invalidate()
+
+	mode, err := validateBatch(req.Mode, len(req.Items))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.runBatch(ctx, mode, len(req.Items), func(repo repository.DeviceRepository, i int) (*models.Device, error) {
+		return s.createDevice(ctx, repo, req.Items[i])
+	}), nil
+}
+
+// BatchUpdateDevices updates several devices with the same rules as UpdateDevice
+func (s *DeviceServiceImpl) BatchUpdateDevices(ctx context.Context, req BatchUpdateRequest) (*BatchResult, error) {
+	defer s.suggestions.invalidate()
+
+	mode, err := validateBatch(req.Mode, len(req.Items))
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.runBatch(ctx, mode, len(req.Items), func(repo repository.DeviceRepository, i int) (*models.Device, error) {
+		item := req.Items[i]
+		if strings.TrimSpace(item.ID) == "" {
+			return nil, fmt.Errorf("device ID cannot be empty")
+		}
+		return s.updateDevice(ctx, repo, item.ID, item.UpdateDeviceRequest)
+	})
+	for i := range result.Results {
+		result.Results[i].ID = req.Items[i].ID
+	}
+	return result, nil
+}
+
+// BatchDeleteDevices deletes several devices with the same rules as DeleteDevice
+func (s *DeviceServiceImpl) BatchDeleteDevices(ctx context.Context, req BatchDeleteRequest) (*BatchResult, error) {
+	defer s.suggestions.invalidate()
+
+	mode, err := validateBatch(req.Mode, len(req.IDs))
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.runBatch(ctx, mode, len(req.IDs), func(repo repository.DeviceRepository, i int) (*models.Device, error) {
+		return nil, s.deleteDevice(ctx, repo, req.IDs[i])
+	})
+	for i := range result.Results {
+		result.Results[i].ID = req.IDs[i]
+	}
+	return result, nil
+}
+
+// runBatch applies op to n items according to mode and collects per-item results
+func (s *DeviceServiceImpl) runBatch(ctx context.Context, mode BatchMode, n int, op batchOp) *BatchResult {
+	result := &BatchResult{
+		Mode:    mode,
+		Results: make([]BatchItemResult, n),
+	}
+	for i := range result.Results {
+		result.Results[i] = BatchItemResult{Index: i, Status: BatchItemAborted}
+	}
+
+	if mode == BatchBestEffort {
+		for i := 0; i < n; i++ {
+			var device *models.Device
+			err := s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+				var err error
+				device, err = op(repo, i)
+				return err
+			})
+			result.record(i, device, err)
+		}
+		return result
+	}
+
+	err := s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		for i := 0; i < n; i++ {
+			device, err := op(repo, i)
+			result.record(i, device, err)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && result.Failed == 0 {
+		// Every item applied but the commit itself failed
+		for i := range result.Results {
+			result.Results[i] = BatchItemResult{Index: i, Status: BatchItemFailed, Error: err.Error()}
+		}
+		result.Succeeded, result.Failed = 0, n
+		return result
+	}
+	if err != nil {
+		// Nothing was committed, so earlier successes are rolled back as well
+		for i := range result.Results {
+			item := &result.Results[i]
+			if item.Status == BatchItemFailed {
+				continue
+			}
+			if item.Status == BatchItemSucceeded {
+				result.Succeeded--
+			}
+			item.Status = BatchItemAborted
+			item.ID = ""
+			item.Device = nil
+		}
+	}
+	return result
+}
+
+// record stores the outcome of item i
+func (r *BatchResult) record(i int, device *models.Device, err error) {
+	item := &r.Results[i]
+	if err != nil {
+		item.Status = BatchItemFailed
+		item.Error = err.Error()
+		r.Failed++
+		return
+	}
+	item.Status = BatchItemSucceeded
+	if device != nil {
+		item.ID = device.ID
+		item.Device = device
+	}
+	r.Succeeded++
+}
+
+// validateBatch checks the batch mode and size and applies the default mode
+func validateBatch(mode BatchMode, size int) (BatchMode, error) {
+	if mode == "" {
+		mode = BatchAtomic
+	}
+	if !mode.IsValid() {
+		return "", fmt.Errorf("validation failed: invalid batch mode: %s", mode)
+	}
+	if size == 0 {
+		return "", fmt.Errorf("validation failed: batch cannot be empty")
+	}
+	if size > MaxBatchSize {
+		return "", fmt.Errorf("validation failed: batch cannot contain more than %d items", MaxBatchSize)
+	}
+	return mode, nil
+}
+
+// BulkChanges lists the fields a bulk update sets on every matching device
+type BulkChanges struct {
+	Name  *string             `json:"name,omitempty"`
+	Brand *string             `json:"brand,omitempty"`
+	State *models.DeviceState `json:"state,omitempty"`
+}
+
+// BulkUpdateRequest represents a state change or name/brand edit applied to all devices matching a filter
+type BulkUpdateRequest struct {
+	Filter DeviceFilter `json:"filter" validate:"required"`
+	Set    BulkChanges  `json:"set" validate:"required"`
+	DryRun bool         `json:"dry_run,omitempty"`
+}
+
+// BulkViolation reports a matching device the changes cannot be applied to
+type BulkViolation struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// BulkUpdateResult reports the outcome, or the would-be outcome for a dry run, of a bulk update
+type BulkUpdateResult struct {
+	DryRun      bool            `json:"dry_run"`
+	Matched     int             `json:"matched"`
+	AffectedIDs []string        `json:"affected_ids"`
+	Violations  []BulkViolation `json:"violations"`
+}
+
+// BulkUpdateDevices applies the changes to every device matching the filter.
+// Devices are processed in batches of bulkBatchSize, each in its own
+// transaction, so locks are held briefly. Devices that violate a business rule
+// are skipped and reported; already committed batches stay committed if a
+// later batch fails.
+func (s *DeviceServiceImpl) BulkUpdateDevices(ctx context.Context, req BulkUpdateRequest) (*BulkUpdateResult, error) {
+	defer s.suggestions.invalidate()
+
+	if err := validateBulkRequest(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	changes := UpdateDeviceRequest{
+		Name:  req.Set.Name,
+		Brand: req.Set.Brand,
+		State: req.Set.State,
+	}
+	filter := req.Filter.repositoryFilter()
+	filter.Limit = s.bulkBatchSize
+	result := &BulkUpdateResult{
+		DryRun:      req.DryRun,
+		AffectedIDs: []string{},
+		Violations:  []BulkViolation{},
+	}
+
+	for {
+		var devices []*models.Device
+		process := func(repo repository.DeviceRepository) error {
+			var err error
+			devices, err = repo.Find(ctx, filter)
+			if err != nil {
+				return fmt.Errorf("failed to find devices: %w", err)
+			}
+			for _, device := range devices {
+				result.Matched++
+				if err := s.bulkUpdateDevice(ctx, repo, device, changes, req.DryRun, result); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var err error
+		if req.DryRun {
+			err = process(s.deviceRepo)
+		} else {
+			err = s.deviceRepo.WithTx(ctx, process)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(devices) < filter.Limit {
+			return result, nil
+		}
+		filter.AfterID = devices[len(devices)-1].ID
+	}
+}
+
+// bulkUpdateDevice applies changes to a copy of device and saves it unless
+// dryRun is set. Rule violations are recorded in result rather than returned.
+func (s *DeviceServiceImpl) bulkUpdateDevice(ctx context.Context, repo repository.DeviceRepository, device *models.Device, changes UpdateDeviceRequest, dryRun bool, result *BulkUpdateResult) error {
+	updated := *device
+	if err := s.applyUpdates(&updated, changes); err != nil {
+		result.Violations = append(result.Violations, BulkViolation{ID: device.ID, Error: err.Error()})
+		return nil
+	}
+	if updated.Name == device.Name && updated.Brand == device.Brand && updated.State == device.State {
+		return nil
+	}
+
+	stateChanged := updated.State != device.State
+	if stateChanged {
+		if err := s.checkCascade(ctx, repo, &updated); err != nil {
+			result.Violations = append(result.Violations, BulkViolation{ID: device.ID, Error: err.Error()})
+			return nil
+		}
+	}
+
+	result.AffectedIDs = append(result.AffectedIDs, device.ID)
+	if dryRun {
+		return nil
+	}
+
+	if err := repo.Update(ctx, &updated); err != nil {
+		return fmt.Errorf("failed to update device %s: %w", device.ID, err)
+	}
+	if stateChanged {
+		return s.cascadeState(ctx, repo, &updated)
+	}
+	return nil
+}
+
+// checkCascade verifies that the state of a kit can be applied to all of its components
+func (s *DeviceServiceImpl) checkCascade(ctx context.Context, repo repository.DeviceRepository, parent *models.Device) error {
+	children, err := repo.GetChildren(ctx, parent.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get child devices: %w", err)
+	}
+
+	for _, child := range children {
+		updated := *child
+		if err := updated.UpdateState(parent.State); err != nil {
+			return fmt.Errorf("cannot update child device %s: %w", child.ID, err)
+		}
+	}
+	return nil
+}
+
+// validateBulkRequest requires a filter and at least one change
+func validateBulkRequest(req BulkUpdateRequest) error {
+	if req.Filter.IsEmpty() {
+		return fmt.Errorf("filter must contain at least one of brand, state or location_id")
+	}
+	if err := req.Filter.validate(); err != nil {
+		return err
+	}
+	if req.Set.Name == nil && req.Set.Brand == nil && req.Set.State == nil {
+		return fmt.Errorf("at least one of name, brand or state must be set")
+	}
+	return nil
+}
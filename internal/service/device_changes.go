@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"fmt"
+)
+
+const (
+	// DefaultChangesLimit is the number of changes returned when no limit is given
+	DefaultChangesLimit = 100
+	// MaxChangesLimit is the largest number of changes a request returns
+	MaxChangesLimit = 1000
+)
+
+// ChangesRequest pages through the device change log. Since is the sequence
+// number of the last change already seen, zero to start from the beginning.
+type ChangesRequest struct {
+	Since int64 `json:"since,omitempty"`
+	Limit int   `json:"limit,omitempty"`
+}
+
+// GetChanges returns the device changes after req.Since in the order they
+// were committed, so that consumers can sync incrementally and resume from
+// the cursor of the last page.
+func (s *DeviceServiceImpl) GetChanges(ctx context.Context, req ChangesRequest) (*models.ChangeFeed, error) {
+	if req.Since < 0 {
+		return nil, fmt.Errorf("validation failed: since must not be negative")
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultChangesLimit
+	}
+	if limit < 0 || limit > MaxChangesLimit {
+		return nil, fmt.Errorf("validation failed: limit must be between 1 and %d", MaxChangesLimit)
+	}
+
+	// One more change than requested tells whether there are further pages
+	changes, err := s.deviceRepo.GetChanges(ctx, req.Since, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device changes: %w", err)
+	}
+
+	feed := &models.ChangeFeed{Changes: changes, NextCursor: req.Since}
+	if len(changes) > limit {
+		feed.Changes, feed.HasMore = changes[:limit], true
+	}
+	if n := len(feed.Changes); n > 0 {
+		feed.NextCursor = feed.Changes[n-1].Sequence
+	}
+	return feed, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+)
+
+// EventPublisher receives the device changes made through the service
+type EventPublisher interface {
+	Publish(event models.DeviceEvent)
+}
+
+// WithEventPublisher publishes an event for every device created, updated or
+// deleted through the service. Changes made in a transaction are published
+// once it has committed.
+func WithEventPublisher(publisher EventPublisher) DeviceServiceOption {
+	return func(s *DeviceServiceImpl) {
+		s.deviceRepo = &publishingRepository{DeviceRepository: s.deviceRepo, publisher: publisher}
+	}
+}
+
+// publishingRepository turns device writes into events. Within a transaction
+// the events are held back until it commits and dropped if it rolls back.
+type publishingRepository struct {
+	repository.DeviceRepository
+	publisher EventPublisher
+	// pending collects the events of the current transaction, nil outside one
+	pending *[]models.DeviceEvent
+}
+
+// unwrapRepository returns the repository writes are published for, so that
+// optional interfaces such as repository.DeviceSearcher can be detected
+func unwrapRepository(repo repository.DeviceRepository) repository.DeviceRepository {
+	if publishing, ok := repo.(*publishingRepository); ok {
+		return publishing.DeviceRepository
+	}
+	return repo
+}
+
+func (r *publishingRepository) Create(ctx context.Context, device *models.Device) error {
+	if err := r.DeviceRepository.Create(ctx, device); err != nil {
+		return err
+	}
+	r.publish(models.DeviceCreated, device)
+	return nil
+}
+
+func (r *publishingRepository) Update(ctx context.Context, device *models.Device) error {
+	if err := r.DeviceRepository.Update(ctx, device); err != nil {
+		return err
+	}
+	r.publish(models.DeviceUpdated, device)
+	return nil
+}
+
+func (r *publishingRepository) Delete(ctx context.Context, id string) error {
+	// Deletion events carry the device as it was
+	device, err := r.DeviceRepository.GetByID(ctx, id)
+	if err != nil {
+		return r.DeviceRepository.Delete(ctx, id)
+	}
+	if err := r.DeviceRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.publish(models.DeviceDeleted, device)
+	return nil
+}
+
+func (r *publishingRepository) MoveToLocation(ctx context.Context, deviceID, locationID string) (*models.DeviceMove, error) {
+	move, err := r.DeviceRepository.MoveToLocation(ctx, deviceID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if device, err := r.DeviceRepository.GetByID(ctx, deviceID); err == nil {
+		r.publish(models.DeviceUpdated, device)
+	}
+	return move, nil
+}
+
+func (r *publishingRepository) WithTx(ctx context.Context, fn func(repo repository.DeviceRepository) error) error {
+	if r.pending != nil {
+		// Nested transactions join the outer one and publish with it
+		return r.DeviceRepository.WithTx(ctx, func(repo repository.DeviceRepository) error {
+			return fn(&publishingRepository{DeviceRepository: repo, publisher: r.publisher, pending: r.pending})
+		})
+	}
+
+	var pending []models.DeviceEvent
+	err := r.DeviceRepository.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		pending = nil
+		return fn(&publishingRepository{DeviceRepository: repo, publisher: r.publisher, pending: &pending})
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range pending {
+		r.publisher.Publish(event)
+	}
+	return nil
+}
+
+// publish sends an event with a copy of device, or holds it back until the
+// transaction commits
+func (r *publishingRepository) publish(eventType models.DeviceEventType, device *models.Device) {
+	snapshot := *device
+	event := models.DeviceEvent{Type: eventType, Device: &snapshot}
+	if r.pending != nil {
+		*r.pending = append(*r.pending, event)
+		return
+	}
+	r.publisher.Publish(event)
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ImportFormat is the encoding of an import file
+type ImportFormat string
+
+const (
+	ImportCSV    ImportFormat = "csv"
+	ImportNDJSON ImportFormat = "ndjson"
+)
+
+func (f ImportFormat) IsValid() bool {
+	return f == ImportCSV || f == ImportNDJSON
+}
+
+// MaxImportRows is the maximum number of devices accepted in a single import
+const MaxImportRows = 10000
+
+// exportOnlyColumns are written by the CSV export but ignored on import, so
+// that an exported file can be edited and imported again
+var exportOnlyColumns = map[string]bool{
+	"id":            true,
+	"asset_tag":     true,
+	"location_id":   true,
+	"parent_id":     true,
+	"creation_time": true,
+}
+
+// importColumns maps CSV header names to the CreateDeviceRequest field they set
+var importColumns = map[string]func(req *CreateDeviceRequest, value string) error{
+	"name":          func(req *CreateDeviceRequest, value string) error { req.Name = value; return nil },
+	"brand":         func(req *CreateDeviceRequest, value string) error { req.Brand = value; return nil },
+	"serial_number": func(req *CreateDeviceRequest, value string) error { req.SerialNumber = value; return nil },
+	"state":         func(req *CreateDeviceRequest, value string) error { req.State = models.DeviceState(value); return nil },
+	"purchase_date": func(req *CreateDeviceRequest, value string) error {
+		date, err := models.ParseDate(value)
+		if err != nil {
+			return err
+		}
+		req.PurchaseDate = &date
+		return nil
+	},
+	"purchase_cost": func(req *CreateDeviceRequest, value string) error {
+		cost, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		req.PurchaseCost = &cost
+		return nil
+	},
+	"vendor": func(req *CreateDeviceRequest, value string) error { req.Vendor = value; return nil },
+	"warranty_expiry": func(req *CreateDeviceRequest, value string) error {
+		date, err := models.ParseDate(value)
+		if err != nil {
+			return err
+		}
+		req.WarrantyExpiry = &date
+		return nil
+	},
+}
+
+// ImportRequest holds the options of an import
+type ImportRequest struct {
+	Format ImportFormat
+	Mode   BatchMode
+	DryRun bool
+	// UpsertBySerial updates the device with the same brand and serial number instead of rejecting the row
+	UpsertBySerial bool
+}
+
+// ImportError reports a rejected row by its line in the import file
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportResult reports the outcome, or the would-be outcome for a dry run, of an import
+type ImportResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Mode    BatchMode     `json:"mode"`
+	Rows    int           `json:"rows"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  int           `json:"failed"`
+	Aborted int           `json:"aborted"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// importRow is a decoded row of an import file
+type importRow struct {
+	line int
+	req  CreateDeviceRequest
+	err  error
+}
+
+// ImportDevices creates devices from a CSV or NDJSON file. Every row is
+// validated first; in atomic mode nothing is written unless all rows are
+// valid, and a dry run stops after validation.
+func (s *DeviceServiceImpl) ImportDevices(ctx context.Context, r io.Reader, req ImportRequest) (*ImportResult, error) {
+	defer s.suggestions.invalidate()
+
+	if !req.Format.IsValid() {
+		return nil, fmt.Errorf("validation failed: unsupported import format: %s", req.Format)
+	}
+	mode := req.Mode
+	if mode == "" {
+		mode = BatchAtomic
+	}
+	if !mode.IsValid() {
+		return nil, fmt.Errorf("validation failed: invalid import mode: %s", mode)
+	}
+
+	var rows []importRow
+	var err error
+	if req.Format == ImportCSV {
+		rows, err = decodeCSVRows(r)
+	} else {
+		rows, err = decodeNDJSONRows(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("validation failed: import contains no rows")
+	}
+
+	result := &ImportResult{
+		DryRun: req.DryRun,
+		Mode:   mode,
+		Rows:   len(rows),
+		Errors: []ImportError{},
+	}
+
+	// Validate every row so the report covers the whole file
+	updates := make([]bool, len(rows))
+	seen := make(map[string]int)
+	for i := range rows {
+		update, err := s.checkImportRow(ctx, rows[i], req.UpsertBySerial, seen)
+		if err != nil {
+			rows[i].err = err
+			result.addError(rows[i].line, err)
+			continue
+		}
+		updates[i] = update
+	}
+
+	if req.DryRun || (mode == BatchAtomic && result.Failed > 0) {
+		for i := range rows {
+			if rows[i].err != nil {
+				continue
+			}
+			if req.DryRun {
+				result.count(updates[i])
+			} else {
+				result.Aborted++
+			}
+		}
+		return result, nil
+	}
+
+	batch := s.runBatch(ctx, mode, len(rows), func(repo repository.DeviceRepository, i int) (*models.Device, error) {
+		if rows[i].err != nil {
+			return nil, rows[i].err
+		}
+		return s.importRow(ctx, repo, rows[i].req, req.UpsertBySerial)
+	})
+	for i, item := range batch.Results {
+		switch {
+		case rows[i].err != nil:
+			// Already reported by validation
+		case item.Status == BatchItemSucceeded:
+			result.count(updates[i])
+		case item.Status == BatchItemFailed:
+			result.addError(rows[i].line, errors.New(item.Error))
+		default:
+			result.Aborted++
+		}
+	}
+	return result, nil
+}
+
+// checkImportRow applies the service rules to a row without writing it and
+// reports whether it would update an existing device. seen tracks the serial
+// numbers of earlier rows to catch duplicates within the file.
+func (s *DeviceServiceImpl) checkImportRow(ctx context.Context, row importRow, upsert bool, seen map[string]int) (bool, error) {
+	if row.err != nil {
+		return false, row.err
+	}
+	req := row.req
+
+	if err := s.validateCreateRequest(req); err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+	device, err := models.NewDevice("import", req.Name, req.Brand, req.State)
+	if err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+	if err := device.UpdateProcurement(req.PurchaseDate, req.PurchaseCost, strings.TrimSpace(req.Vendor), req.WarrantyExpiry); err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+
+	serial := strings.TrimSpace(req.SerialNumber)
+	if serial == "" {
+		return false, nil
+	}
+	key := req.Brand + "\x00" + serial
+	if line, ok := seen[key]; ok {
+		return false, fmt.Errorf("validation failed: serial number %s for brand %s is repeated from line %d", serial, req.Brand, line)
+	}
+	seen[key] = row.line
+
+	existing, err := s.deviceRepo.GetBySerialNumber(ctx, req.Brand, serial)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get device: %w", err)
+	}
+	if !upsert {
+		return false, fmt.Errorf("device with serial number %s for brand %s already exists", serial, req.Brand)
+	}
+
+	updated := *existing
+	if err := s.applyUpdates(&updated, importUpdate(existing, req)); err != nil {
+		return false, fmt.Errorf("cannot update device %s: %w", existing.ID, err)
+	}
+	return true, nil
+}
+
+// importRow creates the device of a row, or updates the device with the same
+// serial number when upserting
+func (s *DeviceServiceImpl) importRow(ctx context.Context, repo repository.DeviceRepository, req CreateDeviceRequest, upsert bool) (*models.Device, error) {
+	serial := strings.TrimSpace(req.SerialNumber)
+	if upsert && serial != "" {
+		existing, err := repo.GetBySerialNumber(ctx, req.Brand, serial)
+		if err == nil {
+			return s.updateDevice(ctx, repo, existing.ID, importUpdate(existing, req))
+		}
+		if !strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("failed to get device: %w", err)
+		}
+	}
+	return s.createDevice(ctx, repo, req)
+}
+
+// importUpdate converts an import row into the update applied to the existing
+// device when upserting. Unchanged name and state are left out so that rows
+// matching an in-use device only fail when they would actually rename it.
+func importUpdate(existing *models.Device, req CreateDeviceRequest) UpdateDeviceRequest {
+	update := UpdateDeviceRequest{
+		PurchaseDate:   req.PurchaseDate,
+		PurchaseCost:   req.PurchaseCost,
+		WarrantyExpiry: req.WarrantyExpiry,
+	}
+	if name := strings.TrimSpace(req.Name); name != existing.Name {
+		update.Name = &name
+	}
+	if req.State != existing.State {
+		update.State = &req.State
+	}
+	if req.Vendor != "" {
+		update.Vendor = &req.Vendor
+	}
+	return update
+}
+
+func (r *ImportResult) addError(line int, err error) {
+	r.Errors = append(r.Errors, ImportError{Line: line, Error: err.Error()})
+	r.Failed++
+}
+
+func (r *ImportResult) count(update bool) {
+	if update {
+		r.Updated++
+	} else {
+		r.Created++
+	}
+}
+
+// decodeCSVRows reads a CSV file whose header row names CreateDeviceRequest fields
+func decodeCSVRows(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	setters := make([]func(req *CreateDeviceRequest, value string) error, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		setter, ok := importColumns[column]
+		if !ok && !exportOnlyColumns[column] {
+			return nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+		setters[i] = setter
+		header[i] = column
+	}
+	// Rows must have as many fields as the header
+	reader.FieldsPerRecord = len(header)
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("import cannot contain more than %d rows", MaxImportRows)
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+			rows = append(rows, importRow{line: parseErr.StartLine, err: fmt.Errorf("invalid CSV row: %w", parseErr.Err)})
+			continue
+		}
+		if errors.As(err, &parseErr) {
+			// The reader cannot recover from quoting errors, so the rows after
+			// it cannot be read
+			return nil, fmt.Errorf("invalid CSV at line %d: %w", parseErr.Line, parseErr.Err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line}
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" || setters[i] == nil {
+				continue
+			}
+			if err := setters[i](&row.req, value); err != nil {
+				row.err = fmt.Errorf("invalid %s: %w", header[i], err)
+				break
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// decodeNDJSONRows reads one JSON encoded CreateDeviceRequest per line, skipping blank lines
+func decodeNDJSONRows(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var rows []importRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("import cannot contain more than %d rows", MaxImportRows)
+		}
+
+		row := importRow{line: line}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row.req); err != nil {
+			row.err = fmt.Errorf("invalid JSON: %w", err)
+		} else if decoder.More() {
+			row.err = errors.New("invalid JSON: line contains more than one value")
+		}
+		// Brands are trimmed like CSV values, so that serial numbers are
+		// matched within the brand they are saved under
+		row.req.Brand = strings.TrimSpace(row.req.Brand)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read NDJSON: %w", err)
+	}
+	return rows, nil
+}
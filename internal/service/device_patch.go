@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"devices-api/internal/jsonpatch"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PatchType is the media type of a PATCH request body
+type PatchType string
+
+const (
+	// MergePatch is a JSON Merge Patch document (RFC 7396)
+	MergePatch PatchType = "application/merge-patch+json"
+	// JSONPatch is a list of JSON Patch operations (RFC 6902)
+	JSONPatch PatchType = "application/json-patch+json"
+)
+
+// readOnlyDeviceFields are managed by the server or by dedicated endpoints
+// and cannot be changed through PUT or PATCH
+var readOnlyDeviceFields = []string{"id", "asset_tag", "location_id", "parent_id", "creation_time"}
+
+// ReplaceDeviceRequest is the full representation of a device's writable
+// fields. Optional fields that are omitted are cleared.
+type ReplaceDeviceRequest struct {
+	Name         string             `json:"name" validate:"required"`
+	Brand        string             `json:"brand" validate:"required"`
+	SerialNumber string             `json:"serial_number,omitempty"`
+	State        models.DeviceState `json:"state" validate:"required"`
+
+	PurchaseDate   *models.Date `json:"purchase_date,omitempty"`
+	PurchaseCost   *float64     `json:"purchase_cost,omitempty"`
+	Vendor         string       `json:"vendor,omitempty"`
+	WarrantyExpiry *models.Date `json:"warranty_expiry,omitempty"`
+
+	// Read-only fields are accepted, so that a device read with GET can be
+	// sent back, and ignored
+	ID           json.RawMessage `json:"id,omitempty"`
+	AssetTag     json.RawMessage `json:"asset_tag,omitempty"`
+	LocationID   json.RawMessage `json:"location_id,omitempty"`
+	ParentID     json.RawMessage `json:"parent_id,omitempty"`
+	CreationTime json.RawMessage `json:"creation_time,omitempty"`
+}
+
+// ReplaceDevice replaces the writable fields of a device with req
+func (s *DeviceServiceImpl) ReplaceDevice(ctx context.Context, id string, req ReplaceDeviceRequest) (*models.Device, error) {
+	defer s.suggestions.invalidate()
+
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+
+	var device *models.Device
+	err := s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		var err error
+		if device, err = repo.GetByID(ctx, id); err != nil {
+			return fmt.Errorf("failed to get device: %w", err)
+		}
+		return s.replaceDevice(ctx, repo, device, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// PatchDevice applies a merge patch or JSON patch to the representation of a
+// device and saves the result with the same rules as ReplaceDevice. A failing
+// JSON Patch test operation leaves the device unchanged.
+func (s *DeviceServiceImpl) PatchDevice(ctx context.Context, id string, patchType PatchType, patch []byte) (*models.Device, error) {
+	defer s.suggestions.invalidate()
+
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+	if patchType != MergePatch && patchType != JSONPatch {
+		return nil, fmt.Errorf("unsupported patch type: %s", patchType)
+	}
+
+	var device *models.Device
+	err := s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		var err error
+		if device, err = repo.GetByID(ctx, id); err != nil {
+			return fmt.Errorf("failed to get device: %w", err)
+		}
+
+		document, err := json.Marshal(device)
+		if err != nil {
+			return fmt.Errorf("failed to encode device: %w", err)
+		}
+		var patched []byte
+		if patchType == MergePatch {
+			patched, err = jsonpatch.MergePatch(document, patch)
+		} else {
+			patched, err = jsonpatch.Apply(document, patch)
+		}
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return fmt.Errorf("failed to patch device: %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+
+		req, err := decodePatchedDevice(document, patched)
+		if err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+		return s.replaceDevice(ctx, repo, device, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// replaceDevice applies req to device through repo, which must be bound to a
+// transaction. Name and brand are only written when they change, so a device
+// in use can be replaced with its unchanged representation.
+func (s *DeviceServiceImpl) replaceDevice(ctx context.Context, repo repository.DeviceRepository, device *models.Device, req ReplaceDeviceRequest) error {
+	if err := validateReplaceRequest(req); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	previousState := device.State
+
+	name, brand := strings.TrimSpace(req.Name), strings.TrimSpace(req.Brand)
+	update := UpdateDeviceRequest{
+		State:        &req.State,
+		SerialNumber: &req.SerialNumber,
+	}
+	if name != device.Name || brand != device.Brand {
+		update.Name, update.Brand = &name, &brand
+	}
+	if err := s.applyUpdates(device, update); err != nil {
+		return fmt.Errorf("failed to apply updates: %w", err)
+	}
+	if err := device.UpdateProcurement(req.PurchaseDate, req.PurchaseCost, strings.TrimSpace(req.Vendor), req.WarrantyExpiry); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	if err := repo.Update(ctx, device); err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+	if device.State != previousState {
+		return s.cascadeState(ctx, repo, device)
+	}
+	return nil
+}
+
+// decodePatchedDevice checks that a patch left the read-only fields of
+// original untouched and decodes the patched document strictly
+func decodePatchedDevice(original, patched []byte) (ReplaceDeviceRequest, error) {
+	var before, after map[string]any
+	if err := json.Unmarshal(original, &before); err != nil {
+		return ReplaceDeviceRequest{}, err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return ReplaceDeviceRequest{}, fmt.Errorf("patched document must be an object")
+	}
+	for _, field := range readOnlyDeviceFields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			return ReplaceDeviceRequest{}, fmt.Errorf("field %s is read-only", field)
+		}
+	}
+
+	var device models.Device
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&device); err != nil {
+		return ReplaceDeviceRequest{}, fmt.Errorf("invalid patched device: %w", err)
+	}
+
+	return ReplaceDeviceRequest{
+		Name:           device.Name,
+		Brand:          device.Brand,
+		SerialNumber:   device.SerialNumber,
+		State:          device.State,
+		PurchaseDate:   device.PurchaseDate,
+		PurchaseCost:   device.PurchaseCost,
+		Vendor:         device.Vendor,
+		WarrantyExpiry: device.WarrantyExpiry,
+	}, nil
+}
+
+// validateReplaceRequest checks the required fields of a full representation
+func validateReplaceRequest(req ReplaceDeviceRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("device name is required")
+	}
+	if strings.TrimSpace(req.Brand) == "" {
+		return fmt.Errorf("device brand is required")
+	}
+	if !req.State.IsValid() {
+		return fmt.Errorf("invalid device state: %s", req.State)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultSearchLimit is the number of results returned when no limit is given
+	DefaultSearchLimit = 20
+	// MaxSearchLimit is the largest number of results a search returns
+	MaxSearchLimit = 100
+
+	// minTermSimilarity is the trigram similarity from which a word counts as
+	// a misspelling of a search term, matching the pg_trgm default
+	minTermSimilarity = 0.3
+)
+
+// SearchRequest represents a free-text device search
+type SearchRequest struct {
+	Query string `json:"q" validate:"required"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// DeviceSearchResult is a device found by a search. Highlights holds the
+// searchable fields containing a search term, HTML-escaped and with the terms
+// wrapped in <mark></mark>.
+type DeviceSearchResult struct {
+	Device     *models.Device    `json:"device"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// searchFields are the device fields a search looks at, with their weight in
+// the fallback ranking
+var searchFields = []struct {
+	name   string
+	weight float64
+	value  func(device *models.Device) string
+}{
+	{"name", 1, func(d *models.Device) string { return d.Name }},
+	{"brand", 1, func(d *models.Device) string { return d.Brand }},
+	{"serial_number", 0.8, func(d *models.Device) string { return d.SerialNumber }},
+	{"asset_tag", 0.8, func(d *models.Device) string { return d.AssetTag }},
+	{"vendor", 0.5, func(d *models.Device) string { return d.Vendor }},
+}
+
+// SearchDevices finds devices whose name, brand, serial number, asset tag or
+// vendor match the query, tolerating typos, most relevant first. Repositories
+// that implement repository.DeviceSearcher rank the devices themselves; others
+// are scanned and ranked in process.
+func (s *DeviceServiceImpl) SearchDevices(ctx context.Context, req SearchRequest) ([]DeviceSearchResult, error) {
+	terms := searchTerms(req.Query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("validation failed: search query is required")
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit < 0 || limit > MaxSearchLimit {
+		return nil, fmt.Errorf("validation failed: limit must be between 1 and %d", MaxSearchLimit)
+	}
+
+	var matches []repository.DeviceMatch
+	var err error
+	if searcher, ok := unwrapRepository(s.deviceRepo).(repository.DeviceSearcher); ok {
+		matches, err = searcher.Search(ctx, strings.TrimSpace(req.Query), limit)
+	} else {
+		matches, err = s.searchDevices(ctx, terms, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search devices: %w", err)
+	}
+
+	highlighter := termPattern(terms)
+	results := make([]DeviceSearchResult, len(matches))
+	for i, match := range matches {
+		results[i] = DeviceSearchResult{
+			Device:     match.Device,
+			Score:      match.Score,
+			Highlights: highlight(match.Device, highlighter),
+		}
+	}
+	return results, nil
+}
+
+// searchDevices ranks every device against terms. Each term scores the best
+// match among the searchable fields: 1 for an exact or prefix word match, the
+// trigram similarity for a likely misspelling. The device score is the
+// weighted average over all terms.
+func (s *DeviceServiceImpl) searchDevices(ctx context.Context, terms []string, limit int) ([]repository.DeviceMatch, error) {
+	var matches []repository.DeviceMatch
+	err := s.deviceRepo.Stream(ctx, repository.DeviceFilter{}, func(device *models.Device) error {
+		total := 0.0
+		for _, term := range terms {
+			best := 0.0
+			for _, field := range searchFields {
+				for _, word := range searchTerms(field.value(device)) {
+					if score := termScore(term, word) * field.weight; score > best {
+						best = score
+					}
+				}
+			}
+			total += best
+		}
+		if total > 0 {
+			matches = append(matches, repository.DeviceMatch{Device: device, Score: total / float64(len(terms))})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Device.ID < matches[j].Device.ID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// termScore rates how well word matches a search term
+func termScore(term, word string) float64 {
+	if strings.HasPrefix(word, term) {
+		return 1
+	}
+	if similarity := trigramSimilarity(term, word); similarity >= minTermSimilarity {
+		return similarity
+	}
+	return 0
+}
+
+// searchTerms splits text into lower-case words of letters and digits
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigramSimilarity compares two words by their shared trigrams, as pg_trgm does
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			shared++
+		}
+	}
+	union := len(ta) + len(tb) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// trigrams returns the trigrams of a word padded with two leading and one trailing space
+func trigrams(word string) map[string]bool {
+	padded := []rune("  " + word + " ")
+	set := make(map[string]bool, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = true
+	}
+	return set
+}
+
+// termPattern matches any of the terms at the start of a word, ignoring case.
+// The term is the second submatch; the first is the character before it, as
+// \b only knows ASCII word boundaries.
+func termPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	// Longer terms first so that they win over their own prefixes
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}])(` + strings.Join(quoted, "|") + `)`)
+}
+
+// highlight marks the search terms in the searchable fields of device. The
+// values are HTML-escaped, so the highlights can be rendered as HTML.
+func highlight(device *models.Device, pattern *regexp.Regexp) map[string]string {
+	highlights := make(map[string]string)
+	for _, field := range searchFields {
+		value := field.value(device)
+		matches := pattern.FindAllStringSubmatchIndex(value, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var marked strings.Builder
+		end := 0
+		for _, match := range matches {
+			start, stop := match[4], match[5]
+			marked.WriteString(html.EscapeString(value[end:start]))
+			marked.WriteString("<mark>" + html.EscapeString(value[start:stop]) + "</mark>")
+			end = stop
+		}
+		marked.WriteString(html.EscapeString(value[end:]))
+		highlights[field.name] = marked.String()
+	}
+	if len(highlights) == 0 {
+		return nil
+	}
+	return highlights
+}
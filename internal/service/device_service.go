@@ -5,6 +5,8 @@ import (
 	"devices-api/internal/models"
 	"devices-api/internal/repository"
 	"fmt"
+	"io"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
@@ -14,41 +16,186 @@ import (
 type DeviceService interface {
 	CreateDevice(ctx context.Context, req CreateDeviceRequest) (*models.Device, error)
 	GetDevice(ctx context.Context, id string) (*models.Device, error)
+	GetDeviceBySerialNumber(ctx context.Context, brand, serialNumber string) (*models.Device, error)
+	GetDeviceByAssetTag(ctx context.Context, assetTag string) (*models.Device, error)
+	GetDeviceFields(ctx context.Context, id string, fields []string) (*models.Device, error)
 	GetAllDevices(ctx context.Context) ([]*models.Device, error)
+	ListDevices(ctx context.Context, req ListDevicesRequest) ([]*models.Device, error)
+	SearchDevices(ctx context.Context, req SearchRequest) ([]DeviceSearchResult, error)
+	SuggestValues(ctx context.Context, req SuggestRequest) ([]Suggestion, error)
+	GetDeviceStats(ctx context.Context, req StatsRequest) (*models.DeviceStats, error)
 	GetDevicesByBrand(ctx context.Context, brand string) ([]*models.Device, error)
 	GetDevicesByState(ctx context.Context, state models.DeviceState) ([]*models.Device, error)
+	GetDevicesByLocation(ctx context.Context, locationID string) ([]*models.Device, error)
+	GetDevicesWithExpiringWarranty(ctx context.Context, days int) ([]*models.Device, error)
+	GetDeviceValuation(ctx context.Context, id string, req ValuationRequest) (*models.Valuation, error)
+	GetUtilizationReport(ctx context.Context, req UtilizationRequest) (*models.UtilizationReport, error)
+	GetChanges(ctx context.Context, req ChangesRequest) (*models.ChangeFeed, error)
 	UpdateDevice(ctx context.Context, id string, req UpdateDeviceRequest) (*models.Device, error)
+	ReplaceDevice(ctx context.Context, id string, req ReplaceDeviceRequest) (*models.Device, error)
+	PatchDevice(ctx context.Context, id string, patchType PatchType, patch []byte) (*models.Device, error)
 	DeleteDevice(ctx context.Context, id string) error
+	MoveDevice(ctx context.Context, id string, req MoveDeviceRequest) (*models.DeviceMove, error)
+	GetDeviceMoves(ctx context.Context, id string) ([]*models.DeviceMove, error)
+	GetDeviceChildren(ctx context.Context, id string) ([]*models.Device, error)
+	AttachChild(ctx context.Context, parentID string, req AttachChildRequest) (*models.Device, error)
+	DetachChild(ctx context.Context, parentID, childID string) error
+	BatchCreateDevices(ctx context.Context, req BatchCreateRequest) (*BatchResult, error)
+	BatchUpdateDevices(ctx context.Context, req BatchUpdateRequest) (*BatchResult, error)
+	BatchDeleteDevices(ctx context.Context, req BatchDeleteRequest) (*BatchResult, error)
+	BulkUpdateDevices(ctx context.Context, req BulkUpdateRequest) (*BulkUpdateResult, error)
+	ImportDevices(ctx context.Context, r io.Reader, req ImportRequest) (*ImportResult, error)
+	ExportDevices(ctx context.Context, filter DeviceFilter, fn func(device *models.Device) error) error
 }
 
 // CreateDeviceRequest represents the request to create a new device
 type CreateDeviceRequest struct {
-	Name  string             `json:"name" validate:"required"`
-	Brand string             `json:"brand" validate:"required"`
-	State models.DeviceState `json:"state" validate:"required"`
+	Name         string             `json:"name" validate:"required"`
+	Brand        string             `json:"brand" validate:"required"`
+	SerialNumber string             `json:"serial_number,omitempty"`
+	State        models.DeviceState `json:"state" validate:"required"`
+
+	PurchaseDate   *models.Date `json:"purchase_date,omitempty"`
+	PurchaseCost   *float64     `json:"purchase_cost,omitempty"`
+	Vendor         string       `json:"vendor,omitempty"`
+	WarrantyExpiry *models.Date `json:"warranty_expiry,omitempty"`
 }
 
 // UpdateDeviceRequest represents the request to update a device
 type UpdateDeviceRequest struct {
-	Name  *string             `json:"name,omitempty"`
-	Brand *string             `json:"brand,omitempty"`
-	State *models.DeviceState `json:"state,omitempty"`
+	Name         *string             `json:"name,omitempty"`
+	Brand        *string             `json:"brand,omitempty"`
+	SerialNumber *string             `json:"serial_number,omitempty"`
+	State        *models.DeviceState `json:"state,omitempty"`
+
+	PurchaseDate   *models.Date `json:"purchase_date,omitempty"`
+	PurchaseCost   *float64     `json:"purchase_cost,omitempty"`
+	Vendor         *string      `json:"vendor,omitempty"`
+	WarrantyExpiry *models.Date `json:"warranty_expiry,omitempty"`
+}
+
+// DeviceFilter selects devices by their attributes. Empty fields match every device.
+type DeviceFilter struct {
+	Brand      string             `json:"brand,omitempty"`
+	State      models.DeviceState `json:"state,omitempty"`
+	LocationID string             `json:"location_id,omitempty"`
+}
+
+// IsEmpty reports whether the filter matches every device
+func (f DeviceFilter) IsEmpty() bool {
+	return f.Brand == "" && f.State == "" && f.LocationID == ""
+}
+
+func (f DeviceFilter) validate() error {
+	if f.State != "" && !f.State.IsValid() {
+		return fmt.Errorf("invalid device state: %s", f.State)
+	}
+	return nil
+}
+
+func (f DeviceFilter) repositoryFilter() repository.DeviceFilter {
+	return repository.DeviceFilter{
+		Brand:      f.Brand,
+		State:      f.State,
+		LocationID: f.LocationID,
+	}
+}
+
+// MaxListLimit is the largest page size of a device listing
+const MaxListLimit = 1000
+
+// ListDevicesRequest selects, orders and pages the devices of a listing and
+// the fields loaded for each
+type ListDevicesRequest struct {
+	Filter DeviceFilter
+	// Fields limits the loaded fields; empty loads all of them
+	Fields []string
+	// Sort is a comma-separated list of fields, each optionally prefixed with
+	// - for descending order, e.g. "name,-creation_time". Empty lists newest first.
+	Sort string
+
+	// Limit and Offset select a page; a zero Limit returns every device
+	Limit  int
+	Offset int
+}
+
+// ValuationRequest holds the depreciation parameters of a valuation
+type ValuationRequest struct {
+	Method          models.DepreciationMethod
+	UsefulLifeYears float64
+	SalvageValue    float64
+	AsOf            *models.Date
+}
+
+// DefaultUsefulLifeYears is the useful life assumed when a valuation does not specify one
+const DefaultUsefulLifeYears = 3
+
+// MoveDeviceRequest represents the request to move a device to another location
+type MoveDeviceRequest struct {
+	LocationID string `json:"location_id" validate:"required"`
+}
+
+// AttachChildRequest represents the request to attach a component to a device
+type AttachChildRequest struct {
+	ChildID string `json:"child_id" validate:"required"`
 }
 
+// DefaultAssetTagPattern is used when no asset tag pattern is configured
+const DefaultAssetTagPattern = "DEV-######"
+
+// DefaultBulkBatchSize is the number of devices a bulk update changes per transaction
+const DefaultBulkBatchSize = 100
+
 // DeviceServiceImpl implements DeviceService
 type DeviceServiceImpl struct {
-	deviceRepo repository.DeviceRepository
+	deviceRepo      repository.DeviceRepository
+	assetTagPattern string
+	bulkBatchSize   int
+	suggestions     *suggestionCache
+}
+
+// DeviceServiceOption configures optional behaviour of DeviceServiceImpl
+type DeviceServiceOption func(*DeviceServiceImpl)
+
+// WithAssetTagPattern sets the pattern used to generate asset tags, see models.FormatAssetTag
+func WithAssetTagPattern(pattern string) DeviceServiceOption {
+	return func(s *DeviceServiceImpl) {
+		s.assetTagPattern = pattern
+	}
+}
+
+// WithBulkBatchSize sets the number of devices a bulk update changes per transaction
+func WithBulkBatchSize(size int) DeviceServiceOption {
+	return func(s *DeviceServiceImpl) {
+		if size > 0 {
+			s.bulkBatchSize = size
+		}
+	}
 }
 
 // NewDeviceService creates a new device service
-func NewDeviceService(deviceRepo repository.DeviceRepository) DeviceService {
-	return &DeviceServiceImpl{
-		deviceRepo: deviceRepo,
+func NewDeviceService(deviceRepo repository.DeviceRepository, opts ...DeviceServiceOption) DeviceService {
+	s := &DeviceServiceImpl{
+		deviceRepo:      deviceRepo,
+		assetTagPattern: DefaultAssetTagPattern,
+		bulkBatchSize:   DefaultBulkBatchSize,
+		suggestions:     newSuggestionCache(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // CreateDevice creates a new device
 func (s *DeviceServiceImpl) CreateDevice(ctx context.Context, req CreateDeviceRequest) (*models.Device, error) {
+	defer s.suggestions.invalidate()
+
+	return s.createDevice(ctx, s.deviceRepo, req)
+}
+
+// createDevice validates and saves a new device through repo
+func (s *DeviceServiceImpl) createDevice(ctx context.Context, repo repository.DeviceRepository, req CreateDeviceRequest) (*models.Device, error) {
 	// Validate input
 	if err := s.validateCreateRequest(req); err != nil {
 		return nil, fmt.Errorf("validation failed: %w", err)
@@ -62,9 +209,24 @@ func (s *DeviceServiceImpl) CreateDevice(ctx context.Context, req CreateDeviceRe
 	if err != nil {
 		return nil, fmt.Errorf("failed to create device entity: %w", err)
 	}
+	device.SerialNumber = strings.TrimSpace(req.SerialNumber)
+	err = device.UpdateProcurement(req.PurchaseDate, req.PurchaseCost, strings.TrimSpace(req.Vendor), req.WarrantyExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Assign a human-readable asset tag
+	seq, err := repo.NextAssetTagSequence(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate asset tag: %w", err)
+	}
+	device.AssetTag, err = models.FormatAssetTag(s.assetTagPattern, seq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate asset tag: %w", err)
+	}
 
 	// Save to repository
-	if err := s.deviceRepo.Create(ctx, device); err != nil {
+	if err := repo.Create(ctx, device); err != nil {
 		return nil, fmt.Errorf("failed to save device: %w", err)
 	}
 	return device, nil
@@ -83,6 +245,52 @@ func (s *DeviceServiceImpl) GetDevice(ctx context.Context, id string) (*models.D
 	return device, nil
 }
 
+// GetDeviceFields retrieves a device by its ID with only the given fields loaded
+func (s *DeviceServiceImpl) GetDeviceFields(ctx context.Context, id string, fields []string) (*models.Device, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+	fields, err := normalizeFields(fields)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	if len(fields) == 0 {
+		return s.GetDevice(ctx, id)
+	}
+
+	device, err := s.deviceRepo.GetFieldsByID(ctx, id, fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return device, nil
+}
+
+// GetDeviceBySerialNumber retrieves a device by brand and serial number
+func (s *DeviceServiceImpl) GetDeviceBySerialNumber(ctx context.Context, brand, serialNumber string) (*models.Device, error) {
+	if strings.TrimSpace(brand) == "" || strings.TrimSpace(serialNumber) == "" {
+		return nil, fmt.Errorf("brand and serial number cannot be empty")
+	}
+
+	device, err := s.deviceRepo.GetBySerialNumber(ctx, brand, serialNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return device, nil
+}
+
+// GetDeviceByAssetTag retrieves a device by its asset tag
+func (s *DeviceServiceImpl) GetDeviceByAssetTag(ctx context.Context, assetTag string) (*models.Device, error) {
+	if strings.TrimSpace(assetTag) == "" {
+		return nil, fmt.Errorf("asset tag cannot be empty")
+	}
+
+	device, err := s.deviceRepo.GetByAssetTag(ctx, assetTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return device, nil
+}
+
 // GetAllDevices retrieves all devices
 func (s *DeviceServiceImpl) GetAllDevices(ctx context.Context) ([]*models.Device, error) {
 	devices, err := s.deviceRepo.GetAll(ctx)
@@ -92,6 +300,41 @@ func (s *DeviceServiceImpl) GetAllDevices(ctx context.Context) ([]*models.Device
 	return devices, nil
 }
 
+// ListDevices retrieves a page of the devices matching the filter in the
+// requested order, loading only the requested fields
+func (s *DeviceServiceImpl) ListDevices(ctx context.Context, req ListDevicesRequest) ([]*models.Device, error) {
+	if err := req.Filter.validate(); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	fields, err := normalizeFields(req.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	sort, err := parseSort(req.Sort)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	// A zero limit means none was given
+	if req.Limit < 0 || req.Limit > MaxListLimit {
+		return nil, fmt.Errorf("validation failed: limit must be between 1 and %d", MaxListLimit)
+	}
+	if req.Offset < 0 {
+		return nil, fmt.Errorf("validation failed: offset cannot be negative")
+	}
+
+	devices, err := s.deviceRepo.List(ctx, repository.DeviceQuery{
+		Filter: req.Filter.repositoryFilter(),
+		Fields: fields,
+		Sort:   sort,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
+}
+
 // GetDevicesByBrand retrieves devices by brand
 func (s *DeviceServiceImpl) GetDevicesByBrand(ctx context.Context, brand string) ([]*models.Device, error) {
 	if strings.TrimSpace(brand) == "" {
@@ -118,17 +361,110 @@ func (s *DeviceServiceImpl) GetDevicesByState(ctx context.Context, state models.
 	return devices, nil
 }
 
-// UpdateDevice updates an existing device
+// GetDevicesByLocation retrieves devices in a location and all of its sub-locations
+func (s *DeviceServiceImpl) GetDevicesByLocation(ctx context.Context, locationID string) ([]*models.Device, error) {
+	if strings.TrimSpace(locationID) == "" {
+		return nil, fmt.Errorf("location ID cannot be empty")
+	}
+
+	devices, err := s.deviceRepo.GetByLocation(ctx, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices by location: %w", err)
+	}
+	return devices, nil
+}
+
+// ExportDevices calls fn for every device matching filter, streaming them from the repository
+func (s *DeviceServiceImpl) ExportDevices(ctx context.Context, filter DeviceFilter, fn func(device *models.Device) error) error {
+	if err := filter.validate(); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	if err := s.deviceRepo.Stream(ctx, filter.repositoryFilter(), fn); err != nil {
+		return fmt.Errorf("failed to export devices: %w", err)
+	}
+	return nil
+}
+
+// GetDevicesWithExpiringWarranty retrieves devices whose warranty expires within the next days
+func (s *DeviceServiceImpl) GetDevicesWithExpiringWarranty(ctx context.Context, days int) ([]*models.Device, error) {
+	if days < 0 {
+		return nil, fmt.Errorf("validation failed: days cannot be negative")
+	}
+
+	today := models.Today()
+	devices, err := s.deviceRepo.GetByWarrantyExpiry(ctx, today, models.NewDate(today.AddDate(0, 0, days)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices by warranty expiry: %w", err)
+	}
+	return devices, nil
+}
+
+// GetDeviceValuation calculates the depreciated book value of a device
+func (s *DeviceServiceImpl) GetDeviceValuation(ctx context.Context, id string, req ValuationRequest) (*models.Valuation, error) {
+	device, err := s.GetDevice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if device.PurchaseDate == nil || device.PurchaseCost == nil {
+		return nil, fmt.Errorf("validation failed: device has no purchase date or cost")
+	}
+
+	params := models.DepreciationParams{
+		Method:          req.Method,
+		PurchaseDate:    *device.PurchaseDate,
+		PurchaseCost:    *device.PurchaseCost,
+		SalvageValue:    req.SalvageValue,
+		UsefulLifeYears: req.UsefulLifeYears,
+		AsOf:            models.Today(),
+	}
+	if params.Method == "" {
+		params.Method = models.DepreciationStraightLine
+	}
+	if params.UsefulLifeYears == 0 {
+		params.UsefulLifeYears = DefaultUsefulLifeYears
+	}
+	if req.AsOf != nil {
+		params.AsOf = *req.AsOf
+	}
+
+	valuation, err := models.CalculateValuation(params)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	valuation.DeviceID = device.ID
+	return valuation, nil
+}
+
+// UpdateDevice updates an existing device. State changes on a kit cascade to
+// its attached components within the same transaction.
 func (s *DeviceServiceImpl) UpdateDevice(ctx context.Context, id string, req UpdateDeviceRequest) (*models.Device, error) {
+	defer s.suggestions.invalidate()
+
 	if strings.TrimSpace(id) == "" {
 		return nil, fmt.Errorf("device ID cannot be empty")
 	}
 
+	var device *models.Device
+	err := s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		var err error
+		device, err = s.updateDevice(ctx, repo, id, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// updateDevice applies req to a device through repo, which must be bound to a transaction
+func (s *DeviceServiceImpl) updateDevice(ctx context.Context, repo repository.DeviceRepository, id string, req UpdateDeviceRequest) (*models.Device, error) {
 	// Get existing device
-	device, err := s.deviceRepo.GetByID(ctx, id)
+	device, err := repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get device: %w", err)
 	}
+	previousState := device.State
 
 	// Apply updates
 	if err := s.applyUpdates(device, req); err != nil {
@@ -136,36 +472,289 @@ func (s *DeviceServiceImpl) UpdateDevice(ctx context.Context, id string, req Upd
 	}
 
 	// Save updated device
-	if err := s.deviceRepo.Update(ctx, device); err != nil {
+	if err := repo.Update(ctx, device); err != nil {
 		return nil, fmt.Errorf("failed to update device: %w", err)
 	}
+
+	if device.State != previousState {
+		if err := s.cascadeState(ctx, repo, device); err != nil {
+			return nil, err
+		}
+	}
 	return device, nil
 }
 
-// DeleteDevice deletes a device
+// DeleteDevice deletes a device. The device is locked while checking that no
+// components are attached, so that none can be attached before it is gone.
 func (s *DeviceServiceImpl) DeleteDevice(ctx context.Context, id string) error {
+	defer s.suggestions.invalidate()
+
+	return s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		return s.deleteDevice(ctx, repo, id)
+	})
+}
+
+// deleteDevice checks the deletion rules and deletes a device through repo
+func (s *DeviceServiceImpl) deleteDevice(ctx context.Context, repo repository.DeviceRepository, id string) error {
 	if strings.TrimSpace(id) == "" {
 		return fmt.Errorf("device ID cannot be empty")
 	}
 
-	// Get device to check if it can be deleted
-	device, err := s.deviceRepo.GetByID(ctx, id)
+	// Lock the device to check if it can be deleted
+	device, err := repo.GetByIDForUpdate(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to get device: %w", err)
 	}
 
 	// Check business rules
 	if !device.CanDelete() {
+		if device.State == models.StateMaintenance {
+			return fmt.Errorf("cannot delete device under maintenance")
+		}
 		return fmt.Errorf("cannot delete device in use")
 	}
 
+	children, err := repo.GetChildren(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get child devices: %w", err)
+	}
+	if len(children) > 0 {
+		return fmt.Errorf("cannot delete device with %d attached children", len(children))
+	}
+
 	// Delete device
-	if err := s.deviceRepo.Delete(ctx, id); err != nil {
+	if err := repo.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to delete device: %w", err)
 	}
 	return nil
 }
 
+// MoveDevice moves a device to another location, recording where it came from
+func (s *DeviceServiceImpl) MoveDevice(ctx context.Context, id string, req MoveDeviceRequest) (*models.DeviceMove, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+	if strings.TrimSpace(req.LocationID) == "" {
+		return nil, fmt.Errorf("validation failed: location ID is required")
+	}
+
+	// Get device to check that it is not already there
+	device, err := s.deviceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	if device.LocationID != nil && *device.LocationID == req.LocationID {
+		return nil, fmt.Errorf("validation failed: device is already in location %s", req.LocationID)
+	}
+	if device.ParentID != nil {
+		return nil, fmt.Errorf("validation failed: component cannot be moved apart from its parent %s", *device.ParentID)
+	}
+
+	// Components travel with their kit
+	var move *models.DeviceMove
+	err = s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		var err error
+		move, err = repo.MoveToLocation(ctx, id, req.LocationID)
+		if err != nil {
+			return fmt.Errorf("failed to move device: %w", err)
+		}
+
+		children, err := repo.GetChildren(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get child devices: %w", err)
+		}
+		for _, child := range children {
+			if child.LocationID != nil && *child.LocationID == req.LocationID {
+				continue
+			}
+			if _, err := repo.MoveToLocation(ctx, child.ID, req.LocationID); err != nil {
+				return fmt.Errorf("failed to move child device %s: %w", child.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return move, nil
+}
+
+// GetDeviceMoves retrieves the location history of a device
+func (s *DeviceServiceImpl) GetDeviceMoves(ctx context.Context, id string) ([]*models.DeviceMove, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+
+	exists, err := s.deviceRepo.Exists(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check device: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("device with ID %s not found", id)
+	}
+
+	moves, err := s.deviceRepo.GetMoves(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device moves: %w", err)
+	}
+	return moves, nil
+}
+
+// GetDeviceChildren retrieves the components attached to a device
+func (s *DeviceServiceImpl) GetDeviceChildren(ctx context.Context, id string) ([]*models.Device, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+
+	exists, err := s.deviceRepo.Exists(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check device: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("device with ID %s not found", id)
+	}
+
+	children, err := s.deviceRepo.GetChildren(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get child devices: %w", err)
+	}
+	return children, nil
+}
+
+// AttachChild attaches a device to a parent as one of its components
+func (s *DeviceServiceImpl) AttachChild(ctx context.Context, parentID string, req AttachChildRequest) (*models.Device, error) {
+	if strings.TrimSpace(parentID) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+	if strings.TrimSpace(req.ChildID) == "" {
+		return nil, fmt.Errorf("validation failed: child device ID is required")
+	}
+
+	// Lock the parent before the child, so that neither can be deleted or
+	// attached elsewhere in the meantime
+	var child *models.Device
+	err := s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		parent, err := repo.GetByIDForUpdate(ctx, parentID)
+		if err != nil {
+			return fmt.Errorf("failed to get device: %w", err)
+		}
+		child, err = repo.GetByIDForUpdate(ctx, req.ChildID)
+		if err != nil {
+			return fmt.Errorf("failed to get child device: %w", err)
+		}
+
+		grandchildren, err := repo.GetChildren(ctx, child.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get child devices: %w", err)
+		}
+		if len(grandchildren) > 0 {
+			return fmt.Errorf("validation failed: device %s has its own components", child.ID)
+		}
+		// Components are serviced with their kit
+		if parent.State == models.StateMaintenance {
+			return fmt.Errorf("validation failed: cannot attach to a device under maintenance")
+		}
+		if err := child.AttachTo(parent); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+
+		if err := repo.Update(ctx, child); err != nil {
+			return fmt.Errorf("failed to update device: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// DetachChild detaches a component from its parent
+func (s *DeviceServiceImpl) DetachChild(ctx context.Context, parentID, childID string) error {
+	if strings.TrimSpace(parentID) == "" || strings.TrimSpace(childID) == "" {
+		return fmt.Errorf("device ID cannot be empty")
+	}
+
+	// Lock the parent before the child, like AttachChild and state cascades
+	return s.deviceRepo.WithTx(ctx, func(repo repository.DeviceRepository) error {
+		parent, err := repo.GetByIDForUpdate(ctx, parentID)
+		if err != nil {
+			return fmt.Errorf("failed to get device: %w", err)
+		}
+		child, err := repo.GetByIDForUpdate(ctx, childID)
+		if err != nil {
+			return fmt.Errorf("failed to get child device: %w", err)
+		}
+		if child.ParentID == nil || *child.ParentID != parentID {
+			return fmt.Errorf("child device %s not found under device %s", childID, parentID)
+		}
+		// A component detached during maintenance would have no ticket to
+		// release it
+		if parent.State == models.StateMaintenance {
+			return fmt.Errorf("validation failed: cannot detach a component while its kit is under maintenance")
+		}
+
+		child.Detach()
+		if err := repo.Update(ctx, child); err != nil {
+			return fmt.Errorf("failed to update device: %w", err)
+		}
+		return nil
+	})
+}
+
+// cascadeState propagates the state of a kit to all of its components
+func (s *DeviceServiceImpl) cascadeState(ctx context.Context, repo repository.DeviceRepository, parent *models.Device) error {
+	children, err := repo.GetChildren(ctx, parent.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get child devices: %w", err)
+	}
+
+	for _, child := range children {
+		if child.State == parent.State {
+			continue
+		}
+		if err := child.UpdateState(parent.State); err != nil {
+			return fmt.Errorf("cannot update child device %s: %w", child.ID, err)
+		}
+		if err := repo.Update(ctx, child); err != nil {
+			return fmt.Errorf("failed to update child device %s: %w", child.ID, err)
+		}
+	}
+	return nil
+}
+
+// normalizeFields checks requested device fields and puts them in representation order
+func normalizeFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return models.ParseDeviceFields(strings.Join(fields, ","))
+}
+
+// parseSort parses a sort parameter such as "name,-creation_time" against the
+// sortable fields. A field may appear only once.
+func parseSort(sort string) ([]repository.DeviceSort, error) {
+	if strings.TrimSpace(sort) == "" {
+		return nil, nil
+	}
+
+	var terms []repository.DeviceSort
+	seen := make(map[string]bool)
+	for _, term := range strings.Split(sort, ",") {
+		term = strings.TrimSpace(term)
+		field, descending := strings.CutPrefix(term, "-")
+		if !slices.Contains(repository.SortableDeviceFields, field) {
+			return nil, fmt.Errorf("cannot sort by %q, sortable fields are %s", term, strings.Join(repository.SortableDeviceFields, ", "))
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("sort field %s is repeated", field)
+		}
+		seen[field] = true
+		terms = append(terms, repository.DeviceSort{Field: field, Descending: descending})
+	}
+	return terms, nil
+}
+
 // validateCreateRequest validates the create device request
 func (s *DeviceServiceImpl) validateCreateRequest(req CreateDeviceRequest) error {
 	if strings.TrimSpace(req.Name) == "" {
@@ -177,6 +766,9 @@ func (s *DeviceServiceImpl) validateCreateRequest(req CreateDeviceRequest) error
 	if !req.State.IsValid() {
 		return fmt.Errorf("invalid device state: %s", req.State)
 	}
+	if req.State == models.StateMaintenance {
+		return fmt.Errorf("devices cannot be created under maintenance")
+	}
 	return nil
 }
 
@@ -189,6 +781,33 @@ func (s *DeviceServiceImpl) applyUpdates(device *models.Device, req UpdateDevice
 		}
 	}
 
+	// Update serial number if provided
+	if req.SerialNumber != nil {
+		device.SerialNumber = strings.TrimSpace(*req.SerialNumber)
+	}
+
+	// Update procurement details if provided
+	if req.PurchaseDate != nil || req.PurchaseCost != nil || req.Vendor != nil || req.WarrantyExpiry != nil {
+		purchaseDate, purchaseCost, vendor, warrantyExpiry := device.PurchaseDate, device.PurchaseCost, device.Vendor, device.WarrantyExpiry
+
+		if req.PurchaseDate != nil {
+			purchaseDate = req.PurchaseDate
+		}
+		if req.PurchaseCost != nil {
+			purchaseCost = req.PurchaseCost
+		}
+		if req.Vendor != nil {
+			vendor = strings.TrimSpace(*req.Vendor)
+		}
+		if req.WarrantyExpiry != nil {
+			warrantyExpiry = req.WarrantyExpiry
+		}
+
+		if err := device.UpdateProcurement(purchaseDate, purchaseCost, vendor, warrantyExpiry); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+	}
+
 	// Update name and brand if provided
 	if req.Name != nil || req.Brand != nil {
 		newName := device.Name
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"fmt"
+)
+
+// MaxStatsBuckets is the largest number of creation buckets a stats request returns
+const MaxStatsBuckets = 1000
+
+// defaultStatsBuckets is the number of buckets, ending today, counted when no
+// range is given
+const defaultStatsBuckets = 30
+
+// StatsRequest selects the creation buckets of a stats request. Zero values
+// default to daily buckets over the last 30 days, or the last 30 buckets
+// before To.
+type StatsRequest struct {
+	Interval models.StatsInterval `json:"interval,omitempty"`
+	From     *models.Date         `json:"from,omitempty"`
+	To       *models.Date         `json:"to,omitempty"`
+}
+
+// GetDeviceStats counts devices by state, by brand and by brand and state, and
+// the devices created in each interval of a range. The range is widened to
+// whole intervals.
+func (s *DeviceServiceImpl) GetDeviceStats(ctx context.Context, req StatsRequest) (*models.DeviceStats, error) {
+	interval := req.Interval
+	if interval == "" {
+		interval = models.IntervalDay
+	}
+	if !interval.IsValid() {
+		return nil, fmt.Errorf("validation failed: invalid interval %q, expected day, week or month", interval)
+	}
+
+	to := models.Today()
+	if req.To != nil {
+		to = *req.To
+	}
+	if req.From != nil && req.From.After(to.Time) {
+		return nil, fmt.Errorf("validation failed: from must not be after to")
+	}
+	end := interval.Next(interval.Truncate(to))
+	start := interval.Truncate(to)
+	if req.From != nil {
+		start = interval.Truncate(*req.From)
+	} else {
+		for range defaultStatsBuckets - 1 {
+			start = interval.Previous(start)
+		}
+	}
+
+	var buckets []models.CreationBucket
+	for bucket := start; bucket.Before(end.Time); bucket = interval.Next(bucket) {
+		if len(buckets) == MaxStatsBuckets {
+			return nil, fmt.Errorf("validation failed: range spans more than %d %ss", MaxStatsBuckets, interval)
+		}
+		buckets = append(buckets, models.CreationBucket{Start: bucket})
+	}
+
+	counts, err := s.deviceRepo.Count(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count devices: %w", err)
+	}
+	created, err := s.deviceRepo.CountCreated(ctx, interval, start.Time, end.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count device creations: %w", err)
+	}
+
+	stats := &models.DeviceStats{
+		ByState:      make(map[models.DeviceState]int),
+		ByBrand:      make(map[string]int),
+		ByBrandState: make(map[string]map[models.DeviceState]int),
+		Created: models.CreationStats{
+			Interval: interval,
+			From:     start,
+			To:       models.NewDate(end.AddDate(0, 0, -1)),
+			Buckets:  buckets,
+		},
+	}
+	for _, count := range counts {
+		switch {
+		case count.Brand == "" && count.State == "":
+			stats.Total = count.Count
+		case count.Brand == "":
+			stats.ByState[count.State] = count.Count
+		case count.State == "":
+			stats.ByBrand[count.Brand] = count.Count
+		default:
+			if stats.ByBrandState[count.Brand] == nil {
+				stats.ByBrandState[count.Brand] = make(map[models.DeviceState]int)
+			}
+			stats.ByBrandState[count.Brand][count.State] = count.Count
+		}
+	}
+
+	// Buckets are ordered and aligned with the ones from the repository
+	i := 0
+	for _, bucket := range created {
+		for i < len(buckets) && buckets[i].Start.Before(bucket.Start.Time) {
+			i++
+		}
+		if i < len(buckets) && buckets[i].Start.Equal(bucket.Start.Time) {
+			buckets[i].Count = bucket.Count
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/repository"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSuggestLimit is the number of suggestions returned when no limit is given
+	DefaultSuggestLimit = 10
+	// MaxSuggestLimit is the largest number of suggestions returned
+	MaxSuggestLimit = 50
+
+	// suggestionCacheTTL bounds how long suggestions are served from the cache,
+	// so that writes made by other instances show up eventually
+	suggestionCacheTTL = time.Minute
+	// maxSuggestionCacheEntries bounds the memory used by the cache
+	maxSuggestionCacheEntries = 1000
+)
+
+// SuggestRequest asks for typeahead suggestions for a device field
+type SuggestRequest struct {
+	Field  string `json:"field" validate:"required"`
+	Prefix string `json:"prefix,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Suggestion is a distinct field value and the number of devices that have it
+type Suggestion struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// SuggestValues returns the most frequent distinct values of a name or brand
+// that start with the prefix, ignoring case. Results are cached until the next
+// device write made through this service.
+func (s *DeviceServiceImpl) SuggestValues(ctx context.Context, req SuggestRequest) ([]Suggestion, error) {
+	if !slices.Contains(repository.SuggestableDeviceFields, req.Field) {
+		return nil, fmt.Errorf("validation failed: suggestions are available for %s", strings.Join(repository.SuggestableDeviceFields, ", "))
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultSuggestLimit
+	}
+	if limit < 0 || limit > MaxSuggestLimit {
+		return nil, fmt.Errorf("validation failed: limit must be between 1 and %d", MaxSuggestLimit)
+	}
+
+	key := suggestionKey{field: req.Field, prefix: strings.ToLower(strings.TrimSpace(req.Prefix)), limit: limit}
+	suggestions, generation, ok := s.suggestions.get(key)
+	if ok {
+		return suggestions, nil
+	}
+
+	values, err := s.deviceRepo.Suggest(ctx, key.field, key.prefix, key.limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest values: %w", err)
+	}
+	suggestions = make([]Suggestion, len(values))
+	for i, value := range values {
+		suggestions[i] = Suggestion{Value: value.Value, Count: value.Count}
+	}
+	s.suggestions.put(key, generation, suggestions)
+	return suggestions, nil
+}
+
+type suggestionKey struct {
+	field  string
+	prefix string
+	limit  int
+}
+
+type suggestionEntry struct {
+	suggestions []Suggestion
+	expires     time.Time
+}
+
+// suggestionCache keeps suggestion results until the devices change. Every
+// invalidation starts a new generation, and results computed during an older
+// generation are not stored, so a lookup racing with a write cannot bring
+// stale values back.
+type suggestionCache struct {
+	mu         sync.Mutex
+	generation uint64
+	entries    map[suggestionKey]suggestionEntry
+}
+
+func newSuggestionCache() *suggestionCache {
+	return &suggestionCache{entries: make(map[suggestionKey]suggestionEntry)}
+}
+
+// get returns the cached suggestions for key, or the current generation to pass to put
+func (c *suggestionCache) get(key suggestionKey) ([]Suggestion, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.generation, false
+	}
+	return entry.suggestions, c.generation, true
+}
+
+// put stores suggestions computed during generation
+func (c *suggestionCache) put(key suggestionKey, generation uint64, suggestions []Suggestion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if len(c.entries) >= maxSuggestionCacheEntries {
+		clear(c.entries)
+	}
+	c.entries[key] = suggestionEntry{suggestions: suggestions, expires: time.Now().Add(suggestionCacheTTL)}
+}
+
+// invalidate drops every cached result
+func (c *suggestionCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	clear(c.entries)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultUtilizationDays is the length of the report period, ending today,
+// when no period is given
+const defaultUtilizationDays = 30
+
+// UtilizationRequest selects the period of a utilization report. Zero values
+// default to the 30 days ending on To, which defaults to today.
+type UtilizationRequest struct {
+	From *models.Date `json:"from,omitempty"`
+	To   *models.Date `json:"to,omitempty"`
+}
+
+// GetUtilizationReport computes, per device and per brand, the share of the
+// time from the start of From to the end of To that devices spent in use. A
+// device only counts for the part of the period after its creation, and the
+// period ends now at the latest.
+func (s *DeviceServiceImpl) GetUtilizationReport(ctx context.Context, req UtilizationRequest) (*models.UtilizationReport, error) {
+	to := models.Today()
+	if req.To != nil {
+		to = *req.To
+	}
+	from := models.NewDate(to.AddDate(0, 0, -(defaultUtilizationDays - 1)))
+	if req.From != nil {
+		from = *req.From
+	}
+	if from.After(to.Time) {
+		return nil, fmt.Errorf("validation failed: from must not be after to")
+	}
+
+	start, end := from.Time, to.AddDate(0, 0, 1)
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("validation failed: period must start in the past")
+	}
+
+	changes, err := s.deviceRepo.GetStateChanges(ctx, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state changes: %w", err)
+	}
+	devices := make(map[string]*models.DeviceUtilization)
+	var order []string
+	// state and since are the state of the current device and when it was entered
+	var state *models.DeviceState
+	var since time.Time
+	for i, change := range changes {
+		utilization := devices[change.DeviceID]
+		if utilization == nil {
+			utilization = &models.DeviceUtilization{DeviceID: change.DeviceID}
+			devices[change.DeviceID] = utilization
+			order = append(order, change.DeviceID)
+			state = nil
+		}
+
+		at := change.ChangedAt
+		if at.Before(start) {
+			at = start
+		}
+		if state != nil {
+			addStateDuration(utilization, *state, at.Sub(since))
+		}
+		state, since = &change.ToState, at
+
+		if i == len(changes)-1 || changes[i+1].DeviceID != change.DeviceID {
+			addStateDuration(utilization, *state, end.Sub(since))
+		}
+	}
+
+	// Name and brand are taken from the devices as they are now
+	current, err := s.deviceRepo.GetByIDs(ctx, order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+	for _, device := range current {
+		utilization := devices[device.ID]
+		utilization.Name, utilization.Brand = device.Name, device.Brand
+	}
+
+	report := &models.UtilizationReport{
+		From:    from,
+		To:      to,
+		Devices: []models.DeviceUtilization{},
+		Brands:  []models.BrandUtilization{},
+	}
+	brands := make(map[string]*models.BrandUtilization)
+	for _, id := range order {
+		utilization := devices[id]
+		if utilization.TrackedSeconds == 0 {
+			continue
+		}
+		utilization.Utilization = utilization.InUseSeconds / utilization.TrackedSeconds
+		report.Devices = append(report.Devices, *utilization)
+
+		brand := brands[utilization.Brand]
+		if brand == nil {
+			brand = &models.BrandUtilization{Brand: utilization.Brand}
+			brands[utilization.Brand] = brand
+		}
+		brand.Devices++
+		brand.TrackedSeconds += utilization.TrackedSeconds
+		brand.InUseSeconds += utilization.InUseSeconds
+	}
+	for _, brand := range brands {
+		brand.Utilization = brand.InUseSeconds / brand.TrackedSeconds
+		report.Brands = append(report.Brands, *brand)
+	}
+	sort.Slice(report.Brands, func(i, j int) bool { return report.Brands[i].Brand < report.Brands[j].Brand })
+	return report, nil
+}
+
+// addStateDuration adds time spent in state to a device's utilization
+func addStateDuration(utilization *models.DeviceUtilization, state models.DeviceState, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	utilization.TrackedSeconds += duration.Seconds()
+	if state == models.StateInUse {
+		utilization.InUseSeconds += duration.Seconds()
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// LocationService defines the interface for location business logic operations
+type LocationService interface {
+	CreateLocation(ctx context.Context, req CreateLocationRequest) (*models.Location, error)
+	GetLocation(ctx context.Context, id string) (*models.Location, error)
+	GetAllLocations(ctx context.Context) ([]*models.Location, error)
+	GetChildLocations(ctx context.Context, id string) ([]*models.Location, error)
+	UpdateLocation(ctx context.Context, id string, req UpdateLocationRequest) (*models.Location, error)
+	DeleteLocation(ctx context.Context, id string) error
+}
+
+// CreateLocationRequest represents the request to create a new location
+type CreateLocationRequest struct {
+	Name     string              `json:"name" validate:"required"`
+	Type     models.LocationType `json:"type" validate:"required"`
+	ParentID *string             `json:"parent_id,omitempty"`
+}
+
+// UpdateLocationRequest represents the request to update a location
+type UpdateLocationRequest struct {
+	Name     *string `json:"name,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+// LocationServiceImpl implements LocationService
+type LocationServiceImpl struct {
+	locationRepo repository.LocationRepository
+}
+
+// NewLocationService creates a new location service
+func NewLocationService(locationRepo repository.LocationRepository) LocationService {
+	return &LocationServiceImpl{
+		locationRepo: locationRepo,
+	}
+}
+
+// CreateLocation creates a new location
+func (s *LocationServiceImpl) CreateLocation(ctx context.Context, req CreateLocationRequest) (*models.Location, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("validation failed: location name is required")
+	}
+
+	location, err := models.NewLocation(uuid.New().String(), strings.TrimSpace(req.Name), req.Type, req.ParentID)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if location.ParentID != nil {
+		if err := s.checkParent(ctx, location, *location.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.locationRepo.Create(ctx, location); err != nil {
+		return nil, fmt.Errorf("failed to save location: %w", err)
+	}
+	return location, nil
+}
+
+// GetLocation retrieves a location by ID
+func (s *LocationServiceImpl) GetLocation(ctx context.Context, id string) (*models.Location, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("location ID cannot be empty")
+	}
+
+	location, err := s.locationRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location: %w", err)
+	}
+	return location, nil
+}
+
+// GetAllLocations retrieves all locations
+func (s *LocationServiceImpl) GetAllLocations(ctx context.Context) ([]*models.Location, error) {
+	locations, err := s.locationRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all locations: %w", err)
+	}
+	return locations, nil
+}
+
+// GetChildLocations retrieves the direct children of a location
+func (s *LocationServiceImpl) GetChildLocations(ctx context.Context, id string) ([]*models.Location, error) {
+	if _, err := s.GetLocation(ctx, id); err != nil {
+		return nil, err
+	}
+
+	locations, err := s.locationRepo.GetChildren(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get child locations: %w", err)
+	}
+	return locations, nil
+}
+
+// UpdateLocation renames a location or attaches it to a different parent
+func (s *LocationServiceImpl) UpdateLocation(ctx context.Context, id string, req UpdateLocationRequest) (*models.Location, error) {
+	location, err := s.GetLocation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, fmt.Errorf("validation failed: location name cannot be empty")
+		}
+		location.Name = name
+	}
+
+	if req.ParentID != nil {
+		if err := s.checkParent(ctx, location, *req.ParentID); err != nil {
+			return nil, err
+		}
+		location.ParentID = req.ParentID
+	}
+
+	if err := s.locationRepo.Update(ctx, location); err != nil {
+		return nil, fmt.Errorf("failed to update location: %w", err)
+	}
+	return location, nil
+}
+
+// DeleteLocation deletes a location that no longer contains locations or devices
+func (s *LocationServiceImpl) DeleteLocation(ctx context.Context, id string) error {
+	if strings.TrimSpace(id) == "" {
+		return fmt.Errorf("location ID cannot be empty")
+	}
+
+	if err := s.locationRepo.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete location: %w", err)
+	}
+	return nil
+}
+
+// checkParent verifies that parentID exists and sits one level above location.
+// Because every level has a fixed parent type the tree can never contain cycles.
+func (s *LocationServiceImpl) checkParent(ctx context.Context, location *models.Location, parentID string) error {
+	parent, err := s.locationRepo.GetByID(ctx, parentID)
+	if err != nil {
+		return fmt.Errorf("failed to get parent location: %w", err)
+	}
+	if !location.CanBeChildOf(parent) {
+		return fmt.Errorf("validation failed: a %s cannot be placed in a %s", location.Type, parent.Type)
+	}
+	return nil
+}
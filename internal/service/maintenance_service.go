@@ -0,0 +1,447 @@
+package service
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaintenanceService defines the interface for maintenance business logic operations
+type MaintenanceService interface {
+	CreateTicket(ctx context.Context, deviceID string, req CreateTicketRequest) (*models.MaintenanceTicket, error)
+	GetTicket(ctx context.Context, id string) (*models.MaintenanceTicket, error)
+	GetTickets(ctx context.Context, status models.MaintenanceStatus) ([]*models.MaintenanceTicket, error)
+	GetDeviceTickets(ctx context.Context, deviceID string) ([]*models.MaintenanceTicket, error)
+	UpdateTicket(ctx context.Context, id string, req UpdateTicketRequest) (*models.MaintenanceTicket, error)
+	CreateSchedule(ctx context.Context, deviceID string, req CreateScheduleRequest) (*models.MaintenanceSchedule, error)
+	GetDeviceSchedules(ctx context.Context, deviceID string) ([]*models.MaintenanceSchedule, error)
+	DeleteSchedule(ctx context.Context, id string) error
+	GenerateDueTickets(ctx context.Context) ([]*models.MaintenanceTicket, error)
+}
+
+// CreateTicketRequest represents the request to open a maintenance ticket
+type CreateTicketRequest struct {
+	Notes   string       `json:"notes,omitempty"`
+	Cost    *float64     `json:"cost,omitempty"`
+	DueDate *models.Date `json:"due_date,omitempty"`
+}
+
+// UpdateTicketRequest represents the request to update a maintenance ticket
+type UpdateTicketRequest struct {
+	Status *models.MaintenanceStatus `json:"status,omitempty"`
+	Notes  *string                   `json:"notes,omitempty"`
+	Cost   *float64                  `json:"cost,omitempty"`
+}
+
+// CreateScheduleRequest represents the request to create a recurring maintenance schedule
+type CreateScheduleRequest struct {
+	Description  string       `json:"description" validate:"required"`
+	IntervalDays int          `json:"interval_days" validate:"required"`
+	FirstDue     *models.Date `json:"first_due,omitempty"`
+}
+
+// MaintenanceServiceImpl implements MaintenanceService
+type MaintenanceServiceImpl struct {
+	maintenanceRepo repository.MaintenanceRepository
+	deviceRepo      repository.DeviceRepository
+	publisher       EventPublisher
+}
+
+// MaintenanceServiceOption configures a MaintenanceServiceImpl
+type MaintenanceServiceOption func(*MaintenanceServiceImpl)
+
+// WithMaintenanceEventPublisher publishes an event for every device taken into
+// or out of maintenance, once the transaction doing so has committed
+func WithMaintenanceEventPublisher(publisher EventPublisher) MaintenanceServiceOption {
+	return func(s *MaintenanceServiceImpl) {
+		s.publisher = publisher
+	}
+}
+
+// NewMaintenanceService creates a new maintenance service
+func NewMaintenanceService(maintenanceRepo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository, opts ...MaintenanceServiceOption) MaintenanceService {
+	s := &MaintenanceServiceImpl{
+		maintenanceRepo: maintenanceRepo,
+		deviceRepo:      deviceRepo,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// CreateTicket opens a maintenance ticket and takes the device out of circulation
+func (s *MaintenanceServiceImpl) CreateTicket(ctx context.Context, deviceID string, req CreateTicketRequest) (*models.MaintenanceTicket, error) {
+	if strings.TrimSpace(deviceID) == "" {
+		return nil, fmt.Errorf("device ID cannot be empty")
+	}
+
+	ticket, err := models.NewMaintenanceTicket(uuid.New().String(), deviceID, strings.TrimSpace(req.Notes), req.DueDate)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	if req.Cost != nil {
+		if err := ticket.UpdateCost(*req.Cost); err != nil {
+			return nil, fmt.Errorf("validation failed: %w", err)
+		}
+	}
+
+	err = s.withTx(ctx, func(repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository) error {
+		return s.openTicket(ctx, repo, deviceRepo, ticket)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// GetTicket retrieves a maintenance ticket by ID
+func (s *MaintenanceServiceImpl) GetTicket(ctx context.Context, id string) (*models.MaintenanceTicket, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("ticket ID cannot be empty")
+	}
+
+	ticket, err := s.maintenanceRepo.GetTicketByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// GetTickets retrieves all maintenance tickets, optionally filtered by status
+func (s *MaintenanceServiceImpl) GetTickets(ctx context.Context, status models.MaintenanceStatus) ([]*models.MaintenanceTicket, error) {
+	if status == "" {
+		tickets, err := s.maintenanceRepo.GetAllTickets(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get maintenance tickets: %w", err)
+		}
+		return tickets, nil
+	}
+
+	if !status.IsValid() {
+		return nil, fmt.Errorf("invalid maintenance status: %s", status)
+	}
+	tickets, err := s.maintenanceRepo.GetTicketsByStatus(ctx, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+// GetDeviceTickets retrieves the maintenance history of a device
+func (s *MaintenanceServiceImpl) GetDeviceTickets(ctx context.Context, deviceID string) ([]*models.MaintenanceTicket, error) {
+	if err := s.checkDevice(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
+	tickets, err := s.maintenanceRepo.GetTicketsByDevice(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+// UpdateTicket updates a ticket. Closing the last active ticket of a device
+// returns the device to the state it was in before its maintenance.
+func (s *MaintenanceServiceImpl) UpdateTicket(ctx context.Context, id string, req UpdateTicketRequest) (*models.MaintenanceTicket, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("ticket ID cannot be empty")
+	}
+
+	var ticket *models.MaintenanceTicket
+	err := s.withTx(ctx, func(repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository) error {
+		var err error
+		ticket, err = repo.GetTicketByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get maintenance ticket: %w", err)
+		}
+		wasActive := ticket.Status.IsActive()
+
+		if req.Status != nil {
+			if err := ticket.UpdateStatus(*req.Status); err != nil {
+				return fmt.Errorf("validation failed: %w", err)
+			}
+		}
+		if req.Notes != nil {
+			ticket.Notes = strings.TrimSpace(*req.Notes)
+		}
+		if req.Cost != nil {
+			if err := ticket.UpdateCost(*req.Cost); err != nil {
+				return fmt.Errorf("validation failed: %w", err)
+			}
+		}
+
+		if err := repo.UpdateTicket(ctx, ticket); err != nil {
+			return fmt.Errorf("failed to update maintenance ticket: %w", err)
+		}
+
+		if wasActive && !ticket.Status.IsActive() {
+			return s.releaseDevice(ctx, repo, deviceRepo, ticket.DeviceID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// CreateSchedule creates a recurring maintenance schedule for a device
+func (s *MaintenanceServiceImpl) CreateSchedule(ctx context.Context, deviceID string, req CreateScheduleRequest) (*models.MaintenanceSchedule, error) {
+	if err := s.checkDevice(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
+	firstDue := models.NewDate(models.Today().AddDate(0, 0, req.IntervalDays))
+	if req.FirstDue != nil {
+		firstDue = *req.FirstDue
+	}
+
+	schedule, err := models.NewMaintenanceSchedule(uuid.New().String(), deviceID, strings.TrimSpace(req.Description), req.IntervalDays, firstDue)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if err := s.maintenanceRepo.CreateSchedule(ctx, schedule); err != nil {
+		return nil, fmt.Errorf("failed to save maintenance schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// GetDeviceSchedules retrieves the maintenance schedules of a device
+func (s *MaintenanceServiceImpl) GetDeviceSchedules(ctx context.Context, deviceID string) ([]*models.MaintenanceSchedule, error) {
+	if err := s.checkDevice(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
+	schedules, err := s.maintenanceRepo.GetSchedulesByDevice(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule deletes a maintenance schedule
+func (s *MaintenanceServiceImpl) DeleteSchedule(ctx context.Context, id string) error {
+	if strings.TrimSpace(id) == "" {
+		return fmt.Errorf("schedule ID cannot be empty")
+	}
+
+	if err := s.maintenanceRepo.DeleteSchedule(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete maintenance schedule: %w", err)
+	}
+	return nil
+}
+
+// GenerateDueTickets opens a ticket for every schedule that is due and moves
+// each schedule to its next due date
+func (s *MaintenanceServiceImpl) GenerateDueTickets(ctx context.Context) ([]*models.MaintenanceTicket, error) {
+	today := models.Today()
+
+	var tickets []*models.MaintenanceTicket
+	err := s.withTx(ctx, func(repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository) error {
+		schedules, err := repo.GetDueSchedules(ctx, today)
+		if err != nil {
+			return fmt.Errorf("failed to get due maintenance schedules: %w", err)
+		}
+
+		for _, schedule := range schedules {
+			dueDate := schedule.NextDue
+			ticket, err := models.NewMaintenanceTicket(uuid.New().String(), schedule.DeviceID, schedule.Description, &dueDate)
+			if err != nil {
+				return fmt.Errorf("failed to create maintenance ticket entity: %w", err)
+			}
+			ticket.ScheduleID = &schedule.ID
+
+			if err := s.openTicket(ctx, repo, deviceRepo, ticket); err != nil {
+				return err
+			}
+
+			schedule.Advance(today)
+			if err := repo.UpdateSchedule(ctx, schedule); err != nil {
+				return fmt.Errorf("failed to update maintenance schedule: %w", err)
+			}
+			tickets = append(tickets, ticket)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+// withTx runs fn in a transaction of the maintenance repository. With a
+// publisher, the device changes made through deviceRepo are published once the
+// transaction has committed.
+func (s *MaintenanceServiceImpl) withTx(ctx context.Context, fn func(repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository) error) error {
+	if s.publisher == nil {
+		return s.maintenanceRepo.WithTx(ctx, fn)
+	}
+
+	var pending []models.DeviceEvent
+	err := s.maintenanceRepo.WithTx(ctx, func(repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository) error {
+		pending = nil
+		return fn(repo, &publishingRepository{DeviceRepository: deviceRepo, publisher: s.publisher, pending: &pending})
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range pending {
+		s.publisher.Publish(event)
+	}
+	return nil
+}
+
+// openTicket saves a new ticket and puts its device into maintenance,
+// remembering the state to return it to
+func (s *MaintenanceServiceImpl) openTicket(ctx context.Context, repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository, ticket *models.MaintenanceTicket) error {
+	device, err := deviceRepo.GetByIDForUpdate(ctx, ticket.DeviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+	if device.State != models.StateMaintenance {
+		prior := device.State
+		ticket.PriorState = &prior
+	}
+
+	if err := repo.CreateTicket(ctx, ticket); err != nil {
+		return fmt.Errorf("failed to save maintenance ticket: %w", err)
+	}
+
+	if device.State != models.StateMaintenance {
+		device.EnterMaintenance()
+		if err := deviceRepo.Update(ctx, device); err != nil {
+			return fmt.Errorf("failed to update device: %w", err)
+		}
+	}
+
+	// The components of a kit are serviced with it
+	children, err := deviceRepo.GetChildren(ctx, device.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get child devices: %w", err)
+	}
+	for _, child := range children {
+		if child.State == models.StateMaintenance {
+			continue
+		}
+		child.EnterMaintenance()
+		if err := deviceRepo.Update(ctx, child); err != nil {
+			return fmt.Errorf("failed to update child device %s: %w", child.ID, err)
+		}
+	}
+	return nil
+}
+
+// releaseDevice returns a device to the state it was in before its
+// maintenance once it has no active tickets left. Components of a kit stay
+// under maintenance while their kit is, and are released with it unless they
+// have active tickets of their own.
+func (s *MaintenanceServiceImpl) releaseDevice(ctx context.Context, repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository, deviceID string) error {
+	active, err := repo.CountActiveTickets(ctx, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to count active maintenance tickets: %w", err)
+	}
+	if active > 0 {
+		return nil
+	}
+
+	// Lock the kit of a component before the component, like kit state
+	// changes do, so that the kit cannot be released in the meantime
+	device, err := deviceRepo.GetByID(ctx, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+	if device.ParentID != nil {
+		if _, err := deviceRepo.GetByIDForUpdate(ctx, *device.ParentID); err != nil {
+			return fmt.Errorf("failed to get parent device: %w", err)
+		}
+	}
+	device, err = deviceRepo.GetByIDForUpdate(ctx, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+	prior, err := s.priorState(ctx, repo, deviceRepo, device)
+	if err != nil {
+		return err
+	}
+	if prior != nil && *prior == models.StateMaintenance {
+		// The kit of the component is still under maintenance
+		return nil
+	}
+
+	device.ExitMaintenance(prior)
+	if err := deviceRepo.Update(ctx, device); err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+
+	children, err := deviceRepo.GetChildren(ctx, device.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get child devices: %w", err)
+	}
+	for _, child := range children {
+		if child.State != models.StateMaintenance {
+			continue
+		}
+		active, err := repo.CountActiveTickets(ctx, child.ID)
+		if err != nil {
+			return fmt.Errorf("failed to count active maintenance tickets: %w", err)
+		}
+		if active > 0 {
+			continue
+		}
+		child.ExitMaintenance(&device.State)
+		if err := deviceRepo.Update(ctx, child); err != nil {
+			return fmt.Errorf("failed to update child device %s: %w", child.ID, err)
+		}
+	}
+	return nil
+}
+
+// priorState returns the state a device leaving maintenance returns to.
+// Components share the state of their kit; other devices return to the state
+// recorded by the latest ticket that took them into maintenance, if any.
+func (s *MaintenanceServiceImpl) priorState(ctx context.Context, repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository, device *models.Device) (*models.DeviceState, error) {
+	if device.ParentID != nil {
+		parent, err := deviceRepo.GetByID(ctx, *device.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent device: %w", err)
+		}
+		return &parent.State, nil
+	}
+
+	tickets, err := repo.GetTicketsByDevice(ctx, device.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance tickets: %w", err)
+	}
+	var opening *models.MaintenanceTicket
+	for _, ticket := range tickets {
+		if ticket.PriorState != nil && (opening == nil || ticket.OpenedAt.After(opening.OpenedAt)) {
+			opening = ticket
+		}
+	}
+	if opening == nil {
+		return nil, nil
+	}
+	return opening.PriorState, nil
+}
+
+// checkDevice verifies that a device exists
+func (s *MaintenanceServiceImpl) checkDevice(ctx context.Context, deviceID string) error {
+	if strings.TrimSpace(deviceID) == "" {
+		return fmt.Errorf("device ID cannot be empty")
+	}
+
+	exists, err := s.deviceRepo.Exists(ctx, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to check device: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("device with ID %s not found", deviceID)
+	}
+	return nil
+}
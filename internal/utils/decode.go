@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// DefaultMaxBodySize is the largest JSON request body accepted unless configured otherwise
+const DefaultMaxBodySize = 1 << 20
+
+// BodyError describes why a request body was rejected and the status to answer with
+type BodyError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *BodyError) Error() string {
+	return e.Message
+}
+
+// JSONDecoder decodes JSON request bodies strictly: the body must be sent as
+// application/json, must not be larger than MaxBodySize bytes, and must hold a
+// single JSON value without fields the target does not have.
+type JSONDecoder struct {
+	MaxBodySize int64
+}
+
+// NewJSONDecoder returns a decoder accepting bodies of up to maxBodySize bytes
+func NewJSONDecoder(maxBodySize int64) JSONDecoder {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	return JSONDecoder{MaxBodySize: maxBodySize}
+}
+
+// Decode decodes the body of r into v. The error tells the client what is
+// wrong with the body, with the byte offset and field where possible: 415 for
+// another content type, 413 for a body that is too large and 400 otherwise.
+func (d JSONDecoder) Decode(w http.ResponseWriter, r *http.Request, v any) *BodyError {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &BodyError{http.StatusUnsupportedMediaType, "Content-Type must be application/json"}
+	}
+
+	body, bodyErr := d.readBody(w, r)
+	if bodyErr != nil {
+		return bodyErr
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	return decodeValue(decoder, body, v)
+}
+
+// ReadJSON reads the body of r, whatever its JSON media type, and checks that
+// it holds a single well-formed JSON value. Errors are reported like Decode's.
+func (d JSONDecoder) ReadJSON(w http.ResponseWriter, r *http.Request) ([]byte, *BodyError) {
+	body, bodyErr := d.readBody(w, r)
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+	var value json.RawMessage
+	if bodyErr := decodeValue(json.NewDecoder(bytes.NewReader(body)), body, &value); bodyErr != nil {
+		return nil, bodyErr
+	}
+	return body, nil
+}
+
+// readBody reads the body of r, answering 413 only when it is too large
+func (d JSONDecoder) readBody(w http.ResponseWriter, r *http.Request) ([]byte, *BodyError) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, d.MaxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, &BodyError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit)}
+		}
+		return nil, &BodyError{http.StatusBadRequest, "Failed to read request body"}
+	}
+	return body, nil
+}
+
+// decodeValue decodes the single JSON value of body into v
+func decodeValue(decoder *json.Decoder, body []byte, v any) *BodyError {
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err, body)
+	}
+	// Anything but whitespace after the value is rejected
+	if _, err := decoder.Token(); err != io.EOF {
+		return &BodyError{http.StatusBadRequest, fmt.Sprintf("Request body must contain a single JSON value (unexpected data at byte offset %d)", skipSeparators(body, decoder.InputOffset()))}
+	}
+	return nil
+}
+
+// decodeError turns an error from decoding body into a message for the client
+func decodeError(err error, body []byte) *BodyError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return &BodyError{http.StatusBadRequest, "Request body must not be empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &BodyError{http.StatusBadRequest, fmt.Sprintf("Request body contains incomplete JSON (byte offset %d)", len(body))}
+	case errors.As(err, &syntaxErr):
+		return &BodyError{http.StatusBadRequest, fmt.Sprintf("Request body contains malformed JSON at byte offset %d: %v", syntaxErr.Offset, syntaxErr)}
+	case errors.As(err, &typeErr):
+		at := "Request body"
+		if typeErr.Field != "" {
+			at = fmt.Sprintf("Request body field %q", typeErr.Field)
+		}
+		return &BodyError{http.StatusBadRequest, fmt.Sprintf("%s cannot be a JSON %s (byte offset %d)", at, typeErr.Value, typeErr.Offset)}
+	}
+
+	// The decoder reports unknown fields as `json: unknown field "name"`
+	var field string
+	if _, scanErr := fmt.Sscanf(err.Error(), "json: unknown field %q", &field); scanErr == nil {
+		return &BodyError{http.StatusBadRequest, fmt.Sprintf("Request body contains unknown field %q (byte offset %d)", field, keyOffset(body, field))}
+	}
+	// Errors from UnmarshalJSON methods, such as an invalid date or state
+	return &BodyError{http.StatusBadRequest, "Request body is invalid: " + err.Error()}
+}
+
+// keyOffset returns the byte offset of the first object key named name in
+// body, or -1
+func keyOffset(body []byte, name string) int64 {
+	type frame struct{ object, expectKey bool }
+	var stack []frame
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return -1
+		}
+		if n := len(stack); n > 0 && stack[n-1].expectKey {
+			if key, ok := token.(string); ok {
+				if key == name {
+					return skipSeparators(body, offset)
+				}
+				stack[n-1].expectKey = false
+				continue
+			}
+		}
+
+		switch token {
+		case json.Delim('{'):
+			stack = append(stack, frame{object: true, expectKey: true})
+			continue
+		case json.Delim('['):
+			stack = append(stack, frame{})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+		// A value ended, so within an object a key comes next
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].expectKey = true
+		}
+	}
+}
+
+// skipSeparators returns the offset of the first token at or after offset,
+// skipping whitespace, commas and colons
+func skipSeparators(body []byte, offset int64) int64 {
+	for offset < int64(len(body)) && bytes.IndexByte([]byte(" \t\r\n,:"), body[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
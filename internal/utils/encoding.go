@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Media types WriteResponse can produce
+const (
+	MediaTypeJSON = "application/json"
+	MediaTypeCSV  = "text/csv"
+	MediaTypeXML  = "application/xml"
+	MediaTypeYAML = "application/yaml"
+)
+
+// SupportedMediaTypes lists the response media types in order of preference
+var SupportedMediaTypes = []string{MediaTypeJSON, MediaTypeCSV, MediaTypeXML, MediaTypeYAML}
+
+// mediaTypeAliases maps accepted media types to the one that is produced
+var mediaTypeAliases = map[string]string{
+	"application/json":   MediaTypeJSON,
+	"text/csv":           MediaTypeCSV,
+	"application/xml":    MediaTypeXML,
+	"text/xml":           MediaTypeXML,
+	"application/yaml":   MediaTypeYAML,
+	"application/x-yaml": MediaTypeYAML,
+	"text/yaml":          MediaTypeYAML,
+	"text/x-yaml":        MediaTypeYAML,
+}
+
+// NegotiateMediaType picks the supported media type with the highest quality
+// in an Accept header. An empty header selects JSON. ok is false when the
+// header accepts none of the supported types.
+func NegotiateMediaType(accept string) (mediaType string, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return MediaTypeJSON, true
+	}
+
+	// Explicit entries take precedence over wildcards, including q=0 exclusions
+	explicit := make(map[string]float64)
+	var wildcards []string
+	var wildcardQ []float64
+
+	for _, part := range strings.Split(accept, ",") {
+		name, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, found := params["q"]; found {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		if supported, found := mediaTypeAliases[name]; found {
+			if current, seen := explicit[supported]; !seen || q > current {
+				explicit[supported] = q
+			}
+			continue
+		}
+		if name == "*/*" || strings.HasSuffix(name, "/*") {
+			wildcards = append(wildcards, name)
+			wildcardQ = append(wildcardQ, q)
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, candidate := range SupportedMediaTypes {
+		q, found := explicit[candidate]
+		if !found {
+			q = 0
+			for i, wildcard := range wildcards {
+				if (wildcard == "*/*" || strings.HasPrefix(candidate, strings.TrimSuffix(wildcard, "*"))) && wildcardQ[i] > q {
+					q = wildcardQ[i]
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best, best != ""
+}
+
+// Encode renders data as the given media type. Field names and values are
+// taken from the JSON encoding of data so every format matches the JSON API.
+func Encode(mediaType string, data any) ([]byte, error) {
+	if mediaType == MediaTypeJSON {
+		return json.Marshal(data)
+	}
+
+	tree, err := toTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case MediaTypeCSV:
+		return encodeCSV(tree)
+	case MediaTypeXML:
+		return encodeXML(tree)
+	case MediaTypeYAML:
+		return encodeYAML(tree)
+	default:
+		return nil, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+}
+
+// object is a JSON object that keeps its keys in encoding order
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// toTree converts data into objects, []any and scalars via its JSON encoding
+func toTree(data any) (any, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	return decodeTree(decoder)
+}
+
+func decodeTree(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := object{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeTree(decoder)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, field{key: key.(string), value: value})
+		}
+		_, err = decoder.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for decoder.More() {
+			value, err := decodeTree(decoder)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = decoder.Token()
+		return arr, err
+	default:
+		return token, nil
+	}
+}
+
+// scalarString formats a JSON scalar, rendering null as an empty string
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// encodeCSV writes one row per array element, or a single row for an object.
+// The header is the union of object keys in first-seen order; nested values
+// are written as JSON.
+func encodeCSV(tree any) ([]byte, error) {
+	rows, ok := tree.([]any)
+	if !ok {
+		rows = []any{tree}
+	}
+
+	var header []string
+	columns := make(map[string]int)
+	for _, row := range rows {
+		obj, ok := row.(object)
+		if !ok {
+			obj = object{{key: "value", value: row}}
+		}
+		for _, f := range obj {
+			if _, seen := columns[f.key]; !seen {
+				columns[f.key] = len(header)
+				header = append(header, f.key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if len(header) == 0 {
+		return buf.Bytes(), nil
+	}
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		obj, ok := row.(object)
+		if !ok {
+			obj = object{{key: "value", value: row}}
+		}
+		record := make([]string, len(header))
+		for _, f := range obj {
+			record[columns[f.key]] = scalarString(f.value)
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// encodeXML writes the tree below a <response> root. Array elements become
+// <item> elements; keys that are not valid element names become <entry key="...">.
+func encodeXML(tree any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := writeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: "response"}}, tree); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(encoder *xml.Encoder, start xml.StartElement, value any) error {
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case object:
+		for _, f := range v {
+			child := xml.StartElement{Name: xml.Name{Local: f.key}}
+			if !isXMLName(f.key) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: f.key}},
+				}
+			}
+			if err := writeXMLElement(encoder, child, f.value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := writeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(scalarString(v))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// isXMLName reports whether name can be used as an element name as is
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		letter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if i == 0 && !letter {
+			return false
+		}
+		if !letter && r != '-' && r != '.' && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeYAML writes the tree as a YAML document, keeping key order
+func encodeYAML(tree any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(yamlNode(tree)); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func yamlNode(value any) *yaml.Node {
+	switch v := value.(type) {
+	case object:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, f := range v {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: f.key}, yamlNode(f.value))
+		}
+		return node
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: scalarString(v)}
+	}
+}
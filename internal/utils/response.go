@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 type ErrorResponse struct {
@@ -20,6 +21,33 @@ func WriteJSONResponse(w http.ResponseWriter, statusCode int, data any) {
 	}
 }
 
+// WriteResponse writes data in the format negotiated from the request's Accept
+// header, defaulting to JSON. It responds 406 Not Acceptable when the client
+// accepts none of the supported media types.
+func WriteResponse(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Add("Vary", "Accept")
+
+	mediaType, ok := NegotiateMediaType(r.Header.Get("Accept"))
+	if !ok {
+		WriteErrorResponse(w, http.StatusNotAcceptable, "Supported response types are "+strings.Join(SupportedMediaTypes, ", "))
+		return
+	}
+	if mediaType == MediaTypeJSON {
+		WriteJSONResponse(w, statusCode, data)
+		return
+	}
+
+	// Encode before writing the status so that failures can still be reported
+	body, err := Encode(mediaType, data)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
 // WriteErrorResponse writes an error response with the given status code and message
 func WriteErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 	errorResp := ErrorResponse{
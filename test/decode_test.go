@@ -0,0 +1,92 @@
+package test
+
+import (
+	"devices-api/internal/models"
+	"devices-api/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONDecoder_Decode(t *testing.T) {
+	type target struct {
+		Name  string             `json:"name"`
+		Count int                `json:"count"`
+		State models.DeviceState `json:"state"`
+		Tags  []string           `json:"tags"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantMessage string
+	}{
+		{"valid", "application/json", `{"name": "Phone", "count": 2, "tags": ["a"]}`, 0, ""},
+		{"charset parameter", "application/json; charset=utf-8", `{"name": "Phone"}` + "\n", 0, ""},
+		{"missing content type", "", `{"name": "Phone"}`, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"other content type", "text/plain", `{"name": "Phone"}`, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"too large", "application/json", `{"name": "` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge, "must not be larger than 48 bytes"},
+		{"empty", "application/json", ``, http.StatusBadRequest, "must not be empty"},
+		{"unknown field", "application/json", `{"name": "Phone", "colour": "red"}`, http.StatusBadRequest, `unknown field "colour" (byte offset 18)`},
+		{"unknown field after a matching value", "application/json", `{"tags": ["colour"], "colour": 1}`, http.StatusBadRequest, `unknown field "colour" (byte offset 21)`},
+		{"wrong type", "application/json", `{"count": "two"}`, http.StatusBadRequest, `field "count" cannot be a JSON string (byte offset 15)`},
+		{"nested wrong type", "application/json", `{"tags": [1]}`, http.StatusBadRequest, `field "tags.0" cannot be a JSON number`},
+		{"not an object", "application/json", `[]`, http.StatusBadRequest, "Request body cannot be a JSON array"},
+		{"malformed", "application/json", `{"name": "Phone",}`, http.StatusBadRequest, "malformed JSON at byte offset 18"},
+		{"incomplete", "application/json", `{"name": "Ph`, http.StatusBadRequest, "incomplete JSON"},
+		{"multiple values", "application/json", `{"name": "Phone"} {"name": "Tablet"}`, http.StatusBadRequest, "must contain a single JSON value"},
+		{"trailing garbage", "application/json", `{"name": "Phone"} x`, http.StatusBadRequest, "must contain a single JSON value"},
+	}
+
+	decoder := utils.NewJSONDecoder(48)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			var v target
+			err := decoder.Decode(httptest.NewRecorder(), req, &v)
+			if tt.wantStatus == 0 {
+				assert.Nil(t, err)
+				assert.Equal(t, "Phone", v.Name)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Equal(t, tt.wantStatus, err.StatusCode)
+				assert.Contains(t, err.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestDeviceHandler_StrictJSON(t *testing.T) {
+	deviceHandler, mockRepo := newTestDeviceHandler()
+
+	create := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/devices", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		deviceHandler.CreateDevice(rr, req)
+		return rr
+	}
+
+	rr := create("application/json", `{"name": "Phone", "brand": "Acme", "state": "available", "colour": "red"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `unknown field \"colour\"`)
+
+	rr = create("text/plain", `{"name": "Phone", "brand": "Acme", "state": "available"}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+
+	assert.Len(t, mockRepo.devices, 3)
+	rr = create("application/json", `{"name": "Phone", "brand": "Acme", "state": "available"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Len(t, mockRepo.devices, 4)
+}
@@ -0,0 +1,366 @@
+package test
+
+import (
+	"context"
+	"devices-api/internal/handler"
+	"devices-api/internal/models"
+	"devices-api/internal/service"
+	"devices-api/internal/utils"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDeviceHandler() (*handler.DeviceHandler, *MockDeviceRepository) {
+	mockRepo := NewMockDeviceRepository()
+	for _, device := range []*models.Device{
+		{ID: "device-1", Name: "Phone, large", Brand: "Acme", State: models.StateAvailable, CreationTime: time.Now()},
+		{ID: "device-2", Name: "Tablet", Brand: "Acme", State: models.StateInUse, CreationTime: time.Now()},
+		{ID: "device-3", Name: "Laptop", Brand: "Other", State: models.StateAvailable, CreationTime: time.Now()},
+	} {
+		mockRepo.devices[device.ID] = device
+	}
+	return handler.NewDeviceHandler(service.NewDeviceService(mockRepo)), mockRepo
+}
+
+func TestDeviceHandler_ExportDevices(t *testing.T) {
+	deviceHandler, _ := newTestDeviceHandler()
+
+	// CSV export applies the list filters
+	rr := httptest.NewRecorder()
+	deviceHandler.ExportDevices(rr, httptest.NewRequest("GET", "/devices/export?format=csv&brand=Acme", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment; filename=\"devices-")
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, "id", records[0][0])
+		assert.Equal(t, []string{"device-1", "Phone, large", "Acme"}, records[1][:3])
+		assert.Equal(t, "device-2", records[2][0])
+	}
+
+	// NDJSON export writes one device per line
+	rr = httptest.NewRecorder()
+	deviceHandler.ExportDevices(rr, httptest.NewRequest("GET", "/devices/export?format=ndjson&state=available", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		var device models.Device
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &device))
+		assert.Equal(t, "device-3", device.ID)
+	}
+
+	// An empty export still has a CSV header
+	rr = httptest.NewRecorder()
+	deviceHandler.ExportDevices(rr, httptest.NewRequest("GET", "/devices/export?format=csv&brand=None", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "id,name,brand"))
+
+	rr = httptest.NewRecorder()
+	deviceHandler.ExportDevices(rr, httptest.NewRequest("GET", "/devices/export?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	deviceHandler.ExportDevices(rr, httptest.NewRequest("GET", "/devices/export?format=csv&state=broken", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDeviceHandler_PatchDevice(t *testing.T) {
+	deviceHandler, _ := newTestDeviceHandler()
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/devices/device-1", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		deviceHandler.PatchDevice(rr, mux.SetURLVars(req, map[string]string{"id": "device-1"}))
+		return rr
+	}
+
+	rr := patch("application/merge-patch+json", `{"name":"Phone"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"name":"Phone"`)
+
+	rr = patch("application/json-patch+json", `[{"op":"test","path":"/name","value":"Tablet"}]`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = patch("application/json-patch+json", `[{"op":"replace","path":"/missing","value":1}]`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = patch("application/merge-patch+json", `{"creation_time":"2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = patch("text/plain", `name=Phone`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.Contains(t, rr.Header().Get("Accept-Patch"), "application/json-patch+json")
+
+	// Only a patch over the body size limit is too large; other read errors are the client's
+	rr = patch("application/merge-patch+json", `{"name":"`+strings.Repeat("x", utils.DefaultMaxBodySize)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	req := httptest.NewRequest("PATCH", "/devices/device-1", iotest.ErrReader(io.ErrUnexpectedEOF))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rr = httptest.NewRecorder()
+	deviceHandler.PatchDevice(rr, mux.SetURLVars(req, map[string]string{"id": "device-1"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// PUT without the required fields is rejected
+	req = httptest.NewRequest("PUT", "/devices/device-1", strings.NewReader(`{"name":"Phone"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	deviceHandler.ReplaceDevice(rr, mux.SetURLVars(req, map[string]string{"id": "device-1"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDeviceHandler_SparseFieldsets(t *testing.T) {
+	deviceHandler, _ := newTestDeviceHandler()
+
+	rr := httptest.NewRecorder()
+	deviceHandler.GetAllDevices(rr, httptest.NewRequest("GET", "/devices?brand=Acme&state=in-use&fields=state,id", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[{"id":"device-2","state":"in-use"}]`, rr.Body.String())
+
+	req := httptest.NewRequest("GET", "/devices/device-1?fields=name", nil)
+	rr = httptest.NewRecorder()
+	deviceHandler.GetDevice(rr, mux.SetURLVars(req, map[string]string{"id": "device-1"}))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"name":"Phone, large"}`, rr.Body.String())
+
+	// Projections work with content negotiation
+	req = httptest.NewRequest("GET", "/devices?brand=Other&fields=id,name", nil)
+	req.Header.Set("Accept", "text/csv")
+	rr = httptest.NewRecorder()
+	deviceHandler.GetAllDevices(rr, req)
+	assert.Equal(t, "id,name\ndevice-3,Laptop\n", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	deviceHandler.GetAllDevices(rr, httptest.NewRequest("GET", "/devices?fields=id,color", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "color")
+
+	req = httptest.NewRequest("GET", "/devices/device-1?fields=", nil)
+	rr = httptest.NewRecorder()
+	deviceHandler.GetDevice(rr, mux.SetURLVars(req, map[string]string{"id": "device-1"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDeviceHandler_SortAndPaginate(t *testing.T) {
+	deviceHandler, mockRepo := newTestDeviceHandler()
+	mockRepo.devices["device-4"] = &models.Device{ID: "device-4", Name: "Tablet", Brand: "Other", State: models.StateInactive, CreationTime: time.Now()}
+
+	list := func(query string) (int, []string) {
+		rr := httptest.NewRecorder()
+		deviceHandler.GetAllDevices(rr, httptest.NewRequest("GET", "/devices?fields=id&"+query, nil))
+		var devices []struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &devices)
+		ids := make([]string, len(devices))
+		for i, device := range devices {
+			ids[i] = device.ID
+		}
+		return rr.Code, ids
+	}
+
+	// Equal names are ordered by ID
+	code, ids := list("sort=name")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"device-3", "device-1", "device-2", "device-4"}, ids)
+
+	_, ids = list("sort=brand,-name")
+	assert.Equal(t, []string{"device-2", "device-1", "device-4", "device-3"}, ids)
+
+	// An explicit zero limit is rejected; leaving it out lists every device
+	rr := httptest.NewRecorder()
+	deviceHandler.GetAllDevices(rr, httptest.NewRequest("GET", "/devices?limit=0", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "limit must be between 1 and 1000")
+	_, ids = list("")
+	assert.Len(t, ids, 4)
+
+	// Pages follow the same order
+	_, ids = list("sort=-name&limit=2")
+	assert.Equal(t, []string{"device-2", "device-4"}, ids)
+	_, ids = list("sort=-name&limit=2&offset=2")
+	assert.Equal(t, []string{"device-1", "device-3"}, ids)
+	_, ids = list("sort=-name&limit=2&offset=4")
+	assert.Empty(t, ids)
+
+	for _, query := range []string{"sort=color", "sort=id", "sort=name,-name", "limit=0", "limit=1001", "limit=x", "offset=-1"} {
+		code, _ = list(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestDeviceHandler_GetDeviceStats(t *testing.T) {
+	deviceHandler, mockRepo := newTestDeviceHandler()
+	mockRepo.devices["device-1"].CreationTime = time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	mockRepo.devices["device-2"].CreationTime = time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC)
+	mockRepo.devices["device-3"].CreationTime = time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		deviceHandler.GetDeviceStats(rr, httptest.NewRequest("GET", "/devices/stats?"+query, nil))
+		return rr
+	}
+
+	rr := get("interval=week&from=2024-03-06&to=2024-03-20")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var stats models.DeviceStats
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+
+	assert.Equal(t, 3, stats.Total)
+	assert.Equal(t, map[models.DeviceState]int{models.StateAvailable: 2, models.StateInUse: 1}, stats.ByState)
+	assert.Equal(t, map[string]int{"Acme": 2, "Other": 1}, stats.ByBrand)
+	assert.Equal(t, map[string]map[models.DeviceState]int{
+		"Acme":  {models.StateAvailable: 1, models.StateInUse: 1},
+		"Other": {models.StateAvailable: 1},
+	}, stats.ByBrandState)
+
+	// The range is widened to whole weeks, and empty weeks are counted as zero
+	assert.Equal(t, "2024-03-04", stats.Created.From.String())
+	assert.Equal(t, "2024-03-24", stats.Created.To.String())
+	if assert.Len(t, stats.Created.Buckets, 3) {
+		assert.Equal(t, []int{2, 0, 1}, []int{stats.Created.Buckets[0].Count, stats.Created.Buckets[1].Count, stats.Created.Buckets[2].Count})
+		assert.Equal(t, "2024-03-11", stats.Created.Buckets[1].Start.String())
+	}
+
+	rr = get("to=2024-03-20")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, models.IntervalDay, stats.Created.Interval)
+	assert.Len(t, stats.Created.Buckets, 30)
+	assert.Equal(t, 1, stats.Created.Buckets[29].Count)
+
+	for _, query := range []string{"interval=year", "from=03/01/2024", "from=2024-03-21&to=2024-03-20", "from=2000-01-01&to=2024-01-01"} {
+		assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+	}
+}
+
+func TestDeviceHandler_GetUtilizationReport(t *testing.T) {
+	deviceHandler, mockRepo := newTestDeviceHandler()
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	available, inUse := models.StateAvailable, models.StateInUse
+	mockRepo.stateChanges = []*models.StateChange{
+		{DeviceID: "device-1", ToState: available, ChangedAt: day(1).AddDate(0, -1, 0)},
+		{DeviceID: "device-1", FromState: &available, ToState: inUse, ChangedAt: day(3)},
+		{DeviceID: "device-1", FromState: &inUse, ToState: available, ChangedAt: day(8)},
+		{DeviceID: "device-2", ToState: inUse, ChangedAt: day(6)},
+		{DeviceID: "device-3", ToState: available, ChangedAt: day(20)},
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		deviceHandler.GetUtilizationReport(rr, httptest.NewRequest("GET", "/reports/utilization?"+query, nil))
+		return rr
+	}
+	getAs := func(accept, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/reports/utilization?"+query, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		deviceHandler.GetUtilizationReport(rr, req)
+		return rr
+	}
+
+	rr := get("from=2024-03-01&to=2024-03-10")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var report models.UtilizationReport
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+
+	// device-3 was created after the period
+	if assert.Len(t, report.Devices, 2) {
+		assert.Equal(t, "Phone, large", report.Devices[0].Name)
+		assert.Equal(t, 10*24*3600.0, report.Devices[0].TrackedSeconds)
+		assert.Equal(t, 0.5, report.Devices[0].Utilization)
+		// device-2 only counts from its creation
+		assert.Equal(t, 5*24*3600.0, report.Devices[1].TrackedSeconds)
+		assert.Equal(t, 1.0, report.Devices[1].Utilization)
+	}
+	if assert.Len(t, report.Brands, 1) {
+		assert.Equal(t, "Acme", report.Brands[0].Brand)
+		assert.Equal(t, 2, report.Brands[0].Devices)
+		assert.InDelta(t, 2.0/3, report.Brands[0].Utilization, 1e-9)
+	}
+
+	rr = getAs("text/csv", "from=2024-03-01&to=2024-03-10&group=brand")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"brand", "devices", "tracked_seconds", "in_use_seconds", "utilization"},
+		{"Acme", "2", "1296000", "864000", "0.6667"},
+	}, records)
+
+	// Other representations are negotiated like device reads
+	rr = getAs("application/yaml", "from=2024-03-01&to=2024-03-10")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "utilization: 0.5")
+	assert.Equal(t, http.StatusNotAcceptable, getAs("image/png", "").Code)
+
+	for _, query := range []string{"group=location", "from=2024-03-11&to=2024-03-10", "from=2999-01-01&to=2999-01-02", "to=soon"} {
+		assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+	}
+}
+
+func TestDeviceHandler_GetChanges(t *testing.T) {
+	deviceHandler, mockRepo := newTestDeviceHandler()
+	ctx := context.Background()
+	assert.NoError(t, mockRepo.Create(ctx, &models.Device{ID: "device-4", Name: "Watch", Brand: "Acme", State: models.StateAvailable}))
+	updated := *mockRepo.devices["device-1"]
+	updated.State = models.StateInUse
+	assert.NoError(t, mockRepo.Update(ctx, &updated))
+	assert.NoError(t, mockRepo.Delete(ctx, "device-3"))
+
+	get := func(query string) (*httptest.ResponseRecorder, models.ChangeFeed) {
+		rr := httptest.NewRecorder()
+		deviceHandler.GetChanges(rr, httptest.NewRequest("GET", "/changes?"+query, nil))
+		var feed models.ChangeFeed
+		if rr.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &feed))
+		}
+		return rr, feed
+	}
+
+	rr, feed := get("limit=2")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.Len(t, feed.Changes, 2) {
+		assert.Equal(t, int64(1), feed.Changes[0].Sequence)
+		assert.Equal(t, models.DeviceCreated, feed.Changes[0].Type)
+		assert.Equal(t, "device-1", feed.Changes[1].DeviceID)
+		assert.Equal(t, models.StateInUse, feed.Changes[1].Device.State)
+	}
+	assert.Equal(t, int64(2), feed.NextCursor)
+	assert.True(t, feed.HasMore)
+
+	// Resuming from the cursor returns the remaining changes
+	_, feed = get("since=2")
+	if assert.Len(t, feed.Changes, 1) {
+		assert.Equal(t, models.DeviceDeleted, feed.Changes[0].Type)
+		assert.Equal(t, "Laptop", feed.Changes[0].Device.Name)
+	}
+	assert.Equal(t, int64(3), feed.NextCursor)
+	assert.False(t, feed.HasMore)
+
+	// A consumer that is up to date keeps its cursor
+	rr, feed = get("since=3")
+	assert.Contains(t, rr.Body.String(), `"changes":[]`)
+	assert.Equal(t, int64(3), feed.NextCursor)
+
+	for _, query := range []string{"since=-1", "since=first", "limit=0", "limit=1001"} {
+		rr, _ := get(query)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
@@ -3,8 +3,12 @@ package test
 import (
 	"context"
 	"devices-api/internal/models"
+	"devices-api/internal/repository"
 	"devices-api/internal/service"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,22 +17,61 @@ import (
 
 // MockDeviceRepository is a mock implementation of DeviceRepository for testing
 type MockDeviceRepository struct {
-	devices map[string]*models.Device
-	nextID  int
+	devices      map[string]*models.Device
+	moves        []*models.DeviceMove
+	stateChanges []*models.StateChange
+	changes      []*models.DeviceChange
+	// states holds the last recorded state of each device, since updates
+	// modify the stored devices in place
+	states map[string]models.DeviceState
+	// locked lists the IDs of the devices read for update, in order
+	locked []string
+	nextID int
 }
 
 func NewMockDeviceRepository() *MockDeviceRepository {
 	return &MockDeviceRepository{
 		devices: make(map[string]*models.Device),
+		states:  make(map[string]models.DeviceState),
 		nextID:  1,
 	}
 }
 
+func (m *MockDeviceRepository) recordStateChange(device *models.Device, changedAt time.Time) {
+	change := &models.StateChange{DeviceID: device.ID, ToState: device.State, ChangedAt: changedAt}
+	if previous, ok := m.states[device.ID]; ok {
+		if previous == device.State {
+			return
+		}
+		change.FromState = &previous
+	}
+	m.states[device.ID] = device.State
+	m.stateChanges = append(m.stateChanges, change)
+}
+
+func (m *MockDeviceRepository) recordChange(changeType models.DeviceEventType, device *models.Device) {
+	snapshot := *device
+	m.changes = append(m.changes, &models.DeviceChange{
+		Sequence: int64(len(m.changes) + 1),
+		Type:     changeType,
+		DeviceID: device.ID,
+		Device:   &snapshot,
+		Time:     time.Now(),
+	})
+}
+
 func (m *MockDeviceRepository) Create(ctx context.Context, device *models.Device) error {
 	if _, exists := m.devices[device.ID]; exists {
 		return errors.New("device already exists")
 	}
+	for _, other := range m.devices {
+		if device.SerialNumber != "" && other.Brand == device.Brand && other.SerialNumber == device.SerialNumber {
+			return errors.New("device with serial number already exists")
+		}
+	}
 	m.devices[device.ID] = device
+	m.recordStateChange(device, device.CreationTime)
+	m.recordChange(models.DeviceCreated, device)
 	return nil
 }
 
@@ -40,6 +83,49 @@ func (m *MockDeviceRepository) GetByID(ctx context.Context, id string) (*models.
 	return device, nil
 }
 
+func (m *MockDeviceRepository) GetByIDForUpdate(ctx context.Context, id string) (*models.Device, error) {
+	m.locked = append(m.locked, id)
+	return m.GetByID(ctx, id)
+}
+
+func (m *MockDeviceRepository) GetByIDs(ctx context.Context, ids []string) ([]*models.Device, error) {
+	devices := []*models.Device{}
+	for _, id := range ids {
+		if device, exists := m.devices[id]; exists {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func (m *MockDeviceRepository) GetFieldsByID(ctx context.Context, id string, fields []string) (*models.Device, error) {
+	return m.GetByID(ctx, id)
+}
+
+func (m *MockDeviceRepository) GetBySerialNumber(ctx context.Context, brand, serialNumber string) (*models.Device, error) {
+	for _, device := range m.devices {
+		if device.Brand == brand && device.SerialNumber == serialNumber {
+			return device, nil
+		}
+	}
+	return nil, errors.New("device not found")
+}
+
+func (m *MockDeviceRepository) GetByAssetTag(ctx context.Context, assetTag string) (*models.Device, error) {
+	for _, device := range m.devices {
+		if device.AssetTag == assetTag {
+			return device, nil
+		}
+	}
+	return nil, errors.New("device not found")
+}
+
+func (m *MockDeviceRepository) NextAssetTagSequence(ctx context.Context) (int64, error) {
+	seq := m.nextID
+	m.nextID++
+	return int64(seq), nil
+}
+
 func (m *MockDeviceRepository) GetAll(ctx context.Context) ([]*models.Device, error) {
 	var devices []*models.Device
 	for _, device := range m.devices {
@@ -48,6 +134,148 @@ func (m *MockDeviceRepository) GetAll(ctx context.Context) ([]*models.Device, er
 	return devices, nil
 }
 
+func (m *MockDeviceRepository) Find(ctx context.Context, filter repository.DeviceFilter) ([]*models.Device, error) {
+	var devices []*models.Device
+	for _, device := range m.devices {
+		if filter.Brand != "" && device.Brand != filter.Brand {
+			continue
+		}
+		if filter.State != "" && device.State != filter.State {
+			continue
+		}
+		if filter.LocationID != "" && (device.LocationID == nil || *device.LocationID != filter.LocationID) {
+			continue
+		}
+		if device.ID <= filter.AfterID {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	if filter.Limit > 0 && len(devices) > filter.Limit {
+		devices = devices[:filter.Limit]
+	}
+	return devices, nil
+}
+
+func (m *MockDeviceRepository) List(ctx context.Context, query repository.DeviceQuery) ([]*models.Device, error) {
+	devices, err := m.Find(ctx, repository.DeviceFilter{
+		Brand:      query.Filter.Brand,
+		State:      query.Filter.State,
+		LocationID: query.Filter.LocationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	order := query.Sort
+	if len(order) == 0 {
+		order = []repository.DeviceSort{{Field: "creation_time", Descending: true}}
+	}
+	sort.SliceStable(devices, func(i, j int) bool {
+		for _, term := range order {
+			var cmp int
+			switch term.Field {
+			case "name":
+				cmp = strings.Compare(devices[i].Name, devices[j].Name)
+			case "brand":
+				cmp = strings.Compare(devices[i].Brand, devices[j].Brand)
+			case "state":
+				cmp = strings.Compare(string(devices[i].State), string(devices[j].State))
+			case "creation_time":
+				cmp = devices[i].CreationTime.Compare(devices[j].CreationTime)
+			}
+			if term.Descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return devices[i].ID < devices[j].ID
+	})
+
+	devices = devices[min(query.Offset, len(devices)):]
+	if query.Limit > 0 && len(devices) > query.Limit {
+		devices = devices[:query.Limit]
+	}
+	return append([]*models.Device{}, devices...), nil
+}
+
+func (m *MockDeviceRepository) Stream(ctx context.Context, filter repository.DeviceFilter, fn func(device *models.Device) error) error {
+	devices, err := m.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		if err := fn(device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockDeviceRepository) Suggest(ctx context.Context, field, prefix string, limit int) ([]repository.ValueCount, error) {
+	counts := make(map[string]int)
+	for _, device := range m.devices {
+		value := device.Name
+		if field == "brand" {
+			value = device.Brand
+		}
+		if strings.HasPrefix(strings.ToLower(value), prefix) {
+			counts[value]++
+		}
+	}
+	values := make([]repository.ValueCount, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, repository.ValueCount{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	return values, nil
+}
+
+func (m *MockDeviceRepository) Count(ctx context.Context) ([]repository.DeviceCount, error) {
+	counts := make(map[repository.DeviceCount]int)
+	for _, device := range m.devices {
+		for _, group := range []repository.DeviceCount{
+			{},
+			{State: device.State},
+			{Brand: device.Brand},
+			{Brand: device.Brand, State: device.State},
+		} {
+			counts[group]++
+		}
+	}
+	result := make([]repository.DeviceCount, 0, len(counts))
+	for group, count := range counts {
+		group.Count = count
+		result = append(result, group)
+	}
+	return result, nil
+}
+
+func (m *MockDeviceRepository) CountCreated(ctx context.Context, interval models.StatsInterval, from, to time.Time) ([]models.CreationBucket, error) {
+	counts := make(map[models.Date]int)
+	for _, device := range m.devices {
+		if !device.CreationTime.Before(from) && device.CreationTime.Before(to) {
+			counts[interval.Truncate(models.NewDate(device.CreationTime))]++
+		}
+	}
+	buckets := make([]models.CreationBucket, 0, len(counts))
+	for start, count := range counts {
+		buckets = append(buckets, models.CreationBucket{Start: start, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start.Time) })
+	return buckets, nil
+}
+
 func (m *MockDeviceRepository) GetByBrand(ctx context.Context, brand string) ([]*models.Device, error) {
 	var devices []*models.Device
 	for _, device := range m.devices {
@@ -68,19 +296,53 @@ func (m *MockDeviceRepository) GetByState(ctx context.Context, state models.Devi
 	return devices, nil
 }
 
+func (m *MockDeviceRepository) GetByLocation(ctx context.Context, locationID string) ([]*models.Device, error) {
+	var devices []*models.Device
+	for _, device := range m.devices {
+		if device.LocationID != nil && *device.LocationID == locationID {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func (m *MockDeviceRepository) GetByWarrantyExpiry(ctx context.Context, from, to models.Date) ([]*models.Device, error) {
+	devices := []*models.Device{}
+	for _, device := range m.devices {
+		if device.WarrantyExpiry != nil && !device.WarrantyExpiry.Before(from.Time) && !device.WarrantyExpiry.After(to.Time) {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func (m *MockDeviceRepository) GetChildren(ctx context.Context, parentID string) ([]*models.Device, error) {
+	devices := []*models.Device{}
+	for _, device := range m.devices {
+		if device.ParentID != nil && *device.ParentID == parentID {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
 func (m *MockDeviceRepository) Update(ctx context.Context, device *models.Device) error {
 	if _, exists := m.devices[device.ID]; !exists {
 		return errors.New("device not found")
 	}
 	m.devices[device.ID] = device
+	m.recordStateChange(device, time.Now())
+	m.recordChange(models.DeviceUpdated, device)
 	return nil
 }
 
 func (m *MockDeviceRepository) Delete(ctx context.Context, id string) error {
-	if _, exists := m.devices[id]; !exists {
+	device, exists := m.devices[id]
+	if !exists {
 		return errors.New("device not found")
 	}
 	delete(m.devices, id)
+	m.recordChange(models.DeviceDeleted, device)
 	return nil
 }
 
@@ -89,6 +351,86 @@ func (m *MockDeviceRepository) Exists(ctx context.Context, id string) (bool, err
 	return exists, nil
 }
 
+func (m *MockDeviceRepository) MoveToLocation(ctx context.Context, deviceID, locationID string) (*models.DeviceMove, error) {
+	device, exists := m.devices[deviceID]
+	if !exists {
+		return nil, errors.New("device not found")
+	}
+	move := &models.DeviceMove{
+		DeviceID:       deviceID,
+		FromLocationID: device.LocationID,
+		ToLocationID:   locationID,
+		MovedAt:        time.Now(),
+	}
+	device.LocationID = &locationID
+	m.moves = append([]*models.DeviceMove{move}, m.moves...)
+	m.recordChange(models.DeviceUpdated, device)
+	return move, nil
+}
+
+func (m *MockDeviceRepository) GetMoves(ctx context.Context, deviceID string) ([]*models.DeviceMove, error) {
+	moves := []*models.DeviceMove{}
+	for _, move := range m.moves {
+		if move.DeviceID == deviceID {
+			moves = append(moves, move)
+		}
+	}
+	return moves, nil
+}
+
+func (m *MockDeviceRepository) GetStateChanges(ctx context.Context, from, to time.Time) ([]*models.StateChange, error) {
+	initial := make(map[string]*models.StateChange)
+	var changes []*models.StateChange
+	for _, change := range m.stateChanges {
+		switch {
+		case change.ChangedAt.Before(from):
+			initial[change.DeviceID] = change
+		case change.ChangedAt.Before(to):
+			changes = append(changes, change)
+		}
+	}
+	for _, change := range initial {
+		changes = append(changes, change)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].DeviceID != changes[j].DeviceID {
+			return changes[i].DeviceID < changes[j].DeviceID
+		}
+		return changes[i].ChangedAt.Before(changes[j].ChangedAt)
+	})
+	return changes, nil
+}
+
+func (m *MockDeviceRepository) GetChanges(ctx context.Context, since int64, limit int) ([]*models.DeviceChange, error) {
+	changes := []*models.DeviceChange{}
+	for _, change := range m.changes {
+		if change.Sequence > since && len(changes) < limit {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// WithTx restores a snapshot of the stored devices and drops the logged
+// changes when fn fails
+func (m *MockDeviceRepository) WithTx(ctx context.Context, fn func(repo repository.DeviceRepository) error) error {
+	snapshot := make(map[string]models.Device, len(m.devices))
+	for id, device := range m.devices {
+		snapshot[id] = *device
+	}
+	logged := len(m.changes)
+
+	if err := fn(m); err != nil {
+		m.devices = make(map[string]*models.Device, len(snapshot))
+		for id, device := range snapshot {
+			m.devices[id] = &device
+		}
+		m.changes = m.changes[:logged]
+		return err
+	}
+	return nil
+}
+
 func TestDeviceService_CreateDevice(t *testing.T) {
 	mockRepo := NewMockDeviceRepository()
 	deviceService := service.NewDeviceService(mockRepo)
@@ -348,7 +690,629 @@ func TestDeviceService_DeleteDevice(t *testing.T) {
 	}
 }
 
+func TestDeviceService_MoveDevice(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.devices["device-1"] = &models.Device{
+		ID:           "device-1",
+		Name:         "Test Device",
+		Brand:        "Test Brand",
+		State:        models.StateAvailable,
+		CreationTime: time.Now(),
+	}
+
+	// First placement has no previous location
+	move, err := deviceService.MoveDevice(ctx, "device-1", service.MoveDeviceRequest{LocationID: "room-1"})
+	assert.NoError(t, err)
+	assert.Nil(t, move.FromLocationID)
+	assert.Equal(t, "room-1", move.ToLocationID)
+
+	// Moving again records the previous location
+	move, err = deviceService.MoveDevice(ctx, "device-1", service.MoveDeviceRequest{LocationID: "room-2"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, move.FromLocationID) {
+		assert.Equal(t, "room-1", *move.FromLocationID)
+	}
+
+	// Moving into the current location is rejected
+	_, err = deviceService.MoveDevice(ctx, "device-1", service.MoveDeviceRequest{LocationID: "room-2"})
+	assert.Error(t, err)
+
+	// Missing location ID is rejected
+	_, err = deviceService.MoveDevice(ctx, "device-1", service.MoveDeviceRequest{})
+	assert.Error(t, err)
+
+	moves, err := deviceService.GetDeviceMoves(ctx, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, moves, 2)
+
+	_, err = deviceService.GetDeviceMoves(ctx, "non-existing")
+	assert.Error(t, err)
+}
+
+func TestDeviceService_Kits(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo)
+	ctx := context.Background()
+
+	for _, id := range []string{"laptop", "dock", "charger"} {
+		mockRepo.devices[id] = &models.Device{
+			ID:           id,
+			Name:         id,
+			Brand:        "Test Brand",
+			State:        models.StateAvailable,
+			CreationTime: time.Now(),
+		}
+	}
+
+	// Attach components to the laptop, locking the parent before the child
+	_, err := deviceService.AttachChild(ctx, "laptop", service.AttachChildRequest{ChildID: "dock"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"laptop", "dock"}, mockRepo.locked)
+	_, err = deviceService.AttachChild(ctx, "laptop", service.AttachChildRequest{ChildID: "charger"})
+	assert.NoError(t, err)
+
+	// Kits are a single level deep and a device cannot be its own component
+	_, err = deviceService.AttachChild(ctx, "dock", service.AttachChildRequest{ChildID: "laptop"})
+	assert.Error(t, err)
+	_, err = deviceService.AttachChild(ctx, "laptop", service.AttachChildRequest{ChildID: "laptop"})
+	assert.Error(t, err)
+
+	children, err := deviceService.GetDeviceChildren(ctx, "laptop")
+	assert.NoError(t, err)
+	assert.Len(t, children, 2)
+
+	// Checking out the kit checks out its components
+	_, err = deviceService.UpdateDevice(ctx, "laptop", service.UpdateDeviceRequest{State: statePtr(models.StateInUse)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateInUse, mockRepo.devices["dock"].State)
+	assert.Equal(t, models.StateInUse, mockRepo.devices["charger"].State)
+
+	// A parent with attached children cannot be deleted
+	_, err = deviceService.UpdateDevice(ctx, "laptop", service.UpdateDeviceRequest{State: statePtr(models.StateAvailable)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateAvailable, mockRepo.devices["dock"].State)
+	err = deviceService.DeleteDevice(ctx, "laptop")
+	assert.Error(t, err)
+
+	// Detaching leaves the parent deletable. Both lock the devices they check,
+	// so that no component can be attached to a device being deleted.
+	mockRepo.locked = nil
+	assert.NoError(t, deviceService.DetachChild(ctx, "laptop", "dock"))
+	assert.Equal(t, []string{"laptop", "dock"}, mockRepo.locked)
+	assert.NoError(t, deviceService.DetachChild(ctx, "laptop", "charger"))
+	assert.Error(t, deviceService.DetachChild(ctx, "laptop", "charger"))
+	mockRepo.locked = nil
+	assert.NoError(t, deviceService.DeleteDevice(ctx, "laptop"))
+	assert.Equal(t, []string{"laptop"}, mockRepo.locked)
+}
+
+func TestDeviceService_SerialNumbersAndAssetTags(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo, service.WithAssetTagPattern("LAB-######"))
+	ctx := context.Background()
+
+	first, err := deviceService.CreateDevice(ctx, service.CreateDeviceRequest{
+		Name: "Galaxy S24", Brand: "Samsung", SerialNumber: " R58N123 ", State: models.StateAvailable,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "R58N123", first.SerialNumber)
+	assert.Equal(t, "LAB-000001", first.AssetTag)
+
+	second, err := deviceService.CreateDevice(ctx, service.CreateDeviceRequest{
+		Name: "iPhone 15", Brand: "Apple", SerialNumber: "R58N123", State: models.StateAvailable,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "LAB-000002", second.AssetTag)
+
+	// Serial numbers are unique per brand
+	_, err = deviceService.CreateDevice(ctx, service.CreateDeviceRequest{
+		Name: "Galaxy S24", Brand: "Samsung", SerialNumber: "R58N123", State: models.StateAvailable,
+	})
+	assert.ErrorContains(t, err, "already exists")
+
+	device, err := deviceService.GetDeviceBySerialNumber(ctx, "Apple", "R58N123")
+	assert.NoError(t, err)
+	assert.Equal(t, second.ID, device.ID)
+
+	device, err = deviceService.GetDeviceByAssetTag(ctx, "LAB-000001")
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, device.ID)
+
+	_, err = deviceService.GetDeviceByAssetTag(ctx, "LAB-999999")
+	assert.Error(t, err)
+}
+
+func TestDeviceService_Procurement(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo)
+	ctx := context.Background()
+
+	today := models.Today()
+	purchased := models.NewDate(today.AddDate(-1, 0, 0))
+	soon := models.NewDate(today.AddDate(0, 0, 10))
+	later := models.NewDate(today.AddDate(0, 3, 0))
+
+	expiring, err := deviceService.CreateDevice(ctx, service.CreateDeviceRequest{
+		Name: "MacBook Pro", Brand: "Apple", State: models.StateAvailable,
+		PurchaseDate: &purchased, PurchaseCost: floatPtr(3000), Vendor: "Reseller", WarrantyExpiry: &soon,
+	})
+	assert.NoError(t, err)
+	unpriced, err := deviceService.CreateDevice(ctx, service.CreateDeviceRequest{
+		Name: "ThinkPad", Brand: "Lenovo", State: models.StateAvailable, WarrantyExpiry: &later,
+	})
+	assert.NoError(t, err)
+
+	// Warranty cannot end before the purchase
+	_, err = deviceService.CreateDevice(ctx, service.CreateDeviceRequest{
+		Name: "ThinkPad", Brand: "Lenovo", State: models.StateAvailable, PurchaseDate: &later, WarrantyExpiry: &soon,
+	})
+	assert.ErrorContains(t, err, "validation failed")
+
+	devices, err := deviceService.GetDevicesWithExpiringWarranty(ctx, 30)
+	assert.NoError(t, err)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, expiring.ID, devices[0].ID)
+	}
+
+	valuation, err := deviceService.GetDeviceValuation(ctx, expiring.ID, service.ValuationRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.DepreciationStraightLine, valuation.Method)
+	assert.InDelta(t, 2000, valuation.BookValue, 5)
+
+	// Devices without procurement data cannot be valued
+	_, err = deviceService.GetDeviceValuation(ctx, unpriced.ID, service.ValuationRequest{})
+	assert.ErrorContains(t, err, "validation failed")
+}
+
+func TestDeviceService_ReplaceAndPatchDevice(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo)
+	ctx := context.Background()
+
+	device, err := deviceService.CreateDevice(ctx, service.CreateDeviceRequest{
+		Name: "Phone", Brand: "Acme", SerialNumber: "SN-1", State: models.StateAvailable, Vendor: "Reseller", PurchaseCost: floatPtr(500),
+	})
+	assert.NoError(t, err)
+
+	// PUT requires the full representation and clears omitted fields
+	_, err = deviceService.ReplaceDevice(ctx, device.ID, service.ReplaceDeviceRequest{Name: "Phone"})
+	assert.ErrorContains(t, err, "validation failed")
+	replaced, err := deviceService.ReplaceDevice(ctx, device.ID, service.ReplaceDeviceRequest{
+		Name: "Phone 2", Brand: "Acme", State: models.StateAvailable,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Phone 2", replaced.Name)
+	assert.Empty(t, replaced.SerialNumber)
+	assert.Empty(t, replaced.Vendor)
+	assert.Nil(t, replaced.PurchaseCost)
+	assert.Equal(t, device.AssetTag, replaced.AssetTag)
+
+	// An in-use device can be replaced unchanged but not renamed
+	_, err = deviceService.ReplaceDevice(ctx, device.ID, service.ReplaceDeviceRequest{Name: "Phone 2", Brand: "Acme", State: models.StateInUse})
+	assert.NoError(t, err)
+	_, err = deviceService.ReplaceDevice(ctx, device.ID, service.ReplaceDeviceRequest{Name: "Phone 2", Brand: "Acme", State: models.StateInUse, Vendor: "Shop"})
+	assert.NoError(t, err)
+	_, err = deviceService.ReplaceDevice(ctx, device.ID, service.ReplaceDeviceRequest{Name: "Phone 3", Brand: "Acme", State: models.StateInUse})
+	assert.ErrorContains(t, err, "cannot update name and brand")
+
+	// Merge patches apply state before the rename and null clears a field
+	patched, err := deviceService.PatchDevice(ctx, device.ID, service.MergePatch, []byte(`{"state":"available","name":"Phone 3","vendor":null}`))
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateAvailable, patched.State)
+	assert.Equal(t, "Phone 3", patched.Name)
+	assert.Empty(t, patched.Vendor)
+
+	// JSON Patch test operations guard conditional edits
+	_, err = deviceService.PatchDevice(ctx, device.ID, service.JSONPatch, []byte(`[{"op":"test","path":"/name","value":"Phone 2"},{"op":"replace","path":"/name","value":"Phone 4"}]`))
+	assert.ErrorContains(t, err, "patch test failed")
+	patched, err = deviceService.PatchDevice(ctx, device.ID, service.JSONPatch, []byte(`[{"op":"test","path":"/name","value":"Phone 3"},{"op":"replace","path":"/name","value":"Phone 4"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Phone 4", patched.Name)
+
+	// Patches go through the same rules as other updates
+	for _, tt := range []struct {
+		name      string
+		patchType service.PatchType
+		patch     string
+	}{
+		{"read-only field", service.MergePatch, `{"id":"other"}`},
+		{"removed asset tag", service.JSONPatch, `[{"op":"remove","path":"/asset_tag"}]`},
+		{"unknown field", service.MergePatch, `{"color":"red"}`},
+		{"wrong type", service.MergePatch, `{"name":5}`},
+		{"missing name", service.JSONPatch, `[{"op":"remove","path":"/name"}]`},
+		{"maintenance without ticket", service.MergePatch, `{"state":"maintenance"}`},
+		{"negative cost", service.MergePatch, `{"purchase_cost":-1}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := deviceService.PatchDevice(ctx, device.ID, tt.patchType, []byte(tt.patch))
+			assert.Error(t, err)
+		})
+	}
+
+	current, err := deviceService.GetDevice(ctx, device.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Phone 4", current.Name)
+	assert.Equal(t, models.StateAvailable, current.State)
+
+	_, err = deviceService.PatchDevice(ctx, "missing", service.MergePatch, []byte(`{}`))
+	assert.ErrorContains(t, err, "not found")
+}
+
+// searchingDeviceRepository is a device repository that ranks searches itself
+type searchingDeviceRepository struct {
+	*MockDeviceRepository
+	queries []string
+}
+
+func (r *searchingDeviceRepository) Search(ctx context.Context, query string, limit int) ([]repository.DeviceMatch, error) {
+	r.queries = append(r.queries, query)
+	return []repository.DeviceMatch{{Device: r.devices["galaxy"], Score: 0.9}}, nil
+}
+
+func TestDeviceService_SearchDevices(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo)
+	ctx := context.Background()
+
+	for _, device := range []*models.Device{
+		{ID: "galaxy", Name: "Galaxy S23", Brand: "Samsung", SerialNumber: "R58N", State: models.StateAvailable},
+		{ID: "galaxy-tab", Name: "Galaxy Tab S9", Brand: "Samsung", State: models.StateAvailable},
+		{ID: "iphone", Name: "iPhone 15", Brand: "Apple", Vendor: "Galaxy Resellers", State: models.StateAvailable},
+		{ID: "thinkpad", Name: "ThinkPad X1", Brand: "Lenovo", State: models.StateAvailable},
+	} {
+		mockRepo.devices[device.ID] = device
+	}
+
+	// Devices matching every term rank first and the terms are highlighted
+	results, err := deviceService.SearchDevices(ctx, service.SearchRequest{Query: "galaxy s23"})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, "galaxy", results[0].Device.ID)
+		assert.Equal(t, "galaxy-tab", results[1].Device.ID)
+		assert.Equal(t, "iphone", results[2].Device.ID)
+		assert.Equal(t, map[string]string{"name": "<mark>Galaxy</mark> <mark>S23</mark>"}, results[0].Highlights)
+		assert.Equal(t, map[string]string{"vendor": "<mark>Galaxy</mark> Resellers"}, results[2].Highlights)
+		assert.Greater(t, results[0].Score, results[1].Score)
+	}
+
+	// Misspelled terms still match, without highlights
+	results, err = deviceService.SearchDevices(ctx, service.SearchRequest{Query: "thinkapd"})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "thinkpad", results[0].Device.ID)
+		assert.Nil(t, results[0].Highlights)
+	}
+
+	// Prefixes match
+	results, err = deviceService.SearchDevices(ctx, service.SearchRequest{Query: "sams", Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "galaxy", results[0].Device.ID)
+		assert.Equal(t, "<mark>Sams</mark>ung", results[0].Highlights["brand"])
+	}
+
+	results, err = deviceService.SearchDevices(ctx, service.SearchRequest{Query: "xyzzy"})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	_, err = deviceService.SearchDevices(ctx, service.SearchRequest{Query: " - "})
+	assert.ErrorContains(t, err, "validation failed")
+	_, err = deviceService.SearchDevices(ctx, service.SearchRequest{Query: "galaxy", Limit: 101})
+	assert.ErrorContains(t, err, "validation failed")
+
+	// Repositories that implement DeviceSearcher rank the devices themselves
+	searchingRepo := &searchingDeviceRepository{MockDeviceRepository: mockRepo}
+	results, err = service.NewDeviceService(searchingRepo).SearchDevices(ctx, service.SearchRequest{Query: " galaxy "})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"galaxy"}, searchingRepo.queries)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, 0.9, results[0].Score)
+		assert.Equal(t, "<mark>Galaxy</mark> S23", results[0].Highlights["name"])
+	}
+
+	// Highlights are HTML-escaped and find terms at non-ASCII word boundaries
+	mockRepo.devices["markup"] = &models.Device{ID: "markup", Name: `<img src=x onerror=alert(1)> Öko Écran`, Brand: "Acme", State: models.StateAvailable}
+	results, err = deviceService.SearchDevices(ctx, service.SearchRequest{Query: "img écran"})
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, results) {
+		assert.Equal(t, "markup", results[0].Device.ID)
+		assert.Equal(t, "&lt;<mark>img</mark> src=x onerror=alert(1)&gt; Öko <mark>Écran</mark>", results[0].Highlights["name"])
+	}
+}
+
 // Helper functions
+// countingSuggestRepository counts the suggestion queries that reach the repository
+type countingSuggestRepository struct {
+	*MockDeviceRepository
+	suggestCalls int
+}
+
+func (r *countingSuggestRepository) Suggest(ctx context.Context, field, prefix string, limit int) ([]repository.ValueCount, error) {
+	r.suggestCalls++
+	return r.MockDeviceRepository.Suggest(ctx, field, prefix, limit)
+}
+
+func TestDeviceService_SuggestValues(t *testing.T) {
+	repo := &countingSuggestRepository{MockDeviceRepository: NewMockDeviceRepository()}
+	deviceService := service.NewDeviceService(repo)
+	ctx := context.Background()
+
+	for _, device := range []*models.Device{
+		{ID: "s23", Name: "Galaxy S23", Brand: "Samsung", State: models.StateAvailable},
+		{ID: "s24", Name: "Galaxy S24", Brand: "Samsung", State: models.StateAvailable},
+		{ID: "tv", Name: "Smart TV", Brand: "Sanyo", State: models.StateAvailable},
+		{ID: "iphone", Name: "iPhone 15", Brand: "Apple", State: models.StateAvailable},
+	} {
+		repo.devices[device.ID] = device
+	}
+
+	suggestions, err := deviceService.SuggestValues(ctx, service.SuggestRequest{Field: "brand", Prefix: "SA"})
+	assert.NoError(t, err)
+	assert.Equal(t, []service.Suggestion{{Value: "Samsung", Count: 2}, {Value: "Sanyo", Count: 1}}, suggestions)
+
+	suggestions, err = deviceService.SuggestValues(ctx, service.SuggestRequest{Field: "brand", Prefix: "sa"})
+	assert.NoError(t, err)
+	assert.Len(t, suggestions, 2)
+	assert.Equal(t, 1, repo.suggestCalls, "same prefix in another case should be served from the cache")
+
+	_, err = deviceService.CreateDevice(ctx, service.CreateDeviceRequest{Name: "Satellite", Brand: "Sanyo", State: models.StateAvailable})
+	assert.NoError(t, err)
+	suggestions, err = deviceService.SuggestValues(ctx, service.SuggestRequest{Field: "brand", Prefix: "sa"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repo.suggestCalls, "a write should invalidate the cache")
+	assert.Equal(t, []service.Suggestion{{Value: "Samsung", Count: 2}, {Value: "Sanyo", Count: 2}}, suggestions)
+
+	suggestions, err = deviceService.SuggestValues(ctx, service.SuggestRequest{Field: "name", Prefix: "galaxy", Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []service.Suggestion{{Value: "Galaxy S23", Count: 1}}, suggestions)
+
+	_, err = deviceService.SuggestValues(ctx, service.SuggestRequest{Field: "serial_number", Prefix: "a"})
+	assert.ErrorContains(t, err, "validation failed")
+	_, err = deviceService.SuggestValues(ctx, service.SuggestRequest{Field: "brand", Limit: service.MaxSuggestLimit + 1})
+	assert.ErrorContains(t, err, "validation failed")
+}
+
+func TestDeviceService_Batch(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo)
+	ctx := context.Background()
+
+	items := []service.CreateDeviceRequest{
+		{Name: "Phone 1", Brand: "Acme", SerialNumber: "SN-1", State: models.StateAvailable},
+		{Name: "Phone 2", Brand: "Acme", SerialNumber: "SN-2", State: models.StateAvailable},
+		{Name: "", Brand: "Acme", State: models.StateAvailable},
+	}
+
+	// An atomic batch with an invalid item creates nothing
+	result, err := deviceService.BatchCreateDevices(ctx, service.BatchCreateRequest{Items: items})
+	assert.NoError(t, err)
+	assert.Equal(t, service.BatchAtomic, result.Mode)
+	assert.Equal(t, 0, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, service.BatchItemAborted, result.Results[0].Status)
+	assert.Equal(t, service.BatchItemFailed, result.Results[2].Status)
+	assert.NotEmpty(t, result.Results[2].Error)
+	assert.Empty(t, mockRepo.devices)
+
+	// A best-effort batch keeps the valid items
+	result, err = deviceService.BatchCreateDevices(ctx, service.BatchCreateRequest{Mode: service.BatchBestEffort, Items: items})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	assert.Len(t, mockRepo.devices, 2)
+	first, second := result.Results[0].ID, result.Results[1].ID
+	assert.NotEmpty(t, first)
+	assert.NotEmpty(t, result.Results[1].Device.AssetTag)
+
+	// Updates go through the same rules as single updates
+	inUse := models.StateInUse
+	result, err = deviceService.BatchUpdateDevices(ctx, service.BatchUpdateRequest{
+		Mode: service.BatchBestEffort,
+		Items: []service.BatchUpdateItem{
+			{ID: first, UpdateDeviceRequest: service.UpdateDeviceRequest{State: &inUse}},
+			{ID: "non-existing", UpdateDeviceRequest: service.UpdateDeviceRequest{State: &inUse}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, service.BatchItemSucceeded, result.Results[0].Status)
+	assert.Equal(t, service.BatchItemFailed, result.Results[1].Status)
+	assert.Equal(t, "non-existing", result.Results[1].ID)
+	assert.Equal(t, models.StateInUse, mockRepo.devices[first].State)
+
+	// An in-use device rolls back the whole atomic delete
+	result, err = deviceService.BatchDeleteDevices(ctx, service.BatchDeleteRequest{IDs: []string{second, first}})
+	assert.NoError(t, err)
+	assert.Equal(t, service.BatchItemAborted, result.Results[0].Status)
+	assert.Equal(t, service.BatchItemFailed, result.Results[1].Status)
+	assert.Len(t, mockRepo.devices, 2)
+
+	result, err = deviceService.BatchDeleteDevices(ctx, service.BatchDeleteRequest{Mode: service.BatchBestEffort, IDs: []string{second, first}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Len(t, mockRepo.devices, 1)
+
+	// Empty batches and unknown modes are rejected
+	_, err = deviceService.BatchDeleteDevices(ctx, service.BatchDeleteRequest{})
+	assert.Error(t, err)
+	_, err = deviceService.BatchDeleteDevices(ctx, service.BatchDeleteRequest{Mode: "sometimes", IDs: []string{first}})
+	assert.Error(t, err)
+}
+
+func TestDeviceService_BulkUpdate(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo, service.WithBulkBatchSize(2))
+	ctx := context.Background()
+
+	for i, state := range []models.DeviceState{models.StateInactive, models.StateInactive, models.StateInUse, models.StateInactive, models.StateMaintenance} {
+		id := fmt.Sprintf("device-%d", i)
+		mockRepo.devices[id] = &models.Device{
+			ID:           id,
+			Name:         "Phone",
+			Brand:        "Acme",
+			State:        state,
+			CreationTime: time.Now(),
+		}
+	}
+	mockRepo.devices["other"] = &models.Device{ID: "other", Name: "Phone", Brand: "Other", State: models.StateInactive}
+
+	// A dry run reports the affected devices without changing them
+	available := models.StateAvailable
+	result, err := deviceService.BulkUpdateDevices(ctx, service.BulkUpdateRequest{
+		Filter: service.DeviceFilter{Brand: "Acme", State: models.StateInactive},
+		Set:    service.BulkChanges{State: &available},
+		DryRun: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Matched)
+	assert.Equal(t, []string{"device-0", "device-1", "device-3"}, result.AffectedIDs)
+	assert.Equal(t, models.StateInactive, mockRepo.devices["device-0"].State)
+
+	// The real run changes every match across batches
+	result, err = deviceService.BulkUpdateDevices(ctx, service.BulkUpdateRequest{
+		Filter: service.DeviceFilter{Brand: "Acme", State: models.StateInactive},
+		Set:    service.BulkChanges{State: &available},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, result.AffectedIDs, 3)
+	assert.Equal(t, models.StateAvailable, mockRepo.devices["device-3"].State)
+	assert.Equal(t, models.StateInactive, mockRepo.devices["other"].State)
+
+	// Renaming skips in-use devices and reports them as violations
+	result, err = deviceService.BulkUpdateDevices(ctx, service.BulkUpdateRequest{
+		Filter: service.DeviceFilter{Brand: "Acme"},
+		Set:    service.BulkChanges{Name: stringPtr("Handset")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, result.Matched)
+	assert.Equal(t, []string{"device-0", "device-1", "device-3", "device-4"}, result.AffectedIDs)
+	if assert.Len(t, result.Violations, 1) {
+		assert.Equal(t, "device-2", result.Violations[0].ID)
+	}
+	assert.Equal(t, "Phone", mockRepo.devices["device-2"].Name)
+	assert.Equal(t, "Handset", mockRepo.devices["device-4"].Name)
+
+	// Devices under maintenance keep their state
+	result, err = deviceService.BulkUpdateDevices(ctx, service.BulkUpdateRequest{
+		Filter: service.DeviceFilter{State: models.StateMaintenance},
+		Set:    service.BulkChanges{State: &available},
+		DryRun: true,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, result.AffectedIDs)
+	assert.Len(t, result.Violations, 1)
+
+	// A filter and at least one change are required
+	_, err = deviceService.BulkUpdateDevices(ctx, service.BulkUpdateRequest{Set: service.BulkChanges{State: &available}})
+	assert.Error(t, err)
+	_, err = deviceService.BulkUpdateDevices(ctx, service.BulkUpdateRequest{Filter: service.DeviceFilter{Brand: "Acme"}})
+	assert.Error(t, err)
+}
+
+func TestDeviceService_Import(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	deviceService := service.NewDeviceService(mockRepo)
+	ctx := context.Background()
+
+	csvFile := `name,brand,serial_number,state,purchase_cost
+Phone 1,Acme,SN-1,available,199.99
+Phone 2,Acme,SN-2,available,abc
+Phone 3,Acme,SN-1,available,
+,Acme,SN-4,available,
+`
+
+	// Every invalid row is reported with its line number and nothing is written
+	result, err := deviceService.ImportDevices(ctx, strings.NewReader(csvFile), service.ImportRequest{Format: service.ImportCSV})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.Rows)
+	assert.Equal(t, 3, result.Failed)
+	assert.Equal(t, 1, result.Aborted)
+	if assert.Len(t, result.Errors, 3) {
+		assert.Equal(t, 3, result.Errors[0].Line)
+		assert.Equal(t, 4, result.Errors[1].Line)
+		assert.Contains(t, result.Errors[1].Error, "line 2")
+		assert.Equal(t, 5, result.Errors[2].Line)
+	}
+	assert.Empty(t, mockRepo.devices)
+
+	// Best-effort keeps the valid rows
+	result, err = deviceService.ImportDevices(ctx, strings.NewReader(csvFile), service.ImportRequest{
+		Format: service.ImportCSV,
+		Mode:   service.BatchBestEffort,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Len(t, mockRepo.devices, 1)
+
+	ndjson := `{"name": "Phone 1 (refurbished)", "brand": "Acme", "serial_number": "SN-1", "state": "inactive"}
+
+{"name": "Phone 5", "brand": "Acme", "serial_number": "SN-5", "state": "available"}
+{"name": "Phone 6", "brand": "Acme", "colour": "red", "state": "available"}
+`
+
+	// Existing serial numbers conflict unless upserting
+	result, err = deviceService.ImportDevices(ctx, strings.NewReader(ndjson), service.ImportRequest{
+		Format: service.ImportNDJSON,
+		DryRun: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Failed)
+	if assert.Len(t, result.Errors, 2) {
+		assert.Equal(t, 1, result.Errors[0].Line)
+		assert.Contains(t, result.Errors[0].Error, "already exists")
+		assert.Equal(t, 4, result.Errors[1].Line)
+	}
+
+	// A dry run reports the would-be outcome without writing
+	result, err = deviceService.ImportDevices(ctx, strings.NewReader(ndjson), service.ImportRequest{
+		Format:         service.ImportNDJSON,
+		Mode:           service.BatchBestEffort,
+		DryRun:         true,
+		UpsertBySerial: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 1, result.Failed)
+	assert.Len(t, mockRepo.devices, 1)
+
+	result, err = deviceService.ImportDevices(ctx, strings.NewReader(ndjson), service.ImportRequest{
+		Format:         service.ImportNDJSON,
+		Mode:           service.BatchBestEffort,
+		UpsertBySerial: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Updated)
+	assert.Len(t, mockRepo.devices, 2)
+	device, err := deviceService.GetDeviceBySerialNumber(ctx, "Acme", "SN-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Phone 1 (refurbished)", device.Name)
+	assert.Equal(t, models.StateInactive, device.State)
+
+	// Unknown CSV columns reject the whole file
+	_, err = deviceService.ImportDevices(ctx, strings.NewReader("name,colour\nPhone,red\n"), service.ImportRequest{Format: service.ImportCSV})
+	assert.Error(t, err)
+
+	// So does a quoting error, as the rows after it cannot be read
+	_, err = deviceService.ImportDevices(ctx, strings.NewReader("name,brand,state\nPhone 7,Acme,available\n\"Phone \"8\",Acme,available\nPhone 9,Acme,available\n"), service.ImportRequest{Format: service.ImportCSV})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line 3")
+	}
+
+	// Serial numbers repeated under a brand with surrounding spaces are duplicates
+	result, err = deviceService.ImportDevices(ctx, strings.NewReader(`{"name": "Phone 10", "brand": "Acme", "serial_number": "SN-10", "state": "available"}
+{"name": "Phone 11", "brand": " Acme ", "serial_number": "SN-10", "state": "available"}
+`), service.ImportRequest{Format: service.ImportNDJSON, DryRun: true})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Errors, 1) {
+		assert.Equal(t, 2, result.Errors[0].Line)
+		assert.Contains(t, result.Errors[0].Error, "repeated from line 1")
+	}
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
@@ -356,3 +1320,7 @@ func stringPtr(s string) *string {
 func statePtr(s models.DeviceState) *models.DeviceState {
 	return &s
 }
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
@@ -2,6 +2,7 @@ package test
 
 import (
 	"devices-api/internal/models"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -89,6 +90,7 @@ func TestDeviceState_IsValid(t *testing.T) {
 		{models.StateAvailable, true},
 		{models.StateInUse, true},
 		{models.StateInactive, true},
+		{models.StateMaintenance, true},
 		{models.DeviceState("invalid"), false},
 		{models.DeviceState(""), false},
 	}
@@ -132,6 +134,7 @@ func TestDevice_CanDelete(t *testing.T) {
 		{models.StateAvailable, true},
 		{models.StateInactive, true},
 		{models.StateInUse, false},
+		{models.StateMaintenance, false},
 	}
 
 	for _, tt := range tests {
@@ -166,6 +169,24 @@ func TestDevice_UpdateState(t *testing.T) {
 	err = device.UpdateState(models.DeviceState("invalid"))
 	assert.Error(t, err)
 	assert.Equal(t, models.StateInUse, device.State)
+
+	// Maintenance is only entered and left through maintenance tickets
+	err = device.UpdateState(models.StateMaintenance)
+	assert.Error(t, err)
+
+	device.EnterMaintenance()
+	err = device.UpdateState(models.StateAvailable)
+	assert.Error(t, err)
+	assert.Equal(t, models.StateMaintenance, device.State)
+
+	device.ExitMaintenance(nil)
+	assert.Equal(t, models.StateAvailable, device.State)
+
+	// Devices return to the state they were in before maintenance
+	inactive := models.StateInactive
+	device.EnterMaintenance()
+	device.ExitMaintenance(&inactive)
+	assert.Equal(t, models.StateInactive, device.State)
 }
 
 func TestDevice_UpdateNameAndBrand(t *testing.T) {
@@ -235,3 +256,187 @@ func TestDevice_UpdateNameAndBrand(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatAssetTag(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		seq         int64
+		expected    string
+		expectError bool
+	}{
+		{"LAB-######", 123, "LAB-000123", false},
+		{"###-HQ", 7, "007-HQ", false},
+		{"T#", 42, "T42", false},
+		{"LAB-", 1, "", true},
+		{"##-##", 1, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			tag, err := models.FormatAssetTag(tt.pattern, tt.seq)
+
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, tag)
+			}
+		})
+	}
+}
+
+func TestCalculateValuation(t *testing.T) {
+	purchased, _ := models.ParseDate("2023-01-01")
+	oneYear, _ := models.ParseDate("2024-01-01")
+	tenYears, _ := models.ParseDate("2033-01-01")
+
+	tests := []struct {
+		name        string
+		params      models.DepreciationParams
+		bookValue   float64
+		expectError bool
+	}{
+		{
+			name: "Straight-line after one year",
+			params: models.DepreciationParams{
+				Method: models.DepreciationStraightLine, PurchaseDate: purchased, PurchaseCost: 1200,
+				SalvageValue: 200, UsefulLifeYears: 4, AsOf: oneYear,
+			},
+			bookValue: 950,
+		},
+		{
+			name: "Declining-balance after one year",
+			params: models.DepreciationParams{
+				Method: models.DepreciationDecliningBalance, PurchaseDate: purchased, PurchaseCost: 1000,
+				UsefulLifeYears: 4, AsOf: oneYear,
+			},
+			bookValue: 500,
+		},
+		{
+			name: "Never below salvage value",
+			params: models.DepreciationParams{
+				Method: models.DepreciationStraightLine, PurchaseDate: purchased, PurchaseCost: 1000,
+				SalvageValue: 100, UsefulLifeYears: 3, AsOf: tenYears,
+			},
+			bookValue: 100,
+		},
+		{
+			name: "Valuation before purchase",
+			params: models.DepreciationParams{
+				Method: models.DepreciationStraightLine, PurchaseDate: oneYear, PurchaseCost: 1000,
+				UsefulLifeYears: 3, AsOf: purchased,
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid method",
+			params: models.DepreciationParams{
+				Method: "sum-of-years", PurchaseDate: purchased, PurchaseCost: 1000, UsefulLifeYears: 3, AsOf: oneYear,
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valuation, err := models.CalculateValuation(tt.params)
+
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.InDelta(t, tt.bookValue, valuation.BookValue, 1)
+				assert.InDelta(t, tt.params.PurchaseCost-valuation.BookValue, valuation.AccumulatedDepreciation, 0.01)
+			}
+		})
+	}
+}
+
+func TestCalculateValuation_DecliningBalanceSchedule(t *testing.T) {
+	purchased, _ := models.ParseDate("2023-03-15")
+
+	// Double-declining balance of 1000 over 5 years, switching to
+	// straight-line in the fourth year
+	for year, bookValue := range []float64{1000, 600, 360, 216, 108, 0, 0} {
+		asOf := models.NewDate(purchased.AddDate(year, 0, 0))
+		valuation, err := models.CalculateValuation(models.DepreciationParams{
+			Method: models.DepreciationDecliningBalance, PurchaseDate: purchased, PurchaseCost: 1000,
+			UsefulLifeYears: 5, AsOf: asOf,
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, bookValue, valuation.BookValue, "year %d", year)
+			assert.Equal(t, float64(year), valuation.AgeYears)
+		}
+	}
+
+	// With a salvage value the schedule stops there
+	bookValues := []float64{1000, 600, 360, 216, 150, 150}
+	for year, bookValue := range bookValues {
+		valuation, err := models.CalculateValuation(models.DepreciationParams{
+			Method: models.DepreciationDecliningBalance, PurchaseDate: purchased, PurchaseCost: 1000,
+			SalvageValue: 150, UsefulLifeYears: 5, AsOf: models.NewDate(purchased.AddDate(year, 0, 0)),
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, bookValue, valuation.BookValue, "year %d", year)
+		}
+	}
+
+	// A year in progress is depreciated pro rata
+	halfway, _ := models.ParseDate("2024-09-13")
+	valuation, err := models.CalculateValuation(models.DepreciationParams{
+		Method: models.DepreciationDecliningBalance, PurchaseDate: purchased, PurchaseCost: 1000,
+		UsefulLifeYears: 5, AsOf: halfway,
+	})
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 480, valuation.BookValue, 1)
+	}
+}
+
+func TestParseDeviceFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		list        string
+		expected    []string
+		expectError bool
+	}{
+		{name: "Single field", list: "state", expected: []string{"state"}},
+		{name: "Representation order", list: "state, id", expected: []string{"id", "state"}},
+		{name: "Duplicates dropped", list: "id,id,,state", expected: []string{"id", "state"}},
+		{name: "Unknown field", list: "id,color", expectError: true},
+		{name: "Empty list", list: " , ", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := models.ParseDeviceFields(tt.list)
+
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, fields)
+			}
+		})
+	}
+}
+
+func TestSparseDevice_MarshalJSON(t *testing.T) {
+	device := &models.Device{ID: "device-1", Name: "Phone", Brand: "Acme", State: models.StateAvailable}
+
+	encoded, err := json.Marshal(models.SparseDevice{Device: device, Fields: []string{"id", "state", "location_id"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"device-1","state":"available","location_id":null}`, string(encoded))
+}
+
+func TestStatsInterval_Truncate(t *testing.T) {
+	// 2024-03-10 is a Sunday
+	day := models.NewDate(time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC))
+
+	assert.Equal(t, "2024-03-10", models.IntervalDay.Truncate(day).String())
+	assert.Equal(t, "2024-03-04", models.IntervalWeek.Truncate(day).String())
+	assert.Equal(t, "2024-03-01", models.IntervalMonth.Truncate(day).String())
+
+	assert.Equal(t, "2024-03-11", models.IntervalWeek.Next(models.IntervalWeek.Truncate(day)).String())
+	assert.Equal(t, "2024-02-01", models.IntervalMonth.Previous(models.IntervalMonth.Truncate(day)).String())
+	assert.False(t, models.StatsInterval("year").IsValid())
+}
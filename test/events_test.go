@@ -0,0 +1,301 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"devices-api/internal/events"
+	"devices-api/internal/handler"
+	"devices-api/internal/models"
+	"devices-api/internal/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingPublisher collects published events
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []models.DeviceEvent
+}
+
+func (p *recordingPublisher) Publish(event models.DeviceEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+}
+
+func (p *recordingPublisher) types() []models.DeviceEventType {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	types := make([]models.DeviceEventType, len(p.events))
+	for i, event := range p.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func publishDevice(bus *events.Bus, eventType models.DeviceEventType, id, brand string) {
+	bus.Publish(models.DeviceEvent{Type: eventType, Device: &models.Device{ID: id, Brand: brand, State: models.StateAvailable}})
+}
+
+func TestBus_Replay(t *testing.T) {
+	bus := events.NewBus(3)
+	sub, _, _ := bus.Subscribe(0, false)
+	defer sub.Close()
+
+	for i := 1; i <= 5; i++ {
+		publishDevice(bus, models.DeviceCreated, "device-"+strconv.Itoa(i), "Acme")
+	}
+	var ids []uint64
+	for i := 0; i < 5; i++ {
+		event := <-sub.Events()
+		ids = append(ids, event.ID)
+		assert.False(t, event.Time.IsZero())
+	}
+	for i := 1; i < len(ids); i++ {
+		assert.Equal(t, ids[i-1]+1, ids[i])
+	}
+
+	// The events after the last one received are replayed while they are kept
+	resumed, replay, ok := bus.Subscribe(ids[2], true)
+	defer resumed.Close()
+	assert.True(t, ok)
+	if assert.Len(t, replay, 2) {
+		assert.Equal(t, ids[3], replay[0].ID)
+		assert.Equal(t, "device-5", replay[1].Device.ID)
+	}
+
+	// A client that is up to date has nothing to replay
+	current, replay, ok := bus.Subscribe(ids[4], true)
+	defer current.Close()
+	assert.True(t, ok)
+	assert.Empty(t, replay)
+
+	// Only the last three events are kept
+	stale, _, ok := bus.Subscribe(ids[0], true)
+	defer stale.Close()
+	assert.False(t, ok)
+
+	// IDs from before the bus existed cannot be resumed from
+	unknown, _, ok := bus.Subscribe(ids[4]+10, true)
+	defer unknown.Close()
+	assert.False(t, ok)
+}
+
+func TestBus_SlowSubscriberIsDropped(t *testing.T) {
+	bus := events.NewBus(10)
+	slow, _, _ := bus.Subscribe(0, false)
+
+	// Publishing never blocks on a subscriber that does not keep up
+	for i := 0; i < 1000; i++ {
+		publishDevice(bus, models.DeviceUpdated, "device-1", "Acme")
+	}
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	assert.Less(t, received, 1000)
+	assert.True(t, slow.Overflowed())
+
+	// Closing the bus ends the remaining subscriptions
+	sub, _, _ := bus.Subscribe(0, false)
+	bus.Close()
+	_, open := <-sub.Events()
+	assert.False(t, open)
+	assert.False(t, sub.Overflowed())
+}
+
+func TestBus_Reset(t *testing.T) {
+	bus := events.NewBus(10)
+	sub, _, _ := bus.Subscribe(0, false)
+	publishDevice(bus, models.DeviceCreated, "device-1", "Acme")
+	publishDevice(bus, models.DeviceCreated, "device-2", "Acme")
+	first := <-sub.Events()
+	last := <-sub.Events()
+
+	// Subscriptions end, and clients cannot resume across the lost events
+	bus.Reset()
+	_, open := <-sub.Events()
+	assert.False(t, open)
+	assert.True(t, sub.Lost())
+	assert.False(t, sub.Overflowed())
+	for _, lastEventID := range []uint64{first.ID, last.ID} {
+		resumed, _, ok := bus.Subscribe(lastEventID, true)
+		resumed.Close()
+		assert.False(t, ok)
+	}
+
+	// Events published after the reset can be resumed from
+	resumed, _, _ := bus.Subscribe(0, false)
+	publishDevice(bus, models.DeviceUpdated, "device-1", "Acme")
+	event := <-resumed.Events()
+	assert.Greater(t, event.ID, last.ID+1)
+	current, replay, ok := bus.Subscribe(event.ID, true)
+	defer current.Close()
+	assert.True(t, ok)
+	assert.Empty(t, replay)
+}
+
+func TestDeviceService_PublishesEvents(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	publisher := &recordingPublisher{}
+	deviceService := service.NewDeviceService(mockRepo, service.WithEventPublisher(publisher))
+	ctx := context.Background()
+
+	device, err := deviceService.CreateDevice(ctx, service.CreateDeviceRequest{Name: "Phone", Brand: "Acme", State: models.StateAvailable})
+	assert.NoError(t, err)
+	name := "Phone 2"
+	_, err = deviceService.UpdateDevice(ctx, device.ID, service.UpdateDeviceRequest{Name: &name})
+	assert.NoError(t, err)
+	assert.NoError(t, deviceService.DeleteDevice(ctx, device.ID))
+
+	assert.Equal(t, []models.DeviceEventType{models.DeviceCreated, models.DeviceUpdated, models.DeviceDeleted}, publisher.types())
+	if assert.Len(t, publisher.events, 3) {
+		assert.Equal(t, "Phone", publisher.events[0].Device.Name)
+		assert.Equal(t, "Phone 2", publisher.events[1].Device.Name)
+		assert.Equal(t, device.ID, publisher.events[2].Device.ID)
+	}
+
+	// Nothing is published for an atomic batch that is rolled back
+	publisher.events = nil
+	result, err := deviceService.BatchCreateDevices(ctx, service.BatchCreateRequest{Items: []service.CreateDeviceRequest{
+		{Name: "Watch", Brand: "Acme", State: models.StateAvailable},
+		{Name: "", Brand: "Acme", State: models.StateAvailable},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Failed)
+	assert.Empty(t, publisher.types())
+
+	// A committed batch publishes every change
+	result, err = deviceService.BatchCreateDevices(ctx, service.BatchCreateRequest{Items: []service.CreateDeviceRequest{
+		{Name: "Watch", Brand: "Acme", State: models.StateAvailable},
+		{Name: "Ring", Brand: "Acme", State: models.StateAvailable},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, []models.DeviceEventType{models.DeviceCreated, models.DeviceCreated}, publisher.types())
+}
+
+// readSSE reads Server-Sent Events from a stream and sends them on a channel
+func readSSE(t *testing.T, resp *http.Response) <-chan map[string]string {
+	messages := make(chan map[string]string, 16)
+	go func() {
+		defer close(messages)
+		scanner := bufio.NewScanner(resp.Body)
+		message := map[string]string{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				if len(message) > 0 {
+					messages <- message
+				}
+				message = map[string]string{}
+				continue
+			}
+			field, value, _ := strings.Cut(line, ":")
+			message[field] = strings.TrimSpace(value)
+		}
+	}()
+	return messages
+}
+
+func nextSSE(t *testing.T, messages <-chan map[string]string) map[string]string {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
+
+func TestDeviceEventHandler_StreamEvents(t *testing.T) {
+	bus := events.NewBus(10)
+	eventHandler := handler.NewDeviceEventHandler(bus, 50*time.Millisecond)
+	server := httptest.NewServer(http.HandlerFunc(eventHandler.StreamEvents))
+	defer server.Close()
+
+	publishDevice(bus, models.DeviceCreated, "device-1", "Acme")
+	publishDevice(bus, models.DeviceCreated, "device-2", "Other")
+	publishDevice(bus, models.DeviceUpdated, "device-1", "Acme")
+
+	// Resuming replays the missed events that match the filter
+	req, _ := http.NewRequest("GET", server.URL+"?brand=Acme", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// ID 0 was never handed out, so the client is told to reload
+	messages := readSSE(t, resp)
+	assert.Equal(t, "reset", nextSSE(t, messages)["event"])
+	message := nextSSE(t, messages)
+	assert.Equal(t, "created", message["event"])
+	firstID, _ := strconv.ParseUint(message["id"], 10, 64)
+	message = nextSSE(t, messages)
+	assert.Equal(t, "updated", message["event"])
+
+	// Live events are filtered as well, and heartbeats keep the stream open
+	publishDevice(bus, models.DeviceDeleted, "device-2", "Other")
+	publishDevice(bus, models.DeviceDeleted, "device-1", "Acme")
+	for {
+		message = nextSSE(t, messages)
+		if message["event"] != "" {
+			break
+		}
+		assert.Equal(t, "heartbeat", message[""])
+	}
+	assert.Equal(t, "deleted", message["event"])
+	var event models.DeviceEvent
+	assert.NoError(t, json.Unmarshal([]byte(message["data"]), &event))
+	assert.Equal(t, "device-1", event.Device.ID)
+	assert.Equal(t, strconv.FormatUint(event.ID, 10), message["id"])
+
+	// A client resuming from the first event it received gets the rest
+	req, _ = http.NewRequest("GET", server.URL+"?brand=Acme", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(firstID, 10))
+	resumed, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resumed.Body.Close()
+	messages = readSSE(t, resumed)
+	assert.Equal(t, "updated", nextSSE(t, messages)["event"])
+	assert.Equal(t, "deleted", nextSSE(t, messages)["event"])
+
+	// Closing the bus ends the streams
+	bus.Close()
+	select {
+	case _, open := <-messages:
+		for open {
+			_, open = <-messages
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not end")
+	}
+}
+
+func TestDeviceEventHandler_InvalidRequest(t *testing.T) {
+	eventHandler := handler.NewDeviceEventHandler(events.NewBus(10), time.Second)
+
+	rr := httptest.NewRecorder()
+	eventHandler.StreamEvents(rr, httptest.NewRequest("GET", "/devices/events?state=broken", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req := httptest.NewRequest("GET", "/devices/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	rr = httptest.NewRecorder()
+	eventHandler.StreamEvents(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"context"
+	"devices-api/internal/middleware"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// MockIdempotencyRepository is an in-memory implementation of IdempotencyRepository
+type MockIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyRecord
+}
+
+func NewMockIdempotencyRepository() *MockIdempotencyRepository {
+	return &MockIdempotencyRepository{records: make(map[string]*models.IdempotencyRecord)}
+}
+
+func (m *MockIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.records[record.Key]; ok && existing.ExpiresAt.After(record.CreatedAt) &&
+		(existing.Completed() || existing.LockedUntil.After(record.CreatedAt)) {
+		copied := *existing
+		return &copied, nil
+	}
+	copied := *record
+	m.records[record.Key] = &copied
+	return nil, nil
+}
+
+func (m *MockIdempotencyRepository) Complete(ctx context.Context, key, token string, statusCode int, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[key]
+	if !ok || record.Token != token || record.Completed() {
+		return repository.ErrReservationLost
+	}
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	return nil
+}
+
+func (m *MockIdempotencyRepository) Release(ctx context.Context, key, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if record, ok := m.records[key]; ok && record.Token == token && !record.Completed() {
+		delete(m.records, key)
+	}
+	return nil
+}
+
+func (m *MockIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var removed int64
+	for key, record := range m.records {
+		if !record.ExpiresAt.After(now) {
+			delete(m.records, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	repo := NewMockIdempotencyRepository()
+	calls := 0
+	status := http.StatusCreated
+	var handler http.Handler
+	var concurrent *httptest.ResponseRecorder
+	// during, when set, runs once while a request is being processed
+	var during func(r *http.Request)
+	handler = middleware.IdempotencyMiddleware(repo, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if fn := during; fn != nil {
+			during = nil
+			fn(r)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "retry-now" {
+			// Retry with the same key while this request is being processed
+			req := httptest.NewRequest("POST", r.URL.String(), strings.NewReader("retry-now"))
+			req.Header.Set(middleware.IdempotencyKeyHeader, r.Header.Get(middleware.IdempotencyKeyHeader))
+			concurrent = httptest.NewRecorder()
+			handler.ServeHTTP(concurrent, req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d,"body":%q}`, calls, body)
+	}))
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/devices", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The first request is processed and retries replay its response
+	first := post("key-1", `{"name":"Phone"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	retry := post("key-1", `{"name":"Phone"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	// Reusing the key for a different body is rejected
+	rr := post("key-1", `{"name":"Tablet"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, 1, calls)
+
+	// Requests without a key are not deduplicated
+	post("", `{"name":"Phone"}`)
+	post("", `{"name":"Phone"}`)
+	assert.Equal(t, 3, calls)
+
+	// Server errors are not stored so the request can be retried
+	status = http.StatusInternalServerError
+	post("key-2", `{}`)
+	status = http.StatusCreated
+	rr = post("key-2", `{}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 5, calls)
+
+	// A retry while the first request is in progress is rejected
+	rr = post("key-3", "retry-now")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, http.StatusConflict, concurrent.Code)
+	assert.Equal(t, 6, calls)
+
+	// Expired keys can be reused for a new request
+	repo.records["key-1"].ExpiresAt = time.Now().Add(-time.Minute)
+	rr = post("key-1", `{"name":"Tablet"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 7, calls)
+
+	// A reservation left behind by a crashed request is taken over once its
+	// lock has lapsed, long before the key expires
+	post("key-4", `{}`)
+	repo.records["key-4"].StatusCode = 0
+	rr = post("key-4", `{}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	repo.records["key-4"].LockedUntil = time.Now().Add(-time.Second)
+	rr = post("key-4", `{}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotEqual(t, "true", rr.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, 9, calls)
+
+	// A request whose lease lapses while it runs neither overwrites the
+	// response of the retry that took over its key nor releases it
+	for _, lateStatus := range []int{http.StatusCreated, http.StatusInternalServerError} {
+		key := fmt.Sprintf("key-late-%d", lateStatus)
+		var takeover *httptest.ResponseRecorder
+		during = func(r *http.Request) {
+			repo.records[key].LockedUntil = time.Now().Add(-time.Second)
+			takeover = post(key, `{}`)
+			status = lateStatus
+		}
+		post(key, `{}`)
+		status = http.StatusCreated
+		assert.Equal(t, http.StatusCreated, takeover.Code)
+
+		before := calls
+		rr = post(key, `{}`)
+		assert.Equal(t, "true", rr.Header().Get(middleware.IdempotentReplayedHeader))
+		assert.Equal(t, takeover.Body.String(), rr.Body.String())
+		assert.Equal(t, before, calls)
+	}
+
+	removed, err := repo.DeleteExpired(context.Background(), time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), removed)
+
+	rr = post(strings.Repeat("k", 256), `{}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,207 @@
+package test
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/service"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// MockLocationRepository is a mock implementation of LocationRepository for testing
+type MockLocationRepository struct {
+	locations map[string]*models.Location
+}
+
+func NewMockLocationRepository() *MockLocationRepository {
+	return &MockLocationRepository{
+		locations: make(map[string]*models.Location),
+	}
+}
+
+func (m *MockLocationRepository) Create(ctx context.Context, location *models.Location) error {
+	if _, exists := m.locations[location.ID]; exists {
+		return errors.New("location already exists")
+	}
+	m.locations[location.ID] = location
+	return nil
+}
+
+func (m *MockLocationRepository) GetByID(ctx context.Context, id string) (*models.Location, error) {
+	location, exists := m.locations[id]
+	if !exists {
+		return nil, errors.New("location not found")
+	}
+	return location, nil
+}
+
+func (m *MockLocationRepository) GetAll(ctx context.Context) ([]*models.Location, error) {
+	var locations []*models.Location
+	for _, location := range m.locations {
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+func (m *MockLocationRepository) GetChildren(ctx context.Context, parentID string) ([]*models.Location, error) {
+	var locations []*models.Location
+	for _, location := range m.locations {
+		if location.ParentID != nil && *location.ParentID == parentID {
+			locations = append(locations, location)
+		}
+	}
+	return locations, nil
+}
+
+func (m *MockLocationRepository) Update(ctx context.Context, location *models.Location) error {
+	if _, exists := m.locations[location.ID]; !exists {
+		return errors.New("location not found")
+	}
+	m.locations[location.ID] = location
+	return nil
+}
+
+func (m *MockLocationRepository) Delete(ctx context.Context, id string) error {
+	if _, exists := m.locations[id]; !exists {
+		return errors.New("location not found")
+	}
+	for _, location := range m.locations {
+		if location.ParentID != nil && *location.ParentID == id {
+			return errors.New("cannot delete location while it contains locations or devices")
+		}
+	}
+	delete(m.locations, id)
+	return nil
+}
+
+func newTestLocation(id string, locationType models.LocationType, parentID *string) *models.Location {
+	return &models.Location{
+		ID:           id,
+		Name:         id,
+		Type:         locationType,
+		ParentID:     parentID,
+		CreationTime: time.Now(),
+	}
+}
+
+func TestLocationService_CreateLocation(t *testing.T) {
+	mockRepo := NewMockLocationRepository()
+	locationService := service.NewLocationService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.locations["site-1"] = newTestLocation("site-1", models.LocationSite, nil)
+	mockRepo.locations["building-1"] = newTestLocation("building-1", models.LocationBuilding, stringPtr("site-1"))
+
+	tests := []struct {
+		name        string
+		request     service.CreateLocationRequest
+		expectError bool
+	}{
+		{
+			name:        "Valid site",
+			request:     service.CreateLocationRequest{Name: "Lisbon", Type: models.LocationSite},
+			expectError: false,
+		},
+		{
+			name:        "Valid building in site",
+			request:     service.CreateLocationRequest{Name: "HQ", Type: models.LocationBuilding, ParentID: stringPtr("site-1")},
+			expectError: false,
+		},
+		{
+			name:        "Valid room in building",
+			request:     service.CreateLocationRequest{Name: "Lab 2", Type: models.LocationRoom, ParentID: stringPtr("building-1")},
+			expectError: false,
+		},
+		{
+			name:        "Room directly in site",
+			request:     service.CreateLocationRequest{Name: "Lab 2", Type: models.LocationRoom, ParentID: stringPtr("site-1")},
+			expectError: true,
+		},
+		{
+			name:        "Site with parent",
+			request:     service.CreateLocationRequest{Name: "Porto", Type: models.LocationSite, ParentID: stringPtr("site-1")},
+			expectError: true,
+		},
+		{
+			name:        "Building without parent",
+			request:     service.CreateLocationRequest{Name: "HQ", Type: models.LocationBuilding},
+			expectError: true,
+		},
+		{
+			name:        "Unknown parent",
+			request:     service.CreateLocationRequest{Name: "HQ", Type: models.LocationBuilding, ParentID: stringPtr("missing")},
+			expectError: true,
+		},
+		{
+			name:        "Invalid type",
+			request:     service.CreateLocationRequest{Name: "Desk", Type: models.LocationType("desk")},
+			expectError: true,
+		},
+		{
+			name:        "Empty name",
+			request:     service.CreateLocationRequest{Name: "  ", Type: models.LocationSite},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, err := locationService.CreateLocation(ctx, tt.request)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, location)
+			} else {
+				assert.NoError(t, err)
+				if assert.NotNil(t, location) {
+					assert.Equal(t, tt.request.Name, location.Name)
+					assert.Equal(t, tt.request.Type, location.Type)
+					assert.NotEmpty(t, location.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestLocationService_UpdateLocation(t *testing.T) {
+	mockRepo := NewMockLocationRepository()
+	locationService := service.NewLocationService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.locations["site-1"] = newTestLocation("site-1", models.LocationSite, nil)
+	mockRepo.locations["site-2"] = newTestLocation("site-2", models.LocationSite, nil)
+	mockRepo.locations["building-1"] = newTestLocation("building-1", models.LocationBuilding, stringPtr("site-1"))
+
+	// Re-parent a building under another site
+	location, err := locationService.UpdateLocation(ctx, "building-1", service.UpdateLocationRequest{ParentID: stringPtr("site-2")})
+	assert.NoError(t, err)
+	assert.Equal(t, "site-2", *location.ParentID)
+
+	// A site cannot be nested
+	_, err = locationService.UpdateLocation(ctx, "site-1", service.UpdateLocationRequest{ParentID: stringPtr("site-2")})
+	assert.Error(t, err)
+
+	// Empty names are rejected
+	_, err = locationService.UpdateLocation(ctx, "site-1", service.UpdateLocationRequest{Name: stringPtr("")})
+	assert.Error(t, err)
+
+	_, err = locationService.UpdateLocation(ctx, "missing", service.UpdateLocationRequest{Name: stringPtr("New")})
+	assert.Error(t, err)
+}
+
+func TestLocationService_DeleteLocation(t *testing.T) {
+	mockRepo := NewMockLocationRepository()
+	locationService := service.NewLocationService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.locations["site-1"] = newTestLocation("site-1", models.LocationSite, nil)
+	mockRepo.locations["building-1"] = newTestLocation("building-1", models.LocationBuilding, stringPtr("site-1"))
+
+	assert.Error(t, locationService.DeleteLocation(ctx, "site-1"))
+	assert.NoError(t, locationService.DeleteLocation(ctx, "building-1"))
+	assert.NoError(t, locationService.DeleteLocation(ctx, "site-1"))
+	assert.Error(t, locationService.DeleteLocation(ctx, "site-1"))
+}
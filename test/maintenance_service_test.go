@@ -0,0 +1,330 @@
+package test
+
+import (
+	"context"
+	"devices-api/internal/models"
+	"devices-api/internal/repository"
+	"devices-api/internal/service"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// MockMaintenanceRepository is a mock implementation of MaintenanceRepository for testing
+type MockMaintenanceRepository struct {
+	tickets    map[string]*models.MaintenanceTicket
+	schedules  map[string]*models.MaintenanceSchedule
+	deviceRepo *MockDeviceRepository
+}
+
+func NewMockMaintenanceRepository(deviceRepo *MockDeviceRepository) *MockMaintenanceRepository {
+	return &MockMaintenanceRepository{
+		tickets:    make(map[string]*models.MaintenanceTicket),
+		schedules:  make(map[string]*models.MaintenanceSchedule),
+		deviceRepo: deviceRepo,
+	}
+}
+
+func (m *MockMaintenanceRepository) CreateTicket(ctx context.Context, ticket *models.MaintenanceTicket) error {
+	if _, exists := m.tickets[ticket.ID]; exists {
+		return errors.New("maintenance ticket already exists")
+	}
+	m.tickets[ticket.ID] = ticket
+	return nil
+}
+
+func (m *MockMaintenanceRepository) GetTicketByID(ctx context.Context, id string) (*models.MaintenanceTicket, error) {
+	ticket, exists := m.tickets[id]
+	if !exists {
+		return nil, errors.New("maintenance ticket not found")
+	}
+	return ticket, nil
+}
+
+func (m *MockMaintenanceRepository) GetAllTickets(ctx context.Context) ([]*models.MaintenanceTicket, error) {
+	var tickets []*models.MaintenanceTicket
+	for _, ticket := range m.tickets {
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
+
+func (m *MockMaintenanceRepository) GetTicketsByStatus(ctx context.Context, status models.MaintenanceStatus) ([]*models.MaintenanceTicket, error) {
+	var tickets []*models.MaintenanceTicket
+	for _, ticket := range m.tickets {
+		if ticket.Status == status {
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, nil
+}
+
+func (m *MockMaintenanceRepository) GetTicketsByDevice(ctx context.Context, deviceID string) ([]*models.MaintenanceTicket, error) {
+	var tickets []*models.MaintenanceTicket
+	for _, ticket := range m.tickets {
+		if ticket.DeviceID == deviceID {
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, nil
+}
+
+func (m *MockMaintenanceRepository) CountActiveTickets(ctx context.Context, deviceID string) (int, error) {
+	count := 0
+	for _, ticket := range m.tickets {
+		if ticket.DeviceID == deviceID && ticket.Status.IsActive() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MockMaintenanceRepository) UpdateTicket(ctx context.Context, ticket *models.MaintenanceTicket) error {
+	if _, exists := m.tickets[ticket.ID]; !exists {
+		return errors.New("maintenance ticket not found")
+	}
+	m.tickets[ticket.ID] = ticket
+	return nil
+}
+
+func (m *MockMaintenanceRepository) CreateSchedule(ctx context.Context, schedule *models.MaintenanceSchedule) error {
+	if _, exists := m.schedules[schedule.ID]; exists {
+		return errors.New("maintenance schedule already exists")
+	}
+	m.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (m *MockMaintenanceRepository) GetSchedulesByDevice(ctx context.Context, deviceID string) ([]*models.MaintenanceSchedule, error) {
+	var schedules []*models.MaintenanceSchedule
+	for _, schedule := range m.schedules {
+		if schedule.DeviceID == deviceID {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+func (m *MockMaintenanceRepository) GetDueSchedules(ctx context.Context, today models.Date) ([]*models.MaintenanceSchedule, error) {
+	var schedules []*models.MaintenanceSchedule
+	for _, schedule := range m.schedules {
+		if schedule.IsDue(today) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+func (m *MockMaintenanceRepository) UpdateSchedule(ctx context.Context, schedule *models.MaintenanceSchedule) error {
+	if _, exists := m.schedules[schedule.ID]; !exists {
+		return errors.New("maintenance schedule not found")
+	}
+	m.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (m *MockMaintenanceRepository) DeleteSchedule(ctx context.Context, id string) error {
+	if _, exists := m.schedules[id]; !exists {
+		return errors.New("maintenance schedule not found")
+	}
+	delete(m.schedules, id)
+	return nil
+}
+
+// WithTx shares the device repository's snapshot semantics for device changes
+func (m *MockMaintenanceRepository) WithTx(ctx context.Context, fn func(repo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository) error) error {
+	return m.deviceRepo.WithTx(ctx, func(deviceRepo repository.DeviceRepository) error {
+		return fn(m, deviceRepo)
+	})
+}
+
+func newMaintenanceTestService() (service.MaintenanceService, *MockMaintenanceRepository, *MockDeviceRepository) {
+	deviceRepo := NewMockDeviceRepository()
+	maintenanceRepo := NewMockMaintenanceRepository(deviceRepo)
+	deviceRepo.devices["device-1"] = &models.Device{
+		ID:           "device-1",
+		Name:         "Test Device",
+		Brand:        "Test Brand",
+		State:        models.StateAvailable,
+		CreationTime: time.Now(),
+	}
+	return service.NewMaintenanceService(maintenanceRepo, deviceRepo), maintenanceRepo, deviceRepo
+}
+
+func TestMaintenanceService_Tickets(t *testing.T) {
+	maintenanceService, _, deviceRepo := newMaintenanceTestService()
+	ctx := context.Background()
+
+	// Opening a ticket puts the device into maintenance
+	first, err := maintenanceService.CreateTicket(ctx, "device-1", service.CreateTicketRequest{Notes: "Screen flicker"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.MaintenanceOpen, first.Status)
+	assert.Equal(t, models.StateMaintenance, deviceRepo.devices["device-1"].State)
+
+	second, err := maintenanceService.CreateTicket(ctx, "device-1", service.CreateTicketRequest{Notes: "Battery check"})
+	assert.NoError(t, err)
+
+	// The device cannot be released through a regular state update
+	assert.Error(t, deviceRepo.devices["device-1"].UpdateState(models.StateAvailable))
+
+	// Negative cost is rejected
+	_, err = maintenanceService.UpdateTicket(ctx, first.ID, service.UpdateTicketRequest{Cost: floatPtr(-5)})
+	assert.Error(t, err)
+
+	// Closing one ticket keeps the device in maintenance while another is active
+	closed := models.MaintenanceClosed
+	ticket, err := maintenanceService.UpdateTicket(ctx, first.ID, service.UpdateTicketRequest{Status: &closed, Cost: floatPtr(45)})
+	assert.NoError(t, err)
+	assert.NotNil(t, ticket.ClosedAt)
+	assert.Equal(t, models.StateMaintenance, deviceRepo.devices["device-1"].State)
+
+	// Closing the last active ticket releases the device
+	_, err = maintenanceService.UpdateTicket(ctx, second.ID, service.UpdateTicketRequest{Status: &closed})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateAvailable, deviceRepo.devices["device-1"].State)
+
+	// Closed tickets cannot be reopened
+	open := models.MaintenanceOpen
+	_, err = maintenanceService.UpdateTicket(ctx, first.ID, service.UpdateTicketRequest{Status: &open})
+	assert.Error(t, err)
+
+	tickets, err := maintenanceService.GetDeviceTickets(ctx, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, tickets, 2)
+
+	_, err = maintenanceService.CreateTicket(ctx, "non-existing", service.CreateTicketRequest{})
+	assert.Error(t, err)
+}
+
+func TestMaintenanceService_RestoresPriorState(t *testing.T) {
+	deviceRepo := NewMockDeviceRepository()
+	maintenanceRepo := NewMockMaintenanceRepository(deviceRepo)
+	deviceRepo.devices["device-1"] = &models.Device{
+		ID:           "device-1",
+		Name:         "Test Device",
+		Brand:        "Test Brand",
+		State:        models.StateInactive,
+		CreationTime: time.Now(),
+	}
+	publisher := &recordingPublisher{}
+	maintenanceService := service.NewMaintenanceService(maintenanceRepo, deviceRepo, service.WithMaintenanceEventPublisher(publisher))
+	ctx := context.Background()
+
+	first, err := maintenanceService.CreateTicket(ctx, "device-1", service.CreateTicketRequest{Notes: "Screen flicker"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, first.PriorState) {
+		assert.Equal(t, models.StateInactive, *first.PriorState)
+	}
+
+	// A ticket opened while the device is already in maintenance records no prior state
+	second, err := maintenanceService.CreateTicket(ctx, "device-1", service.CreateTicketRequest{Notes: "Battery check"})
+	assert.NoError(t, err)
+	assert.Nil(t, second.PriorState)
+
+	// Closing the last active ticket returns the device to inactive, not available
+	closed := models.MaintenanceClosed
+	_, err = maintenanceService.UpdateTicket(ctx, first.ID, service.UpdateTicketRequest{Status: &closed})
+	assert.NoError(t, err)
+	_, err = maintenanceService.UpdateTicket(ctx, second.ID, service.UpdateTicketRequest{Status: &closed})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateInactive, deviceRepo.devices["device-1"].State)
+
+	// Entering and leaving maintenance are published
+	assert.Equal(t, []models.DeviceEventType{models.DeviceUpdated, models.DeviceUpdated}, publisher.types())
+}
+
+func TestMaintenanceService_Kits(t *testing.T) {
+	maintenanceService, _, deviceRepo := newMaintenanceTestService()
+	deviceService := service.NewDeviceService(deviceRepo)
+	ctx := context.Background()
+
+	for _, id := range []string{"dock", "charger"} {
+		deviceRepo.devices[id] = &models.Device{ID: id, Name: id, Brand: "Test Brand", State: models.StateAvailable, CreationTime: time.Now()}
+		_, err := deviceService.AttachChild(ctx, "device-1", service.AttachChildRequest{ChildID: id})
+		assert.NoError(t, err)
+	}
+	_, err := deviceService.UpdateDevice(ctx, "device-1", service.UpdateDeviceRequest{State: statePtr(models.StateInactive)})
+	assert.NoError(t, err)
+
+	// A ticket on the kit takes its components into maintenance too
+	kitTicket, err := maintenanceService.CreateTicket(ctx, "device-1", service.CreateTicketRequest{Notes: "Yearly check"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateMaintenance, deviceRepo.devices["dock"].State)
+	assert.Equal(t, models.StateMaintenance, deviceRepo.devices["charger"].State)
+
+	// Components cannot leave or join the kit while it is serviced
+	assert.ErrorContains(t, deviceService.DetachChild(ctx, "device-1", "dock"), "validation failed")
+
+	// A component with a ticket of its own stays under maintenance while the kit is
+	chargerTicket, err := maintenanceService.CreateTicket(ctx, "charger", service.CreateTicketRequest{Notes: "Frayed cable"})
+	assert.NoError(t, err)
+	closed := models.MaintenanceClosed
+	_, err = maintenanceService.UpdateTicket(ctx, chargerTicket.ID, service.UpdateTicketRequest{Status: &closed})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateMaintenance, deviceRepo.devices["charger"].State)
+
+	// Releasing the kit returns the components to the kit's state
+	_, err = maintenanceService.UpdateTicket(ctx, kitTicket.ID, service.UpdateTicketRequest{Status: &closed})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateInactive, deviceRepo.devices["device-1"].State)
+	assert.Equal(t, models.StateInactive, deviceRepo.devices["dock"].State)
+	assert.Equal(t, models.StateInactive, deviceRepo.devices["charger"].State)
+
+	// Unless they are still being serviced themselves
+	kitTicket, err = maintenanceService.CreateTicket(ctx, "device-1", service.CreateTicketRequest{})
+	assert.NoError(t, err)
+	chargerTicket, err = maintenanceService.CreateTicket(ctx, "charger", service.CreateTicketRequest{})
+	assert.NoError(t, err)
+	_, err = maintenanceService.UpdateTicket(ctx, kitTicket.ID, service.UpdateTicketRequest{Status: &closed})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateInactive, deviceRepo.devices["dock"].State)
+	assert.Equal(t, models.StateMaintenance, deviceRepo.devices["charger"].State)
+	_, err = maintenanceService.UpdateTicket(ctx, chargerTicket.ID, service.UpdateTicketRequest{Status: &closed})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateInactive, deviceRepo.devices["charger"].State)
+}
+
+func TestMaintenanceService_Schedules(t *testing.T) {
+	maintenanceService, maintenanceRepo, deviceRepo := newMaintenanceTestService()
+	ctx := context.Background()
+
+	// Interval must be positive
+	_, err := maintenanceService.CreateSchedule(ctx, "device-1", service.CreateScheduleRequest{Description: "Clean fans"})
+	assert.Error(t, err)
+
+	// A schedule missed for several periods produces a single ticket
+	firstDue := models.NewDate(models.Today().AddDate(0, 0, -15))
+	schedule, err := maintenanceService.CreateSchedule(ctx, "device-1", service.CreateScheduleRequest{
+		Description:  "Clean fans",
+		IntervalDays: 7,
+		FirstDue:     &firstDue,
+	})
+	assert.NoError(t, err)
+
+	tickets, err := maintenanceService.GenerateDueTickets(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, tickets, 1) {
+		assert.Equal(t, schedule.ID, *tickets[0].ScheduleID)
+		assert.Equal(t, firstDue, *tickets[0].DueDate)
+	}
+	assert.Equal(t, models.StateMaintenance, deviceRepo.devices["device-1"].State)
+	assert.True(t, maintenanceRepo.schedules[schedule.ID].NextDue.After(models.Today().Time))
+
+	// Nothing is due until the next interval
+	tickets, err = maintenanceService.GenerateDueTickets(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, tickets)
+
+	// Schedules without a first due date start one interval from today
+	schedule, err = maintenanceService.CreateSchedule(ctx, "device-1", service.CreateScheduleRequest{
+		Description:  "Replace filter",
+		IntervalDays: 30,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewDate(models.Today().AddDate(0, 0, 30)), schedule.NextDue)
+
+	assert.NoError(t, maintenanceService.DeleteSchedule(ctx, schedule.ID))
+	assert.Error(t, maintenanceService.DeleteSchedule(ctx, schedule.ID))
+}
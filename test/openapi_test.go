@@ -0,0 +1,183 @@
+package test
+
+import (
+	"devices-api/internal/events"
+	"devices-api/internal/handler"
+	"devices-api/internal/openapi"
+	"devices-api/internal/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadOpenAPISpec(t *testing.T) map[string]any {
+	var spec map[string]any
+	if err := json.Unmarshal(openapi.Spec, &spec); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	return spec
+}
+
+// TestOpenAPI_CoversRoutes fails when a route is registered without being
+// described in the OpenAPI document, or the document describes a route that
+// does not exist
+func TestOpenAPI_CoversRoutes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	assert.Equal(t, "3.1.0", spec["openapi"])
+
+	// Handlers are not called, so they can be nil
+	router := handler.NewRouter(nil, nil, nil, nil)
+
+	var routes []string
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouters match any method
+			return nil
+		}
+		for _, method := range methods {
+			routes = append(routes, method+" "+path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	var described []string
+	for path, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			described = append(described, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(routes)
+	sort.Strings(described)
+	assert.NotEmpty(t, routes)
+	assert.Equal(t, routes, described)
+}
+
+// TestOpenAPI_NegotiatedRoutesDocumentNotAcceptable requests every GET route
+// with an Accept header that no response type satisfies, and fails when a
+// route answers 406 without documenting it
+func TestOpenAPI_NegotiatedRoutesDocumentNotAcceptable(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	paths := spec["paths"].(map[string]any)
+
+	deviceHandler, mockRepo := newTestDeviceHandler()
+	mockRepo.devices["device-1"].SerialNumber = "SN-1"
+	mockRepo.devices["device-1"].AssetTag = "TAG-1"
+	maintenanceService, _, _ := newMaintenanceTestService()
+	router := handler.NewRouter(
+		deviceHandler,
+		handler.NewDeviceEventHandler(events.NewBus(10), time.Second),
+		handler.NewLocationHandler(service.NewLocationService(NewMockLocationRepository())),
+		handler.NewMaintenanceHandler(maintenanceService),
+	)
+
+	// Path variables are filled with an existing device, so that lookups
+	// reach the response
+	values := map[string]string{"id": "device-1", "brand": "Acme", "serial": "SN-1", "tag": "TAG-1"}
+	variable := regexp.MustCompile(`\{(\w+)\}`)
+	// Event streams do not end, so they are not requested
+	streams := map[string]bool{"/api/v1/devices/events": true, "/api/v1/devices/ws": true}
+
+	var negotiated []string
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil || methods[0] != "GET" || streams[path] {
+			return nil
+		}
+
+		target := variable.ReplaceAllStringFunc(path, func(name string) string {
+			return values[strings.Trim(name, "{}")]
+		})
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", "text/html")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotAcceptable {
+			return nil
+		}
+
+		negotiated = append(negotiated, path)
+		responses := paths[path].(map[string]any)["get"].(map[string]any)["responses"].(map[string]any)
+		assert.Contains(t, responses, "406", "GET %s can answer 406 but does not document it", path)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, negotiated, 7)
+}
+
+func TestOpenAPI_ReferencesResolve(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	var walk func(node any)
+	walk = func(node any) {
+		switch node := node.(type) {
+		case map[string]any:
+			if ref, ok := node["$ref"].(string); ok {
+				target := any(spec)
+				for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+					object, _ := target.(map[string]any)
+					target = object[part]
+				}
+				assert.NotNil(t, target, "unresolved reference %s", ref)
+			}
+			for _, child := range node {
+				walk(child)
+			}
+		case []any:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	router := handler.NewRouter(nil, nil, nil, nil)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, string(openapi.Spec), rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/docs", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `url: "openapi.json"`)
+	assert.NotContains(t, rr.Body.String(), "https://")
+
+	// Swagger UI is served from the binary, so the page works offline
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/docs/swagger-ui-bundle.js", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/javascript")
+	assert.Contains(t, rr.Body.String(), "SwaggerUIBundle")
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/docs/swagger-ui.css", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/css")
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/docs/LICENSE", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
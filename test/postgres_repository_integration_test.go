@@ -4,8 +4,10 @@ import (
 	"context"
 	"devices-api/internal/config"
 	"devices-api/internal/database"
+	"devices-api/internal/events"
 	"devices-api/internal/models"
 	"devices-api/internal/repository"
+	"errors"
 	"testing"
 	"time"
 
@@ -61,6 +63,48 @@ func TestPostgresRepository_DeviceCRUD(t *testing.T) {
 	assert.Equal(t, "Updated Name", updated.Name)
 	assert.Equal(t, "Updated Brand", updated.Brand)
 
+	// Projection only loads the selected columns
+	projected, err := repo.GetFieldsByID(ctx, device.ID, []string{"id", "state"})
+	assert.NoError(t, err)
+	assert.Equal(t, device.ID, projected.ID)
+	assert.Equal(t, device.State, projected.State)
+	assert.Empty(t, projected.Name)
+
+	listed, err := repo.List(ctx, repository.DeviceQuery{
+		Filter: repository.DeviceFilter{Brand: "Updated Brand"},
+		Fields: []string{"id"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, device.ID, listed[0].ID)
+	}
+
+	// State changes are recorded with the device's creation
+	device.State = models.StateInUse
+	assert.NoError(t, repo.Update(ctx, device))
+	changes, err := repo.GetStateChanges(ctx, device.CreationTime.Add(-time.Minute), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	var history []models.DeviceState
+	for _, change := range changes {
+		if change.DeviceID == device.ID {
+			history = append(history, change.ToState)
+		}
+	}
+	assert.Equal(t, []models.DeviceState{models.StateAvailable, models.StateInUse}, history)
+	device.State = models.StateAvailable
+	assert.NoError(t, repo.Update(ctx, device))
+
+	// Grouped counts include the device's brand and state
+	counts, err := repo.Count(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, counts, repository.DeviceCount{Brand: "Updated Brand", State: models.StateAvailable, Count: 1})
+
+	created, err := repo.CountCreated(ctx, models.IntervalDay, device.CreationTime.Add(-time.Minute), device.CreationTime.Add(time.Minute))
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, created) {
+		assert.Equal(t, models.NewDate(device.CreationTime.UTC()), created[0].Start)
+	}
+
 	// Delete
 	err = repo.Delete(ctx, device.ID)
 	assert.NoError(t, err)
@@ -69,3 +113,84 @@ func TestPostgresRepository_DeviceCRUD(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, deleted)
 }
+
+func TestPostgresListener_DeviceChanges(t *testing.T) {
+	repo := setupTestRepository(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := events.NewBus(10)
+	sub, _, _ := bus.Subscribe(0, false)
+	defer sub.Close()
+	listener := events.NewListener(database.DSN(config.Load().Database), bus, repo)
+	if err := listener.Listen(); err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go listener.Run(ctx)
+
+	next := func() models.DeviceEvent {
+		select {
+		case event := <-sub.Events():
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a device change")
+			return models.DeviceEvent{}
+		}
+	}
+
+	device := &models.Device{
+		ID:           "listener-test-id",
+		Name:         "Listener Device",
+		Brand:        "Test Brand",
+		State:        models.StateAvailable,
+		CreationTime: time.Now(),
+	}
+
+	// Writes that are rolled back are not announced
+	err := repo.WithTx(ctx, func(txRepo repository.DeviceRepository) error {
+		if err := txRepo.Create(ctx, device); err != nil {
+			return err
+		}
+		return errors.New("roll back")
+	})
+	assert.Error(t, err)
+
+	assert.NoError(t, repo.Create(ctx, device))
+	event := next()
+	assert.Equal(t, models.DeviceCreated, event.Type)
+	assert.Equal(t, device.ID, event.Device.ID)
+
+	device.State = models.StateInUse
+	assert.NoError(t, repo.Update(ctx, device))
+	event = next()
+	assert.Equal(t, models.DeviceUpdated, event.Type)
+	assert.Equal(t, models.StateInUse, event.Device.State)
+
+	// Deletions carry the device as it was
+	assert.NoError(t, repo.Delete(ctx, device.ID))
+	event = next()
+	assert.Equal(t, models.DeviceDeleted, event.Type)
+	assert.Equal(t, "Listener Device", event.Device.Name)
+
+	// The same changes are logged in order, skipping the rolled back write
+	changes, err := repo.GetChanges(ctx, 0, 1000)
+	assert.NoError(t, err)
+	var logged []*models.DeviceChange
+	for _, change := range changes {
+		if change.DeviceID == device.ID {
+			logged = append(logged, change)
+		}
+	}
+	if assert.Len(t, logged, 3) {
+		assert.Equal(t, models.DeviceCreated, logged[0].Type)
+		assert.Equal(t, models.StateInUse, logged[1].Device.State)
+		assert.Equal(t, models.DeviceDeleted, logged[2].Type)
+		assert.Less(t, logged[0].Sequence, logged[1].Sequence)
+		assert.Less(t, logged[1].Sequence, logged[2].Sequence)
+	}
+	rest, err := repo.GetChanges(ctx, logged[0].Sequence, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, rest, 1) {
+		assert.Greater(t, rest[0].Sequence, logged[0].Sequence)
+	}
+}
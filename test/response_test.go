@@ -0,0 +1,83 @@
+package test
+
+import (
+	"devices-api/internal/models"
+	"devices-api/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"empty defaults to JSON", "", utils.MediaTypeJSON, true},
+		{"any type", "*/*", utils.MediaTypeJSON, true},
+		{"CSV", "text/csv", utils.MediaTypeCSV, true},
+		{"XML alias", "text/xml", utils.MediaTypeXML, true},
+		{"YAML alias", "application/x-yaml", utils.MediaTypeYAML, true},
+		{"highest quality wins", "application/json;q=0.5, application/yaml", utils.MediaTypeYAML, true},
+		{"unsupported types are skipped", "text/html, application/xml;q=0.9, */*;q=0.8", utils.MediaTypeXML, true},
+		{"text wildcard", "text/*", utils.MediaTypeCSV, true},
+		{"explicit exclusion", "application/json;q=0, */*", utils.MediaTypeCSV, true},
+		{"unsupported", "image/png", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaType, ok := utils.NegotiateMediaType(tt.accept)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, mediaType)
+		})
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	purchaseDate := models.NewDate(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	devices := []*models.Device{
+		{ID: "device-1", Name: "Phone", Brand: "Acme", State: models.StateAvailable, PurchaseDate: &purchaseDate},
+		{ID: "device-2", Name: "Tablet, 10\"", Brand: "Acme", State: models.StateInUse},
+	}
+
+	write := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/devices", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		utils.WriteResponse(rr, req, http.StatusOK, devices)
+		return rr
+	}
+
+	rr := write("")
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+
+	rr = write("text/csv")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, "id,name,brand,state,creation_time,purchase_date", lines[0])
+		assert.Contains(t, lines[1], "2024-03-01")
+		assert.Contains(t, lines[2], `"Tablet, 10"""`)
+	}
+
+	rr = write("application/xml")
+	assert.Contains(t, rr.Body.String(), "<response>")
+	assert.Contains(t, rr.Body.String(), "<item>")
+	assert.Contains(t, rr.Body.String(), "<purchase_date>2024-03-01</purchase_date>")
+
+	rr = write("application/yaml")
+	assert.Contains(t, rr.Body.String(), "- id: device-1")
+	assert.Contains(t, rr.Body.String(), `purchase_date: "2024-03-01"`)
+
+	rr = write("image/png")
+	assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+}
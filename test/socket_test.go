@@ -0,0 +1,181 @@
+package test
+
+import (
+	"context"
+	"devices-api/internal/events"
+	"devices-api/internal/handler"
+	"devices-api/internal/middleware"
+	"devices-api/internal/models"
+	"devices-api/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// socketMessage is a message from the WebSocket endpoint
+type socketMessage struct {
+	Type          string              `json:"type"`
+	ID            string              `json:"id"`
+	Subscriptions []string            `json:"subscriptions"`
+	Event         *models.DeviceEvent `json:"event"`
+	Message       string              `json:"message"`
+}
+
+// newSocketServer serves the device routes through the middleware of the API
+func newSocketServer(t *testing.T, bus *events.Bus) (*httptest.Server, *handler.DeviceEventHandler) {
+	eventHandler := handler.NewDeviceEventHandler(bus, time.Second)
+	router := handler.NewRouter(nil, eventHandler, nil, nil)
+	validated := middleware.ValidationMiddleware(loadContract(t), true, utils.DefaultMaxBodySize)(router)
+	return httptest.NewServer(middleware.LoggingMiddleware(validated)), eventHandler
+}
+
+func dialSocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/devices/ws"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	return conn
+}
+
+func readSocket(t *testing.T, conn *websocket.Conn) socketMessage {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message socketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return message
+}
+
+func TestDeviceEventHandler_WebSocket(t *testing.T) {
+	bus := events.NewBus(10)
+	server, _ := newSocketServer(t, bus)
+	defer server.Close()
+	conn := dialSocket(t, server)
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]any{"type": "subscribe", "id": "phones", "device_ids": []string{"device-1", "device-2"}})
+	assert.Equal(t, socketMessage{Type: "subscribed", ID: "phones"}, readSocket(t, conn))
+	conn.WriteJSON(map[string]any{"type": "subscribe", "id": "acme", "brand": "Acme", "state": "available"})
+	assert.Equal(t, socketMessage{Type: "subscribed", ID: "acme"}, readSocket(t, conn))
+
+	// Every matching event is sent once, naming the subscriptions it matched
+	publishDevice(bus, models.DeviceCreated, "device-3", "Other")
+	publishDevice(bus, models.DeviceCreated, "device-4", "Acme")
+	publishDevice(bus, models.DeviceUpdated, "device-1", "Acme")
+	message := readSocket(t, conn)
+	assert.Equal(t, "event", message.Type)
+	assert.Equal(t, []string{"acme"}, message.Subscriptions)
+	assert.Equal(t, "device-4", message.Event.Device.ID)
+	message = readSocket(t, conn)
+	assert.Equal(t, []string{"acme", "phones"}, message.Subscriptions)
+	assert.Equal(t, models.DeviceUpdated, message.Event.Type)
+	assert.Equal(t, "device-1", message.Event.Device.ID)
+
+	conn.WriteJSON(map[string]any{"type": "unsubscribe", "id": "acme"})
+	assert.Equal(t, socketMessage{Type: "unsubscribed", ID: "acme"}, readSocket(t, conn))
+	publishDevice(bus, models.DeviceDeleted, "device-4", "Acme")
+	publishDevice(bus, models.DeviceDeleted, "device-2", "Acme")
+	message = readSocket(t, conn)
+	assert.Equal(t, []string{"phones"}, message.Subscriptions)
+	assert.Equal(t, "device-2", message.Event.Device.ID)
+
+	// Invalid requests are answered with an error and keep the connection open
+	tests := []struct {
+		request string
+		reply   socketMessage
+	}{
+		{`{"type":"subscribe","id":"broken","state":"broken"}`, socketMessage{Type: "error", ID: "broken", Message: "Invalid device state"}},
+		{`{"type":"unsubscribe","id":"acme"}`, socketMessage{Type: "error", ID: "acme", Message: "Subscription not found"}},
+		{`{"type":"subscribe"}`, socketMessage{Type: "error", Message: "Subscription ID is required"}},
+		{`{"type":"list","id":"phones"}`, socketMessage{Type: "error", ID: "phones", Message: "Message type must be subscribe or unsubscribe"}},
+	}
+	for _, tt := range tests {
+		conn.WriteMessage(websocket.TextMessage, []byte(tt.request))
+		assert.Equal(t, tt.reply, readSocket(t, conn), tt.request)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":`))
+	message = readSocket(t, conn)
+	assert.Equal(t, "error", message.Type)
+	assert.Contains(t, message.Message, "Invalid message")
+}
+
+func TestDeviceEventHandler_WebSocketShutdown(t *testing.T) {
+	bus := events.NewBus(10)
+	server, eventHandler := newSocketServer(t, bus)
+	defer server.Close()
+	conn := dialSocket(t, server)
+	defer conn.Close()
+	conn.WriteJSON(map[string]any{"type": "subscribe", "id": "all"})
+	readSocket(t, conn)
+
+	// Closing the bus closes the connection with a going away frame
+	bus.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error: %v", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, eventHandler.Shutdown(ctx))
+}
+
+func TestDeviceEventHandler_WebSocketReset(t *testing.T) {
+	bus := events.NewBus(10)
+	server, _ := newSocketServer(t, bus)
+	defer server.Close()
+	conn := dialSocket(t, server)
+	defer conn.Close()
+	conn.WriteJSON(map[string]any{"type": "subscribe", "id": "all"})
+	readSocket(t, conn)
+
+	// Clients reconnect and reload when changes may have been missed
+	bus.Reset()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart), "unexpected error: %v", err)
+}
+
+func TestDeviceEventHandler_WebSocketSlowClient(t *testing.T) {
+	bus := events.NewBus(10)
+	server, eventHandler := newSocketServer(t, bus)
+	defer server.Close()
+	conn := dialSocket(t, server)
+	defer conn.Close()
+	conn.WriteJSON(map[string]any{"type": "subscribe", "id": "all"})
+	readSocket(t, conn)
+
+	// A client that falls behind is disconnected instead of slowing down others
+	for i := 0; i < 10000; i++ {
+		publishDevice(bus, models.DeviceUpdated, "device-1", "Acme")
+	}
+	var err error
+	for err == nil {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err = conn.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, eventHandler.Shutdown(ctx))
+}
+
+func TestDeviceEventHandler_WebSocketRequiresUpgrade(t *testing.T) {
+	server, _ := newSocketServer(t, events.NewBus(10))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/devices/ws")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+}
@@ -0,0 +1,255 @@
+package test
+
+import (
+	"devices-api/internal/handler"
+	"devices-api/internal/middleware"
+	"devices-api/internal/openapi"
+	"devices-api/internal/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadContract(t *testing.T) *openapi.Contract {
+	contract, err := openapi.Load(openapi.Spec)
+	if err != nil {
+		t.Fatalf("failed to load contract: %v", err)
+	}
+	return contract
+}
+
+func TestValidationMiddleware_Requests(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	validated := middleware.ValidationMiddleware(loadContract(t), false, 256)(next)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name: "valid body", method: "POST", target: "/api/v1/devices", contentType: "application/json",
+			body:       `{"name": "Phone", "brand": "Acme", "state": "available", "purchase_cost": 12.5}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "missing content type is treated as JSON", method: "POST", target: "/api/v1/devices",
+			body:        `{"name": "Phone", "brand": "Acme"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "request body: missing required property",
+		},
+		{
+			name: "unknown property", method: "POST", target: "/api/v1/devices", contentType: "application/json",
+			body:        `{"name": "Phone", "brand": "Acme", "state": "available", "colour": "red"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "request body/colour: unknown property",
+		},
+		{
+			name: "wrong type", method: "POST", target: "/api/v1/devices", contentType: "application/json",
+			body:        `{"name": 5, "brand": "Acme", "state": "available"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "request body/name: must be of type string, got number",
+		},
+		{
+			name: "invalid enum value", method: "PUT", target: "/api/v1/devices/device-1", contentType: "application/json",
+			body:        `{"name": "Phone", "brand": "Acme", "state": "broken"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "request body/state: must be one of",
+		},
+		{
+			name: "trailing data", method: "POST", target: "/api/v1/devices", contentType: "application/json",
+			body:        `{"name": "Phone", "brand": "Acme", "state": "available"} {}`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "Request body must contain a single JSON value (unexpected data at byte offset 58)",
+		},
+		{
+			name: "malformed JSON", method: "POST", target: "/api/v1/devices", contentType: "application/json",
+			body:        `{"name": "Phone", "brand": "Acme",`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "Request body contains incomplete JSON (byte offset 34)",
+		},
+		{
+			name: "body over the size limit", method: "POST", target: "/api/v1/devices", contentType: "application/json",
+			body:        `{"name": "` + strings.Repeat("x", 300) + `", "brand": "Acme", "state": "available"}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantMessage: "Request body must not be larger than 256 bytes",
+		},
+		{
+			name: "unsupported media type", method: "POST", target: "/api/v1/devices", contentType: "text/plain",
+			body:       `name=Phone`,
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "non-JSON body is not checked", method: "POST", target: "/api/v1/devices/import?format=csv", contentType: "text/csv",
+			body:       "name,brand,state\n",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "valid query", method: "GET", target: "/api/v1/devices?state=in-use&limit=10",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "unknown query parameter", method: "GET", target: "/api/v1/devices?colour=red",
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "query parameter colour: unknown parameter",
+		},
+		{
+			name: "query parameter of the wrong type", method: "GET", target: "/api/v1/devices?limit=ten",
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "query parameter limit: must be of type integer",
+		},
+		{
+			name: "query parameter out of range", method: "GET", target: "/api/v1/devices?limit=5000",
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "query parameter limit: must be at most 1000",
+		},
+		{
+			name: "repeated query parameter", method: "GET", target: "/api/v1/devices?state=in-use&state=available",
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "query parameter state: must not be repeated",
+		},
+		{
+			name: "literal path segments win over parameters", method: "GET", target: "/api/v1/devices/search?fields=id",
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "query parameter fields: unknown parameter",
+		},
+		{
+			name: "paths outside the contract are passed through", method: "GET", target: "/metrics?anything=1",
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			validated.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+			assert.Equal(t, tt.wantStatus == http.StatusNoContent, called)
+			if tt.wantMessage != "" {
+				assert.Contains(t, rr.Body.String(), tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestValidationMiddleware_Responses(t *testing.T) {
+	contract := loadContract(t)
+	respond := func(status int, body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"1"`)
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		})
+	}
+	device := `{"id": "device-1", "name": "Phone", "brand": "Acme", "state": "available", "creation_time": "2024-01-02T03:04:05Z"}`
+
+	// A matching response is passed through unchanged
+	rr := httptest.NewRecorder()
+	middleware.ValidationMiddleware(contract, true, utils.DefaultMaxBodySize)(respond(http.StatusOK, device)).
+		ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/devices/device-1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+	assert.JSONEq(t, device, rr.Body.String())
+
+	// A body that does not match the schema becomes a server error
+	rr = httptest.NewRecorder()
+	middleware.ValidationMiddleware(contract, true, utils.DefaultMaxBodySize)(respond(http.StatusOK, `{"id": 1}`)).
+		ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/devices/device-1", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Response does not match the API contract")
+
+	// So does an undocumented status code
+	rr = httptest.NewRecorder()
+	middleware.ValidationMiddleware(contract, true, utils.DefaultMaxBodySize)(respond(http.StatusTeapot, `{}`)).
+		ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/devices/device-1", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "status 418 is not documented")
+
+	// Responses are not checked unless enabled
+	rr = httptest.NewRecorder()
+	middleware.ValidationMiddleware(contract, false, utils.DefaultMaxBodySize)(respond(http.StatusOK, `{"id": 1}`)).
+		ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/devices/device-1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id": 1}`, rr.Body.String())
+}
+
+// TestValidationMiddleware_DeviceHandlerMatchesContract runs the device routes
+// with response validation on, so a handler that drifts from the documented
+// contract fails here
+func TestValidationMiddleware_DeviceHandlerMatchesContract(t *testing.T) {
+	deviceHandler, _ := newTestDeviceHandler()
+	router := middleware.ValidationMiddleware(loadContract(t), true, utils.DefaultMaxBodySize)(handler.NewRouter(deviceHandler, nil, nil, nil))
+
+	tests := []struct {
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{"GET", "/api/v1/devices", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices?brand=Acme&sort=-name&limit=1&offset=1", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices?fields=id,state", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices?sort=colour", "", "", http.StatusBadRequest},
+		{"GET", "/api/v1/devices/device-1", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices/device-1?fields=name", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices/missing", "", "", http.StatusNotFound},
+		{"GET", "/api/v1/devices/search?q=tablet", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices/suggest?field=brand&prefix=ac", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices/stats?interval=week", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices/export?format=ndjson", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices/device-1/moves", "", "", http.StatusOK},
+		{"GET", "/api/v1/devices/device-1/children", "", "", http.StatusOK},
+		{"GET", "/api/v1/reports/warranty-expiring?days=30", "", "", http.StatusOK},
+		{"GET", "/api/v1/reports/utilization", "", "", http.StatusOK},
+		{"POST", "/api/v1/devices", "application/json", `{"name": "Phone", "brand": "Acme", "serial_number": "SN-1", "state": "available", "purchase_date": "2024-01-15", "purchase_cost": 1000}`, http.StatusCreated},
+		{"POST", "/api/v1/devices", "application/json", `{"name": "Phone", "brand": "Acme", "serial_number": "SN-1", "state": "available"}`, http.StatusConflict},
+		{"POST", "/api/v1/devices", "", `{"name": "Phone", "brand": "Acme", "state": "available"}`, http.StatusUnsupportedMediaType},
+		{"PUT", "/api/v1/devices/device-3", "application/json", `{"name": "Laptop Pro", "brand": "Other", "state": "available"}`, http.StatusOK},
+		{"PATCH", "/api/v1/devices/device-3", "application/merge-patch+json", `{"state": "in-use"}`, http.StatusOK},
+		{"PATCH", "/api/v1/devices/device-1", "application/json-patch+json", `[{"op": "replace", "path": "/name", "value": "Phone 2"}]`, http.StatusOK},
+		{"PATCH", "/api/v1/devices/device-2", "application/merge-patch+json", `{"brand": "Other"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/devices:batchCreate", "application/json", `{"items": [{"name": "Watch", "brand": "Acme", "state": "available"}]}`, http.StatusOK},
+		{"POST", "/api/v1/devices:bulkUpdate?dry_run=true", "application/json", `{"filter": {"brand": "Acme"}, "set": {"state": "inactive"}}`, http.StatusOK},
+		{"DELETE", "/api/v1/devices/device-2", "", "", http.StatusBadRequest},
+		{"DELETE", "/api/v1/devices/device-1", "", "", http.StatusNoContent},
+		{"GET", "/api/v1/changes?since=1&limit=2", "", "", http.StatusOK},
+		{"GET", "/api/v1/changes?since=-1", "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var errorResponse struct {
+			Message string `json:"message"`
+		}
+		if rr.Code >= http.StatusBadRequest {
+			json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+		}
+		assert.Equal(t, tt.wantStatus, rr.Code, "%s %s: %s", tt.method, tt.target, errorResponse.Message)
+	}
+}